@@ -0,0 +1,186 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: bank/v1/balance.proto
+
+package bankv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Balance struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Amount        float64                `protobuf:"fixed64,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	LastUpdatedAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=last_updated_at,json=lastUpdatedAt,proto3" json:"last_updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Balance) Reset() {
+	*x = Balance{}
+	mi := &file_bank_v1_balance_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Balance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Balance) ProtoMessage() {}
+
+func (x *Balance) ProtoReflect() protoreflect.Message {
+	mi := &file_bank_v1_balance_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Balance.ProtoReflect.Descriptor instead.
+func (*Balance) Descriptor() ([]byte, []int) {
+	return file_bank_v1_balance_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Balance) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Balance) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Balance) GetLastUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastUpdatedAt
+	}
+	return nil
+}
+
+type GetBalanceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBalanceRequest) Reset() {
+	*x = GetBalanceRequest{}
+	mi := &file_bank_v1_balance_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBalanceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBalanceRequest) ProtoMessage() {}
+
+func (x *GetBalanceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bank_v1_balance_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBalanceRequest.ProtoReflect.Descriptor instead.
+func (*GetBalanceRequest) Descriptor() ([]byte, []int) {
+	return file_bank_v1_balance_proto_rawDescGZIP(), []int{1}
+}
+
+var File_bank_v1_balance_proto protoreflect.FileDescriptor
+
+const file_bank_v1_balance_proto_rawDesc = "" +
+	"\n" +
+	"\x15bank/v1/balance.proto\x12\abank.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"~\n" +
+	"\aBalance\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x01R\x06amount\x12B\n" +
+	"\x0flast_updated_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\rlastUpdatedAt\"\x13\n" +
+	"\x11GetBalanceRequest2L\n" +
+	"\x0eBalanceService\x12:\n" +
+	"\n" +
+	"GetBalance\x12\x1a.bank.v1.GetBalanceRequest\x1a\x10.bank.v1.BalanceB:Z8github.com/yusuf4ktas/backend-project/api/bank/v1;bankv1b\x06proto3"
+
+var (
+	file_bank_v1_balance_proto_rawDescOnce sync.Once
+	file_bank_v1_balance_proto_rawDescData []byte
+)
+
+func file_bank_v1_balance_proto_rawDescGZIP() []byte {
+	file_bank_v1_balance_proto_rawDescOnce.Do(func() {
+		file_bank_v1_balance_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bank_v1_balance_proto_rawDesc), len(file_bank_v1_balance_proto_rawDesc)))
+	})
+	return file_bank_v1_balance_proto_rawDescData
+}
+
+var file_bank_v1_balance_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_bank_v1_balance_proto_goTypes = []any{
+	(*Balance)(nil),               // 0: bank.v1.Balance
+	(*GetBalanceRequest)(nil),     // 1: bank.v1.GetBalanceRequest
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_bank_v1_balance_proto_depIdxs = []int32{
+	2, // 0: bank.v1.Balance.last_updated_at:type_name -> google.protobuf.Timestamp
+	1, // 1: bank.v1.BalanceService.GetBalance:input_type -> bank.v1.GetBalanceRequest
+	0, // 2: bank.v1.BalanceService.GetBalance:output_type -> bank.v1.Balance
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_bank_v1_balance_proto_init() }
+func file_bank_v1_balance_proto_init() {
+	if File_bank_v1_balance_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bank_v1_balance_proto_rawDesc), len(file_bank_v1_balance_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_bank_v1_balance_proto_goTypes,
+		DependencyIndexes: file_bank_v1_balance_proto_depIdxs,
+		MessageInfos:      file_bank_v1_balance_proto_msgTypes,
+	}.Build()
+	File_bank_v1_balance_proto = out.File
+	file_bank_v1_balance_proto_goTypes = nil
+	file_bank_v1_balance_proto_depIdxs = nil
+}
@@ -0,0 +1,11 @@
+// Package api holds the contracts of the public APIs: the OpenAPI document of the REST API and
+// the protobuf definitions of the gRPC services.
+package api
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI 3 document of the REST API. Requests are validated against it, and
+// the server refuses to start when its routes and the document disagree.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
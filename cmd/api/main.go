@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"database/sql"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql" // The MySQL driver
 	"github.com/redis/go-redis/v9"
 	"github.com/yusuf4ktas/backend-project/internal/config"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/events"
 	"github.com/yusuf4ktas/backend-project/internal/logger"
+	"github.com/yusuf4ktas/backend-project/internal/mailer"
+	"github.com/yusuf4ktas/backend-project/internal/ratelimit"
 	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/security"
 	"github.com/yusuf4ktas/backend-project/internal/server"
 	"github.com/yusuf4ktas/backend-project/internal/service"
+	"github.com/yusuf4ktas/backend-project/internal/statement"
 	"github.com/yusuf4ktas/backend-project/internal/worker"
 )
 
@@ -44,6 +54,15 @@ func main() {
 	}
 	log.Info("Database connection established successfully.")
 
+	schemaVersion, dirty, err := repository.SchemaVersion(context.Background(), db)
+	if err != nil {
+		log.Error("could not read the schema version, have the migrations been applied?", "error", err)
+		os.Exit(1)
+	}
+	if dirty {
+		log.Warn("The last migration failed halfway, fix the schema and force its version.", "version", schemaVersion)
+	}
+
 	// --- Redis Connection --- //
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Address,
@@ -57,43 +76,227 @@ func main() {
 	}
 	log.Info("Redis connection established successfully.")
 
+	// --- Password Policy ---
+	passwordPolicy := &security.PasswordPolicy{
+		MinLength:     cfg.Password.MinLength,
+		MaxLength:     cfg.Password.MaxLength,
+		RequireUpper:  cfg.Password.RequireUpper,
+		RequireLower:  cfg.Password.RequireLower,
+		RequireDigit:  cfg.Password.RequireDigit,
+		RequireSymbol: cfg.Password.RequireSymbol,
+	}
+	if cfg.Password.BreachList != "" {
+		breachList, err := security.LoadBreachList(cfg.Password.BreachList)
+		if err != nil {
+			log.Error("could not load breached password list", "error", err)
+			os.Exit(1)
+		}
+		passwordPolicy.Breaches = breachList
+		log.Info("Breached password list loaded.", "path", cfg.Password.BreachList)
+	}
+
+	// --- Password Hashing ---
+	// Both algorithms stay registered so that hashes of either kind verify and are upgraded on login.
+	bcryptHasher := security.NewBcryptHasher(cfg.Password.BcryptCost)
+	argon2Hasher := security.NewArgon2idHasher(uint32(cfg.Password.Argon2Memory), uint32(cfg.Password.Argon2Iterations), uint8(cfg.Password.Argon2Parallelism))
+	passwordHasher := security.NewPasswordHasher(bcryptHasher, argon2Hasher)
+	if cfg.Password.HashAlgorithm == "argon2id" {
+		passwordHasher = security.NewPasswordHasher(argon2Hasher, bcryptHasher)
+	}
+
 	// --- Dependency Injection ---
 	userRepo := repository.NewUserRepository(db, rdb)
 	balanceRepo := repository.NewBalanceRepository(db, rdb)
 	transactionRepo := repository.NewTransactionRepository(db, rdb)
 	auditRepo := repository.NewAuditLogRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	verificationRepo := repository.NewEmailVerificationRepository(rdb)
+	resetRepo := repository.NewPasswordResetRepository(rdb)
+	sessionRepo := repository.NewSessionRepository(db, rdb)
+	roleRepo := repository.NewRoleRepository(db, rdb, schemaVersion)
+	serviceAccountRepo := repository.NewServiceAccountRepository(db, rdb)
+	statementJobRepo := repository.NewStatementJobRepository(db)
+	statementFiles, err := repository.NewStatementFileStore(cfg.Statement.StorageDir)
+	if err != nil {
+		log.Error("could not open statement storage", "error", err)
+		os.Exit(1)
+	}
+	paymentImportRepo := repository.NewPaymentImportRepository(rdb)
+
+	mailSender := mailer.NewLogSender(log)
 
-	auditService := service.NewAuditLogService(auditRepo)
-	userService := service.NewUserService(userRepo, auditService, balanceRepo)
-	transactionService := service.NewTransactionService(db, rdb, transactionRepo, balanceRepo, auditService)
+	auditService := service.NewAuditLogService(db, auditRepo, ed25519.NewKeyFromSeed(cfg.Audit.SigningKey), log)
+	userService := service.NewUserService(db, rdb, userRepo, auditService, verificationRepo, resetRepo, sessionRepo, mailSender, passwordPolicy, passwordHasher, log)
+	transactionService := service.NewTransactionService(db, rdb, transactionRepo, balanceRepo, auditService, log)
 	balanceService := service.NewBalanceService(balanceRepo)
+	roleService := service.NewRoleService(db, rdb, roleRepo, userRepo, auditService)
+	serviceAccountService := service.NewServiceAccountService(db, rdb, serviceAccountRepo, roleRepo, auditService)
+	sessionService := service.NewSessionService(db, rdb, sessionRepo, userRepo, roleRepo, outboxRepo, auditService, log)
+	statementService := service.NewStatementService(db, rdb, statementJobRepo, statementFiles, statement.Institution{
+		Currency: cfg.Statement.Currency,
+		BankID:   cfg.Statement.BankID,
+		BIC:      cfg.Statement.BIC,
+	}, log)
+	webhookService := service.NewWebhookService(db, webhookRepo, auditService, service.NewWebhookClient(cfg.Webhooks.Timeout, cfg.Webhooks.AllowPrivateNetworks), log)
+	liveUpdateService := service.NewLiveUpdateService(rdb, log)
+	notificationService := service.NewNotificationService(db, notificationRepo, userRepo, auditService, mailSender, cfg.Notifications.LowBalanceThreshold, log)
+	paymentImportService := service.NewPaymentImportService(userRepo, paymentImportRepo, outboxRepo, auditService, cfg.Statement.Currency)
+
+	// The background loops run until appCtx is cancelled on shutdown, the database and Redis are
+	// closed once they all returned.
+	appCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var background sync.WaitGroup
+	runInBackground := func(run func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(appCtx)
+		}()
+	}
 
 	// ---  Worker Pool Setup ---
 	dispatcher := worker.NewDispatcher(5, transactionService)
-	dispatcher.Run(context.Background())
+	dispatcher.Run(appCtx)
+	runInBackground(func(context.Context) { dispatcher.Wait() })
 	log.Info("Worker pool started.")
 
+	runInBackground(func(ctx context.Context) { auditService.RunCheckpoints(ctx, cfg.Audit.CheckpointInterval) })
+
+	// --- Domain Events ---
+	var publisher events.Publisher
+	switch cfg.Events.Publisher {
+	case "redis":
+		publisher = events.NewRedisStreamPublisher(rdb, cfg.Events.RedisStream, int64(cfg.Events.RedisMaxLen))
+	case "nats":
+		natsPublisher, err := events.NewNATSPublisher(cfg.Events.NATSURL, cfg.Events.SubjectPrefix)
+		if err != nil {
+			log.Error("could not connect to nats", "error", err)
+			os.Exit(1)
+		}
+		publisher = natsPublisher
+	default:
+		publisher = events.NewInProcessPublisher()
+		log.Warn("Domain events are only published in process and nothing subscribes to them, set EVENTS_PUBLISHER to redis or nats to deliver them to other systems.")
+	}
+	defer publisher.Close()
+	log.Info("Domain events are published.", "publisher", cfg.Events.Publisher)
+
+	// --- Outbox Relay ---
+	outboxRelay := service.NewOutboxRelay(db, outboxRepo, log)
+	outboxRelay.Subscribe(domain.TopicAuditLog, auditService)
+	outboxRelay.Subscribe(domain.TopicEvents, service.NewEventSink(publisher))
+	outboxRelay.Subscribe(domain.TopicEvents, webhookService)
+	outboxRelay.Subscribe(domain.TopicEvents, liveUpdateService)
+	outboxRelay.Subscribe(domain.TopicEvents, notificationService)
+	runInBackground(func(ctx context.Context) { outboxRelay.Run(ctx, cfg.Outbox.PollInterval) })
+	log.Info("Outbox relay started.")
+
+	runInBackground(func(ctx context.Context) { webhookService.RunDeliveries(ctx, time.Second) })
+	runInBackground(liveUpdateService.Run)
+	runInBackground(func(ctx context.Context) { statementService.RunJobs(ctx, time.Second) })
+
 	// --- Handlers and Server Setup ---
 	userHandler := server.NewUserHandler(userService)
 	transactionHandler := server.NewTransactionHandler(dispatcher, transactionService)
-	authHandler := server.NewAuthHandler(userService, []byte(cfg.JWTSecret))
+	authHandler := server.NewAuthHandler(userService, sessionService, serviceAccountService, []byte(cfg.JWTSecret))
 	balanceHandler := server.NewBalanceHandler(balanceService)
+	roleHandler := server.NewRoleHandler(roleService)
+	serviceAccountHandler := server.NewServiceAccountHandler(serviceAccountService)
+	sessionHandler := server.NewSessionHandler(sessionService)
+	statementHandler := server.NewStatementHandler(statementService)
+	paymentHandler := server.NewPaymentHandler(dispatcher, paymentImportService)
+	auditHandler := server.NewAuditHandler(auditService)
+	webhookHandler := server.NewWebhookHandler(webhookService)
+	streamHandler := server.NewStreamHandler(liveUpdateService, sessionService)
+	notificationHandler := server.NewNotificationHandler(notificationService)
+	healthHandler := server.NewHealthHandler(db, rdb, dispatcher, cfg.Health.CheckTimeout)
+	rateLimiter := ratelimit.NewRedisLimiter(rdb, log)
 
-	srv := server.NewServer(cfg, log, userService, userHandler, transactionHandler, authHandler, balanceHandler)
+	srv := server.NewServer(cfg, log, userService, roleService, serviceAccountService, sessionService, auditService, userHandler, transactionHandler, authHandler, balanceHandler, roleHandler, serviceAccountHandler, sessionHandler, statementHandler, paymentHandler, auditHandler, webhookHandler, streamHandler, notificationHandler, healthHandler, rateLimiter)
+	if err := srv.CheckRoutes(); err != nil {
+		log.Error("routes do not match the OpenAPI document", "error", err)
+		os.Exit(1)
+	}
 
-	// --- Start Server and Handle Graceful Shutdown ---
+	// --- Start Servers and Handle Graceful Shutdown ---
+	httpServer := &http.Server{Addr: ":" + cfg.Port, Handler: srv.Router()}
+	httpServer.RegisterOnShutdown(streamHandler.Close)
 	go func() {
 		log.Info("server starting", "port", cfg.Port)
-		if err := http.ListenAndServe(":"+cfg.Port, srv.Router()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("could not start server", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	grpcServer := srv.NewGRPCServer()
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		log.Error("could not listen for grpc", "error", err)
+		os.Exit(1)
+	}
+	go func() {
+		log.Info("grpc server starting", "port", cfg.GRPCPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Error("could not start grpc server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
 	fmt.Println("Press Ctrl+C to shut down.")
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
 	log.Info("Shutdown signal received, shutting down gracefully...")
+
+	// /readyz fails from here on. Requests keep being served during the delay, while load balancers
+	// notice and stop routing new ones here.
+	healthHandler.Drain()
+	if cfg.Health.DrainDelay > 0 {
+		log.Info("draining before shutdown", "delay", cfg.Health.DrainDelay.String())
+		time.Sleep(cfg.Health.DrainDelay)
+	}
+
+	// Both servers stop accepting requests and finish the ones in flight, for at most the timeout.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error("http server did not shut down gracefully", "error", err)
+	}
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		log.Error("grpc server did not shut down gracefully")
+		grpcServer.Stop()
+	}
+
+	// The background loops finish the work in hand, for at most the same timeout, before the
+	// connections they use are closed.
+	stopBackground()
+	backgroundStopped := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundStopped)
+	}()
+	select {
+	case <-backgroundStopped:
+	case <-shutdownCtx.Done():
+		log.Error("background loops did not stop in time")
+	}
+	if err := rdb.Close(); err != nil {
+		log.Error("could not close redis", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Error("could not close the database", "error", err)
+	}
 }
@@ -0,0 +1,63 @@
+// Command auditverify walks the hash chain of the audit log and prints the verification report.
+// It exits with status 1 when the chain is broken and 2 when it could not be verified.
+//
+// With -checkpoint it first signs the current end of the chain, for example from a cron job.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql" // The MySQL driver
+	"github.com/yusuf4ktas/backend-project/internal/config"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+func main() {
+	checkpoint := flag.Bool("checkpoint", false, "sign the current end of the chain before verifying")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FATAL: failed to load configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("mysql", cfg.Database.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FATAL: could not connect to database: %v\n", err)
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	auditService := service.NewAuditLogService(db, repository.NewAuditLogRepository(db), ed25519.NewKeyFromSeed(cfg.Audit.SigningKey), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	ctx := context.Background()
+
+	if *checkpoint {
+		if _, err := auditService.Checkpoint(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "FATAL: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	report, err := auditService.Verify(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FATAL: %v\n", err)
+		os.Exit(2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
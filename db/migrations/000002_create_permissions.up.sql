@@ -0,0 +1,51 @@
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE role_permissions (
+    role_name VARCHAR(50) NOT NULL,
+    permission_name VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role_name, permission_name),
+    FOREIGN KEY (role_name) REFERENCES roles(name) ON DELETE CASCADE,
+    FOREIGN KEY (permission_name) REFERENCES permissions(name) ON DELETE CASCADE
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Standard customer account'),
+    ('admin', 'Full administrative access'),
+    ('support', 'Read-only access for customer support'),
+    ('auditor', 'Read-only access including audit logs');
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'View any user account'),
+    ('users:delete', 'Delete any user account'),
+    ('roles:read', 'View roles and their permissions'),
+    ('roles:assign', 'Assign roles to users'),
+    ('transactions:read', 'View any transaction'),
+    ('transactions:credit', 'Credit user balances'),
+    ('transactions:debit', 'Debit user balances'),
+    ('audit:read', 'View audit logs');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:delete'),
+    ('admin', 'roles:read'),
+    ('admin', 'roles:assign'),
+    ('admin', 'transactions:read'),
+    ('admin', 'transactions:credit'),
+    ('admin', 'transactions:debit'),
+    ('admin', 'audit:read'),
+    ('support', 'users:read'),
+    ('support', 'transactions:read'),
+    ('auditor', 'users:read'),
+    ('auditor', 'roles:read'),
+    ('auditor', 'transactions:read'),
+    ('auditor', 'audit:read');
+
+ALTER TABLE users ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name);
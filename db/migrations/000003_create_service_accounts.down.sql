@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission_name = 'service_accounts:manage';
+DELETE FROM permissions WHERE name = 'service_accounts:manage';
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
@@ -0,0 +1,28 @@
+CREATE TABLE service_accounts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    client_id VARCHAR(64) NOT NULL UNIQUE,
+    client_secret_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(1024) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE api_keys (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    service_account_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix CHAR(8) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(1024) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (service_account_id) REFERENCES service_accounts(id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:manage', 'Create service accounts and manage their API keys');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'service_accounts:manage');
@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+    id CHAR(36) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    device VARCHAR(255) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    INDEX idx_sessions_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
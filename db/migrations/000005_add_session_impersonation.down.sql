@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission_name = 'users:impersonate';
+DELETE FROM permissions WHERE name = 'users:impersonate';
+ALTER TABLE sessions
+    DROP INDEX idx_sessions_impersonator_id,
+    DROP COLUMN impersonator_id;
@@ -0,0 +1,9 @@
+ALTER TABLE sessions
+    ADD COLUMN impersonator_id BIGINT NULL,
+    ADD INDEX idx_sessions_impersonator_id (impersonator_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as another user with a short-lived, audited token');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'users:impersonate');
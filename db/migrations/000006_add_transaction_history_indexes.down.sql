@@ -0,0 +1,2 @@
+DROP INDEX idx_transactions_from_user_created ON transactions;
+DROP INDEX idx_transactions_to_user_created ON transactions;
@@ -0,0 +1,3 @@
+-- Transaction history is read per direction and ordered by (created_at, id), see transactionRepository.List.
+CREATE INDEX idx_transactions_from_user_created ON transactions (from_user_id, created_at, id);
+CREATE INDEX idx_transactions_to_user_created ON transactions (to_user_id, created_at, id);
@@ -0,0 +1,2 @@
+DROP INDEX idx_users_created_at ON users;
+DROP INDEX idx_users_username ON users;
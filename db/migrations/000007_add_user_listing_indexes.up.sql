@@ -0,0 +1,3 @@
+-- Supports the filters and sort orders of the admin user listing, see userRepository.List.
+CREATE INDEX idx_users_created_at ON users (created_at, id);
+CREATE INDEX idx_users_username ON users (username);
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission_name = 'payments:import';
+DELETE FROM permissions WHERE name = 'payments:import';
@@ -0,0 +1,5 @@
+INSERT INTO permissions (name, description) VALUES
+    ('payments:import', 'Import pain.001 payment files on behalf of any debtor account');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'payments:import');
@@ -0,0 +1,9 @@
+DROP INDEX idx_audit_logs_details ON audit_logs;
+DROP INDEX idx_audit_logs_created_at ON audit_logs;
+DROP INDEX idx_audit_logs_actor ON audit_logs;
+DROP INDEX idx_audit_logs_action ON audit_logs;
+DROP INDEX idx_audit_logs_entity ON audit_logs;
+
+ALTER TABLE audit_logs
+    DROP COLUMN actor_id,
+    DROP COLUMN actor_type;
@@ -0,0 +1,12 @@
+-- The principal behind each entry, NULL for actions without a caller such as background jobs.
+ALTER TABLE audit_logs
+    ADD COLUMN actor_type VARCHAR(20) NULL AFTER action,
+    ADD COLUMN actor_id BIGINT NULL AFTER actor_type;
+
+-- Audit log searches are ordered by id, see auditLogRepository.List.
+CREATE INDEX idx_audit_logs_entity ON audit_logs (entity_type, entity_id, id);
+CREATE INDEX idx_audit_logs_action ON audit_logs (action, id);
+CREATE INDEX idx_audit_logs_actor ON audit_logs (actor_type, actor_id, id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at, id);
+-- Free text search over the details uses MATCH ... AGAINST in boolean mode.
+CREATE FULLTEXT INDEX idx_audit_logs_details ON audit_logs (details);
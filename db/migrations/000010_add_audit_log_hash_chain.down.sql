@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_chain_head;
+
+ALTER TABLE audit_logs
+    DROP COLUMN hash,
+    DROP COLUMN prev_hash;
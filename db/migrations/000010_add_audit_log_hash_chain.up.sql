@@ -0,0 +1,24 @@
+-- Each entry stores its own hash and the hash of the entry before it, see AuditLog.ChainHash.
+-- Entries written before this migration stay NULL and are reported as unchained.
+ALTER TABLE audit_logs
+    ADD COLUMN prev_hash CHAR(64) NULL,
+    ADD COLUMN hash CHAR(64) NULL;
+
+-- The newest entry of the chain. Its single row is locked while an entry is appended,
+-- which keeps concurrent writers from forking the chain.
+CREATE TABLE audit_chain_head (
+    id TINYINT PRIMARY KEY,
+    last_entry_id BIGINT NULL,
+    last_hash CHAR(64) NOT NULL DEFAULT ''
+);
+
+INSERT INTO audit_chain_head (id, last_entry_id, last_hash) VALUES (1, NULL, '');
+
+-- Ed25519 signatures over the end of the chain at a point in time.
+CREATE TABLE audit_checkpoints (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    entry_id BIGINT NOT NULL UNIQUE,
+    hash CHAR(64) NOT NULL,
+    signature VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
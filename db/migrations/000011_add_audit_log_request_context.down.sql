@@ -0,0 +1,7 @@
+DROP INDEX idx_audit_logs_request ON audit_logs;
+
+ALTER TABLE audit_logs
+    DROP COLUMN changes,
+    DROP COLUMN user_agent,
+    DROP COLUMN ip,
+    DROP COLUMN request_id;
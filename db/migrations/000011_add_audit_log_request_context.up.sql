@@ -0,0 +1,9 @@
+-- The HTTP request an entry was written in, and the fields changed by the action as JSON.
+-- changes is TEXT rather than JSON so that it is read back byte for byte, it is part of the entry's hash.
+ALTER TABLE audit_logs
+    ADD COLUMN request_id VARCHAR(36) NULL AFTER actor_id,
+    ADD COLUMN ip VARCHAR(45) NULL AFTER request_id,
+    ADD COLUMN user_agent VARCHAR(512) NULL AFTER ip,
+    ADD COLUMN changes TEXT NULL AFTER details;
+
+CREATE INDEX idx_audit_logs_request ON audit_logs (request_id);
@@ -0,0 +1,5 @@
+ALTER TABLE audit_logs
+    DROP INDEX idx_audit_logs_outbox,
+    DROP COLUMN outbox_id;
+
+DROP TABLE outbox;
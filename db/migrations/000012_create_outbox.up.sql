@@ -0,0 +1,20 @@
+-- Messages written in the same transaction as the change they describe, delivered afterwards
+-- by the outbox relay. A message is retried until delivered or until it runs out of attempts.
+CREATE TABLE outbox (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    topic VARCHAR(100) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP NULL
+);
+
+CREATE INDEX idx_outbox_pending ON outbox (status, next_attempt_at, id);
+
+-- The outbox message an entry was delivered from, a redelivered message is not logged twice.
+ALTER TABLE audit_logs
+    ADD COLUMN outbox_id BIGINT NULL,
+    ADD UNIQUE INDEX idx_audit_logs_outbox (outbox_id);
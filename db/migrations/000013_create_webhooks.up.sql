@@ -0,0 +1,32 @@
+-- Event types are stored space separated, like the scopes of service accounts.
+CREATE TABLE webhook_subscriptions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    event_types VARCHAR(512) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    circuit_open_until TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- One row per event and subscription, which is also the delivery log shown to the user.
+CREATE TABLE webhook_deliveries (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    subscription_id BIGINT NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status_code INT NULL,
+    last_error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP NULL,
+    UNIQUE KEY uq_webhook_deliveries_event (subscription_id, event_id),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at, id);
@@ -0,0 +1,24 @@
+-- A notification is created once per user, type and event, however often the event is delivered.
+CREATE TABLE notifications (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    read_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_notifications_event (user_id, event_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_notifications_unread ON notifications (user_id, read_at, id);
+
+-- Only the types a user has chosen for are stored, the others use the application defaults.
+CREATE TABLE notification_preferences (
+    user_id BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    email BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
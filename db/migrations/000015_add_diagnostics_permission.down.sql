@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission_name = 'system:diagnostics';
+DELETE FROM permissions WHERE name = 'system:diagnostics';
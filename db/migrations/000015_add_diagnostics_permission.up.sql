@@ -0,0 +1,5 @@
+INSERT INTO permissions (name, description) VALUES
+    ('system:diagnostics', 'View connection pool and worker pool diagnostics');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'system:diagnostics');
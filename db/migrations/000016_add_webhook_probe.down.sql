@@ -0,0 +1 @@
+ALTER TABLE webhook_subscriptions DROP COLUMN probe_in_flight_until;
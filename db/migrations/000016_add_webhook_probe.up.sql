@@ -0,0 +1,3 @@
+-- Set while a delivery probes an endpoint whose circuit is half-open, so that only one is in flight.
+-- It expires with the probe's lease, should the dispatcher sending it stop.
+ALTER TABLE webhook_subscriptions ADD COLUMN probe_in_flight_until TIMESTAMP NULL AFTER circuit_open_until;
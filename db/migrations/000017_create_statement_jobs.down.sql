@@ -0,0 +1 @@
+DROP TABLE statement_jobs;
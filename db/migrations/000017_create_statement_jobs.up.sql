@@ -0,0 +1,20 @@
+-- Statements generated in the background. A running job holds a lease its worker keeps renewing,
+-- a job whose lease ran out was abandoned by an instance that stopped. The generated file is kept
+-- in the statement storage directory under the job's ID.
+CREATE TABLE statement_jobs (
+    id CHAR(36) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    period_from DATETIME NOT NULL,
+    period_to DATETIME NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error VARCHAR(255) NULL,
+    lease_until TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_statement_jobs_status ON statement_jobs (status, created_at);
+CREATE INDEX idx_statement_jobs_expires_at ON statement_jobs (expires_at);
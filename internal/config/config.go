@@ -1,14 +1,21 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	Port      string
+	GRPCPort  string
 	Env       string
 	JWTSecret string
 	Database  struct {
@@ -18,6 +25,70 @@ type Config struct {
 		Address  string
 		Password string
 	}
+	Password struct {
+		MinLength     int
+		MaxLength     int // Capped at 72 bytes, bcrypt ignores anything longer
+		RequireUpper  bool
+		RequireLower  bool
+		RequireDigit  bool
+		RequireSymbol bool
+		BreachList    string // Optional path to a file of SHA-1 hashes of breached passwords
+
+		HashAlgorithm     string // "bcrypt" or "argon2id", existing hashes are upgraded on login
+		BcryptCost        int
+		Argon2Memory      int // In KiB
+		Argon2Iterations  int
+		Argon2Parallelism int
+	}
+	Statement struct {
+		Currency string // ISO 4217 code of all accounts, reported in OFX and camt.053 exports
+		BankID   string // Routing number reported as BANKID in OFX exports
+		BIC      string // Optional BIC of the account servicer in camt.053 exports
+		// StorageDir keeps the files of statement jobs, it has to be shared by all instances.
+		StorageDir string
+	}
+	Audit struct {
+		SigningKey         []byte // Ed25519 seed signing the audit chain checkpoints
+		CheckpointInterval time.Duration
+	}
+	Outbox struct {
+		PollInterval time.Duration // How often the relay looks for due outbox messages
+	}
+	Events struct {
+		Publisher     string // "inprocess", "redis" or "nats"
+		RedisStream   string
+		RedisMaxLen   int // Approximate number of events kept in the stream
+		NATSURL       string
+		SubjectPrefix string // NATS subjects are SubjectPrefix.<event type>
+	}
+	Webhooks struct {
+		Timeout time.Duration
+		// AllowPrivateNetworks lets webhooks target loopback and private addresses, which is
+		// only safe when users cannot reach internal services that way.
+		AllowPrivateNetworks bool
+	}
+	Notifications struct {
+		LowBalanceThreshold float64 // A balance falling below this notifies its user
+	}
+	Health struct {
+		CheckTimeout time.Duration // Limit of each readiness check
+		// DrainDelay is how long the server reports unready before it stops accepting requests,
+		// so that load balancers stop routing to it first.
+		DrainDelay time.Duration
+	}
+	// RateLimit holds the policy of each group of routes, applied per user or service account and
+	// per client IP for unauthenticated requests.
+	RateLimit struct {
+		Login    RateLimitPolicy // Authentication routes and failed authentications
+		Transfer RateLimitPolicy // Routes moving money
+		Read     RateLimitPolicy // Other GET requests
+		Write    RateLimitPolicy // Other requests
+	}
+}
+
+type RateLimitPolicy struct {
+	PerMinute int // Requests per minute in the long run
+	Burst     int // Requests allowed at once
 }
 
 func LoadConfig() (*Config, error) {
@@ -33,6 +104,13 @@ func LoadConfig() (*Config, error) {
 	if cfg.Port == "" {
 		cfg.Port = "8080"
 	}
+	cfg.GRPCPort = os.Getenv("GRPC_PORT")
+	if cfg.GRPCPort == "" {
+		cfg.GRPCPort = "50051"
+	}
+	if cfg.GRPCPort == cfg.Port {
+		return nil, errors.New("error: GRPC_PORT must differ from PORT")
+	}
 	cfg.Database.DSN = os.Getenv("DATABASE_DSN")
 	if cfg.Database.DSN == "" {
 		return nil, errors.New("error: DATABASE_DSN environment variable is required")
@@ -49,5 +127,218 @@ func LoadConfig() (*Config, error) {
 	}
 	cfg.Redis.Password = os.Getenv("REDIS_PASSWORD")
 
+	var err error
+	if cfg.Password.MinLength, err = getEnvInt("PASSWORD_MIN_LENGTH", 8); err != nil {
+		return nil, err
+	}
+	if cfg.Password.MaxLength, err = getEnvInt("PASSWORD_MAX_LENGTH", 72); err != nil {
+		return nil, err
+	}
+	if cfg.Password.MaxLength > 72 || cfg.Password.MinLength > cfg.Password.MaxLength {
+		return nil, errors.New("error: PASSWORD_MAX_LENGTH must be at most 72 and not below PASSWORD_MIN_LENGTH")
+	}
+	if cfg.Password.RequireUpper, err = getEnvBool("PASSWORD_REQUIRE_UPPERCASE", false); err != nil {
+		return nil, err
+	}
+	if cfg.Password.RequireLower, err = getEnvBool("PASSWORD_REQUIRE_LOWERCASE", false); err != nil {
+		return nil, err
+	}
+	if cfg.Password.RequireDigit, err = getEnvBool("PASSWORD_REQUIRE_DIGIT", false); err != nil {
+		return nil, err
+	}
+	if cfg.Password.RequireSymbol, err = getEnvBool("PASSWORD_REQUIRE_SYMBOL", false); err != nil {
+		return nil, err
+	}
+	cfg.Password.BreachList = os.Getenv("PASSWORD_BREACH_LIST")
+
+	cfg.Password.HashAlgorithm = os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if cfg.Password.HashAlgorithm == "" {
+		cfg.Password.HashAlgorithm = "bcrypt"
+	}
+	if cfg.Password.HashAlgorithm != "bcrypt" && cfg.Password.HashAlgorithm != "argon2id" {
+		return nil, errors.New("error: PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id")
+	}
+	if cfg.Password.BcryptCost, err = getEnvInt("BCRYPT_COST", 10); err != nil {
+		return nil, err
+	}
+	if cfg.Password.BcryptCost < 4 || cfg.Password.BcryptCost > 31 {
+		return nil, errors.New("error: BCRYPT_COST must be between 4 and 31")
+	}
+	if cfg.Password.Argon2Memory, err = getEnvInt("ARGON2_MEMORY_KIB", 64*1024); err != nil {
+		return nil, err
+	}
+	if cfg.Password.Argon2Iterations, err = getEnvInt("ARGON2_ITERATIONS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.Password.Argon2Parallelism, err = getEnvInt("ARGON2_PARALLELISM", 2); err != nil {
+		return nil, err
+	}
+	if cfg.Password.Argon2Memory < 8 || cfg.Password.Argon2Iterations < 1 || cfg.Password.Argon2Parallelism < 1 || cfg.Password.Argon2Parallelism > 255 {
+		return nil, errors.New("error: ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM are out of range")
+	}
+
+	cfg.Statement.Currency = os.Getenv("STATEMENT_CURRENCY")
+	if cfg.Statement.Currency == "" {
+		cfg.Statement.Currency = "EUR"
+	}
+	if len(cfg.Statement.Currency) != 3 {
+		return nil, errors.New("error: STATEMENT_CURRENCY must be a three letter ISO 4217 code")
+	}
+	cfg.Statement.BankID = os.Getenv("STATEMENT_BANK_ID")
+	if cfg.Statement.BankID == "" {
+		cfg.Statement.BankID = "000000000"
+	}
+	cfg.Statement.BIC = os.Getenv("STATEMENT_BIC")
+	cfg.Statement.StorageDir = os.Getenv("STATEMENT_STORAGE_DIR")
+	if cfg.Statement.StorageDir == "" {
+		cfg.Statement.StorageDir = "data/statements"
+	}
+
+	if key := os.Getenv("AUDIT_SIGNING_KEY"); key != "" {
+		if cfg.Audit.SigningKey, err = base64.StdEncoding.DecodeString(key); err != nil || len(cfg.Audit.SigningKey) != ed25519.SeedSize {
+			return nil, errors.New("error: AUDIT_SIGNING_KEY must be a base64 encoded 32 byte Ed25519 seed")
+		}
+	} else if cfg.Env == "development" {
+		// Stable across restarts so that checkpoints keep verifying, but only as secret as JWT_SECRET.
+		seed := sha256.Sum256([]byte("audit-checkpoint:" + cfg.JWTSecret))
+		cfg.Audit.SigningKey = seed[:]
+	} else {
+		return nil, errors.New("error: AUDIT_SIGNING_KEY environment variable is required outside development")
+	}
+	checkpointMinutes, err := getEnvInt("AUDIT_CHECKPOINT_INTERVAL_MINUTES", 60)
+	if err != nil {
+		return nil, err
+	}
+	if checkpointMinutes < 1 {
+		return nil, errors.New("error: AUDIT_CHECKPOINT_INTERVAL_MINUTES must be at least 1")
+	}
+	cfg.Audit.CheckpointInterval = time.Duration(checkpointMinutes) * time.Minute
+
+	pollMillis, err := getEnvInt("OUTBOX_POLL_INTERVAL_MS", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if pollMillis < 1 {
+		return nil, errors.New("error: OUTBOX_POLL_INTERVAL_MS must be at least 1")
+	}
+	cfg.Outbox.PollInterval = time.Duration(pollMillis) * time.Millisecond
+
+	cfg.Events.Publisher = os.Getenv("EVENTS_PUBLISHER")
+	if cfg.Events.Publisher == "" {
+		cfg.Events.Publisher = "inprocess"
+	}
+	if cfg.Events.Publisher != "inprocess" && cfg.Events.Publisher != "redis" && cfg.Events.Publisher != "nats" {
+		return nil, errors.New("error: EVENTS_PUBLISHER must be inprocess, redis or nats")
+	}
+	cfg.Events.RedisStream = os.Getenv("EVENTS_REDIS_STREAM")
+	if cfg.Events.RedisStream == "" {
+		cfg.Events.RedisStream = "events"
+	}
+	if cfg.Events.RedisMaxLen, err = getEnvInt("EVENTS_REDIS_MAXLEN", 100000); err != nil {
+		return nil, err
+	}
+	cfg.Events.NATSURL = os.Getenv("EVENTS_NATS_URL")
+	if cfg.Events.NATSURL == "" {
+		cfg.Events.NATSURL = "nats://localhost:4222"
+	}
+	cfg.Events.SubjectPrefix = os.Getenv("EVENTS_SUBJECT_PREFIX")
+	if cfg.Events.SubjectPrefix == "" {
+		cfg.Events.SubjectPrefix = "events"
+	}
+
+	webhookTimeout, err := getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return nil, err
+	}
+	if webhookTimeout < 1 || webhookTimeout > 60 {
+		return nil, errors.New("error: WEBHOOK_TIMEOUT_SECONDS must be between 1 and 60")
+	}
+	cfg.Webhooks.Timeout = time.Duration(webhookTimeout) * time.Second
+	if cfg.Webhooks.AllowPrivateNetworks, err = getEnvBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", cfg.Env == "development"); err != nil {
+		return nil, err
+	}
+
+	lowBalanceThreshold, err := getEnvInt("NOTIFICATION_LOW_BALANCE_THRESHOLD", 100)
+	if err != nil {
+		return nil, err
+	}
+	if lowBalanceThreshold < 0 {
+		return nil, errors.New("error: NOTIFICATION_LOW_BALANCE_THRESHOLD must not be negative")
+	}
+	cfg.Notifications.LowBalanceThreshold = float64(lowBalanceThreshold)
+
+	checkTimeout, err := getEnvInt("HEALTH_CHECK_TIMEOUT_MS", 2000)
+	if err != nil {
+		return nil, err
+	}
+	if checkTimeout < 1 {
+		return nil, errors.New("error: HEALTH_CHECK_TIMEOUT_MS must be at least 1")
+	}
+	cfg.Health.CheckTimeout = time.Duration(checkTimeout) * time.Millisecond
+	drainDelay, err := getEnvInt("SHUTDOWN_DRAIN_DELAY_SECONDS", 5)
+	if err != nil {
+		return nil, err
+	}
+	if drainDelay < 0 {
+		return nil, errors.New("error: SHUTDOWN_DRAIN_DELAY_SECONDS must not be negative")
+	}
+	cfg.Health.DrainDelay = time.Duration(drainDelay) * time.Second
+
+	if cfg.RateLimit.Login, err = getEnvRateLimitPolicy("LOGIN", 10, 5); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Transfer, err = getEnvRateLimitPolicy("TRANSFER", 30, 10); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Read, err = getEnvRateLimitPolicy("READ", 300, 60); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Write, err = getEnvRateLimitPolicy("WRITE", 60, 20); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+// getEnvRateLimitPolicy reads RATE_LIMIT_<name>_PER_MINUTE and RATE_LIMIT_<name>_BURST.
+func getEnvRateLimitPolicy(name string, perMinute, burst int) (RateLimitPolicy, error) {
+	var policy RateLimitPolicy
+	var err error
+	if policy.PerMinute, err = getEnvInt("RATE_LIMIT_"+name+"_PER_MINUTE", perMinute); err != nil {
+		return policy, err
+	}
+	if policy.PerMinute < 1 {
+		return policy, fmt.Errorf("error: RATE_LIMIT_%s_PER_MINUTE must be at least 1", name)
+	}
+	if policy.Burst, err = getEnvInt("RATE_LIMIT_"+name+"_BURST", burst); err != nil {
+		return policy, err
+	}
+	if policy.Burst < 1 {
+		return policy, fmt.Errorf("error: RATE_LIMIT_%s_BURST must be at least 1", name)
+	}
+	return policy, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("error: %s must be an integer: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error: %s must be a boolean: %w", key, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "errors"
+
+// The errors below are part of the API: the server maps each of them to a response status and a
+// stable error code, so they are matched with errors.Is and may be wrapped with more detail.
+var (
+	ErrUserNotFound             = errors.New("user not found")
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrBalanceNotFound          = errors.New("balance not found")
+	ErrServiceAccountNotFound   = errors.New("service account not found")
+	ErrDuplicateEmail           = errors.New("email address is already in use")
+	ErrInvalidProfile           = errors.New("invalid profile")
+	ErrInvalidTransfer          = errors.New("invalid transfer")
+	ErrInvalidImpersonation     = errors.New("invalid impersonation request")
+	ErrInvalidServiceAccount    = errors.New("invalid service account")
+	ErrIncorrectPassword        = errors.New("current password is incorrect")
+	ErrInvalidVerificationToken = errors.New("verification token is invalid or expired")
+	ErrInvalidResetToken        = errors.New("password reset token is invalid or expired")
+	ErrRoleNotFound             = errors.New("role does not exist")
+	ErrUnknownScope             = errors.New("unknown scope")
+	ErrInvalidCredentials       = errors.New("invalid client credentials")
+	ErrAPIKeyNotFound           = errors.New("api key not found")
+	ErrSessionNotFound          = errors.New("session not found")
+	ErrSessionInactive          = errors.New("session has been revoked or has expired")
+	ErrInvalidCursor            = errors.New("invalid pagination cursor")
+	ErrInvalidFilter            = errors.New("invalid filter")
+	ErrStatementJobNotFound     = errors.New("statement job not found or expired")
+	ErrWebhookNotFound          = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound  = errors.New("webhook delivery not found")
+	ErrInvalidWebhook           = errors.New("invalid webhook subscription")
+	ErrInsufficientFunds        = errors.New("insufficient funds")
+	ErrNotificationNotFound     = errors.New("notification not found")
+	ErrInvalidPreferences       = errors.New("invalid notification preferences")
+	ErrInvalidAmount            = errors.New("amount must be a positive number")
+)
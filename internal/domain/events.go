@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TopicEvents carries Event envelopes written through the outbox.
+const TopicEvents = "events"
+
+// Event types. A type keeps its meaning forever, incompatible changes to its data are
+// published under a new Version. The schema of every version is in docs/events.schema.json.
+const (
+	EventTransferCompleted = "transfer.completed"
+	EventUserRegistered    = "user.registered"
+	EventBalanceChanged    = "balance.changed"
+	EventTransferFailed    = "transfer.failed"
+	EventNewDeviceLogin    = "session.new_device"
+)
+
+// EventTypes lists every event type, in the order they were introduced.
+var EventTypes = []string{EventTransferCompleted, EventUserRegistered, EventBalanceChanged, EventTransferFailed, EventNewDeviceLogin}
+
+// Event is the envelope every domain event is published in. Events are delivered at least
+// once, consumers recognise a redelivered event by its ID.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// CorrelationID is the ID of the request that caused the event, shared by every event and
+	// audit entry of that request. Events without a request use their own ID.
+	CorrelationID string          `json:"correlation_id"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// UserIDs returns the users an event concerns, for example both sides of a transfer.
+func (e *Event) UserIDs() ([]int64, error) {
+	switch e.Type {
+	case EventTransferCompleted:
+		var data TransferCompleted
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, err
+		}
+		return []int64{data.FromUserID, data.ToUserID}, nil
+	case EventUserRegistered:
+		var data UserRegistered
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, err
+		}
+		return []int64{data.UserID}, nil
+	case EventBalanceChanged:
+		var data BalanceChanged
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, err
+		}
+		return []int64{data.UserID}, nil
+	case EventTransferFailed:
+		var data TransferFailed
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, err
+		}
+		// The receiver never learns about a transfer that did not happen.
+		return []int64{data.FromUserID}, nil
+	case EventNewDeviceLogin:
+		var data NewDeviceLogin
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, err
+		}
+		return []int64{data.UserID}, nil
+	}
+	return nil, nil
+}
+
+// EventData is the typed payload of an event.
+type EventData interface {
+	EventType() string
+	EventVersion() int
+}
+
+// TransferCompleted is published when money moved between two users.
+type TransferCompleted struct {
+	TransactionID int64     `json:"transaction_id"`
+	FromUserID    int64     `json:"from_user_id"`
+	ToUserID      int64     `json:"to_user_id"`
+	Amount        float64   `json:"amount"`
+	CompletedAt   time.Time `json:"completed_at"`
+}
+
+func (TransferCompleted) EventType() string { return EventTransferCompleted }
+func (TransferCompleted) EventVersion() int { return 1 }
+
+// UserRegistered is published when a user signed up. Version 1 also carried the username and
+// email, consumers that need them look the user up, so they never travel on the bus.
+type UserRegistered struct {
+	UserID       int64     `json:"user_id"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+func (UserRegistered) EventType() string { return EventUserRegistered }
+func (UserRegistered) EventVersion() int { return 2 }
+
+// BalanceChanged is published for every balance a transaction changed. Delta is negative for
+// money leaving the account, Balance is the amount after the change.
+type BalanceChanged struct {
+	UserID        int64   `json:"user_id"`
+	TransactionID int64   `json:"transaction_id"`
+	Delta         float64 `json:"delta"`
+	Balance       float64 `json:"balance"`
+}
+
+func (BalanceChanged) EventType() string { return EventBalanceChanged }
+func (BalanceChanged) EventVersion() int { return 1 }
+
+// TransferFailed is published when a queued transfer could not be booked, nothing was moved.
+type TransferFailed struct {
+	FromUserID int64     `json:"from_user_id"`
+	ToUserID   int64     `json:"to_user_id"`
+	Amount     float64   `json:"amount"`
+	Reason     string    `json:"reason"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+func (TransferFailed) EventType() string { return EventTransferFailed }
+func (TransferFailed) EventVersion() int { return 1 }
+
+// NewDeviceLogin is published when a user logged in from a device none of their earlier sessions
+// used. A user's first login is not reported.
+type NewDeviceLogin struct {
+	UserID     int64     `json:"user_id"`
+	SessionID  string    `json:"session_id"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	LoggedInAt time.Time `json:"logged_in_at"`
+}
+
+func (NewDeviceLogin) EventType() string { return EventNewDeviceLogin }
+func (NewDeviceLogin) EventVersion() int { return 1 }
+
+// LiveUpdate is an event pushed to the open streams of a user. IDs increase with every update of
+// a user, a client that reconnects passes the last ID it saw to receive what it missed.
+type LiveUpdate struct {
+	ID    string `json:"id"`
+	Event *Event `json:"event"`
+}
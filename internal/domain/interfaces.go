@@ -1,20 +1,34 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByID(ctx context.Context, id int64) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, userID int64, passwordHash string, updatedAt time.Time) error
 	Delete(ctx context.Context, id int64) error
-	GetAllUsers(ctx context.Context) ([]User, error)
+	// List returns one page of users matching the filter together with the total number of matches.
+	// Password hashes are not loaded.
+	List(ctx context.Context, filter UserFilter) ([]User, int64, error)
 }
 
 type TransactionRepository interface {
 	Create(ctx context.Context, tx *Transaction) error
-	GetByUserID(ctx context.Context, userID int64) ([]Transaction, error)
+	// List returns up to filter.Limit+1 transactions, the extra one tells the caller that another page exists.
+	List(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
 	GetByTransactionID(ctx context.Context, id int64) (*Transaction, error)
+	// NetAmountBefore sums the completed transactions of the user created before the given time,
+	// incoming amounts counted positive and outgoing ones negative.
+	NetAmountBefore(ctx context.Context, userID int64, before time.Time) (float64, error)
+	// ForEachInRange calls fn for each completed transaction of the user created in [from, to),
+	// oldest first, without loading the whole range into memory. Iteration stops at the first error.
+	ForEachInRange(ctx context.Context, userID int64, from, to time.Time, fn func(*Transaction) error) error
 }
 
 type BalanceRepository interface {
@@ -25,4 +39,164 @@ type BalanceRepository interface {
 
 type AuditLogRepository interface {
 	Create(ctx context.Context, log *AuditLog) error
+	// List returns up to filter.Limit+1 entries newest first, the extra entry tells the caller that another page exists.
+	List(ctx context.Context, filter AuditLogFilter) ([]AuditLog, error)
+	// ForEach calls fn for every matching entry, oldest first. Limit and Cursor are ignored.
+	ForEach(ctx context.Context, filter AuditLogFilter, fn func(*AuditLog) error) error
+	// LockChainHead reads the chain head and locks it until the surrounding transaction ends,
+	// so that entries are appended to the chain one at a time.
+	LockChainHead(ctx context.Context) (*AuditChainHead, error)
+	GetChainHead(ctx context.Context) (*AuditChainHead, error)
+	UpdateChainHead(ctx context.Context, head *AuditChainHead) error
+	// CreateCheckpoint does nothing when the entry already has a checkpoint.
+	CreateCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error
+	LatestCheckpoint(ctx context.Context) (*AuditCheckpoint, error)
+	ListCheckpoints(ctx context.Context) ([]AuditCheckpoint, error)
+	// ExistsForOutbox reports whether the message with outboxID was already logged.
+	ExistsForOutbox(ctx context.Context, outboxID int64) (bool, error)
+}
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, v *EmailVerification) error
+	Get(ctx context.Context, token string) (*EmailVerification, error)
+	// Consume returns the verification for the token and deletes it so it can only be used once.
+	Consume(ctx context.Context, token string) (*EmailVerification, error)
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *PasswordReset) error
+	Get(ctx context.Context, token string) (*PasswordReset, error)
+	// Consume deletes the reset so it can only be used once.
+	Consume(ctx context.Context, token string) (*PasswordReset, error)
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *Session) error
+	GetByID(ctx context.Context, id string) (*Session, error)
+	// ListActiveByUserID excludes impersonation sessions, which are listed by ListActiveImpersonations.
+	ListActiveByUserID(ctx context.Context, userID int64, now time.Time) ([]Session, error)
+	ListActiveImpersonations(ctx context.Context, now time.Time) ([]Session, error)
+	Touch(ctx context.Context, id string, lastSeenAt time.Time) error
+	Revoke(ctx context.Context, userID int64, id string, revokedAt time.Time) error
+	// RevokeAllExcept revokes every active session of the user except keepID.
+	RevokeAllExcept(ctx context.Context, userID int64, keepID string, revokedAt time.Time) error
+	// CountDeviceSessions counts the sessions the user ever had, revoked and expired ones
+	// included, and how many of them were on device. Impersonation sessions are not counted.
+	CountDeviceSessions(ctx context.Context, userID int64, device string) (total int, onDevice int, err error)
+}
+
+type RoleRepository interface {
+	GetByName(ctx context.Context, name string) (*Role, error)
+	List(ctx context.Context) ([]Role, error)
+	ListPermissions(ctx context.Context) ([]Permission, error)
+}
+
+type ServiceAccountRepository interface {
+	Create(ctx context.Context, account *ServiceAccount) error
+	GetByID(ctx context.Context, id int64) (*ServiceAccount, error)
+	GetByClientID(ctx context.Context, clientID string) (*ServiceAccount, error)
+	List(ctx context.Context) ([]ServiceAccount, error)
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID int64) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int64, revokedAt time.Time) error
+	TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error
+}
+
+type StatementJobRepository interface {
+	Create(ctx context.Context, job *StatementJob) error
+	// Get does not return jobs that expired before now.
+	Get(ctx context.Context, id string, now time.Time) (*StatementJob, error)
+	// ClaimPending locks the oldest pending job, skipping jobs locked by other workers. It returns
+	// nil when no job is pending.
+	ClaimPending(ctx context.Context) (*StatementJob, error)
+	// MarkRunning starts a job, leased to its worker until leaseUntil.
+	MarkRunning(ctx context.Context, id string, leaseUntil time.Time) error
+	// RenewLease extends the lease of a running job.
+	RenewLease(ctx context.Context, id string, leaseUntil time.Time) error
+	// Finish records the outcome of a running job.
+	Finish(ctx context.Context, job *StatementJob) error
+	// FailAbandoned marks running jobs whose lease ran out before now as failed and returns how many.
+	FailAbandoned(ctx context.Context, now time.Time, reason string) (int64, error)
+	// ListExpired returns the IDs of the jobs that expired before now, whose files can be deleted.
+	ListExpired(ctx context.Context, now time.Time) ([]string, error)
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// StatementFileStore keeps the files of statement jobs, written once and read by any instance.
+type StatementFileStore interface {
+	// Write stores the output of write under id. Nothing is stored when write fails.
+	Write(ctx context.Context, id string, write func(w io.Writer) error) error
+	Open(ctx context.Context, id string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type PaymentImportRepository interface {
+	// ClaimMessageID records the message ID of an imported payment file for owner. It returns false when
+	// the same owner already imported a file with this ID, which must then not be booked again.
+	ClaimMessageID(ctx context.Context, owner, msgID string, ttl time.Duration) (bool, error)
+	// ReleaseMessageID forgets a claimed message ID, for a file that ended up not being imported.
+	ReleaseMessageID(ctx context.Context, owner, msgID string) error
+}
+
+type OutboxRepository interface {
+	Create(ctx context.Context, msg *OutboxMessage) error
+	// ClaimDue returns up to limit pending messages that are due at now, oldest first. Inside a
+	// transaction they stay locked until it ends and are skipped by other relays meanwhile.
+	ClaimDue(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+	// Lease makes the messages with ids due again only at until, so that other relays leave
+	// them alone while they are delivered.
+	Lease(ctx context.Context, ids []int64, until time.Time) error
+	MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error
+	// MarkFailed records a failed attempt and sets when the message is retried or, with
+	// status OutboxDead, that it is not retried at all.
+	MarkFailed(ctx context.Context, msg *OutboxMessage) error
+	CountPending(ctx context.Context) (int64, error)
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *WebhookSubscription) error
+	// GetSubscription returns ErrWebhookNotFound unless the subscription belongs to userID.
+	GetSubscription(ctx context.Context, userID, id int64) (*WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context, userID int64) ([]WebhookSubscription, error)
+	ListSubscriptionsForUsers(ctx context.Context, userIDs []int64) ([]WebhookSubscription, error)
+	GetSubscriptionsByID(ctx context.Context, ids []int64) (map[int64]*WebhookSubscription, error)
+	// DeleteSubscription also deletes its delivery log.
+	DeleteSubscription(ctx context.Context, userID, id int64) error
+	// CreateDelivery does nothing when the subscription already has a delivery for the event.
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetDelivery(ctx context.Context, subscriptionID, id int64) (*WebhookDelivery, error)
+	// ListDeliveries returns up to filter.Limit+1 deliveries newest first, the extra one tells the caller that another page exists.
+	ListDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]WebhookDelivery, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries due at now whose endpoint's circuit
+	// is not open and not being probed. Inside a transaction they stay locked until it ends and
+	// other dispatchers skip them.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	// ClaimProbe marks a probe of the subscription's half-open endpoint in flight until until. It
+	// returns false when another probe already is.
+	ClaimProbe(ctx context.Context, subscriptionID int64, now, until time.Time) (bool, error)
+	// LeaseDeliveries postpones the deliveries to until, so that they are retried should the
+	// dispatcher sending them stop before recording the outcome.
+	LeaseDeliveries(ctx context.Context, ids []int64, until time.Time) error
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// RecordEndpointSuccess closes the circuit of the subscription's endpoint.
+	RecordEndpointSuccess(ctx context.Context, subscriptionID int64) error
+	// RecordEndpointFailure counts a failed delivery and opens the circuit until openUntil once
+	// threshold deliveries in a row have failed. Both end a probe in flight.
+	RecordEndpointFailure(ctx context.Context, subscriptionID int64, threshold int, openUntil time.Time) error
+}
+
+type NotificationRepository interface {
+	// Create stores the notification unless the user already has one of its type for its event,
+	// it reports whether it was stored.
+	Create(ctx context.Context, notification *Notification) (bool, error)
+	// List returns up to filter.Limit+1 notifications newest first, the extra one tells the caller that another page exists.
+	List(ctx context.Context, filter NotificationFilter) ([]Notification, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	// MarkRead returns ErrNotificationNotFound unless the notification belongs to userID.
+	MarkRead(ctx context.Context, userID, id int64, readAt time.Time) error
+	MarkAllRead(ctx context.Context, userID int64, readAt time.Time) (int64, error)
+	// GetEmailPreferences returns only the types the user has chosen for.
+	GetEmailPreferences(ctx context.Context, userID int64) (map[NotificationType]bool, error)
+	SetEmailPreferences(ctx context.Context, userID int64, email map[NotificationType]bool) error
 }
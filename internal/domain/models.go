@@ -1,6 +1,10 @@
 package domain
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/mail"
 	"sync"
@@ -17,21 +21,34 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-// Validate for user struct data
-func (u *User) Validate(password string) error {
+// ValidateProfile checks the user fields that can be changed after registration.
+// Passwords are checked separately against the configured security.PasswordPolicy.
+func (u *User) ValidateProfile() error {
 	if u.Username == "" {
-		return fmt.Errorf("username cannot be empty")
-	}
-	if len(password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
+		return fmt.Errorf("%w: username cannot be empty", ErrInvalidProfile)
 	}
 	_, err := mail.ParseAddress(u.Email)
 	if err != nil {
-		return fmt.Errorf("invalid email address format: %w", err)
+		return fmt.Errorf("%w: invalid email address format", ErrInvalidProfile)
 	}
 	return nil
 }
 
+// EmailVerification is a pending email change, applied once the token is confirmed.
+type EmailVerification struct {
+	Token     string    `json:"token"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordReset is a pending password reset requested through the forgot password flow.
+type PasswordReset struct {
+	Token     string    `json:"token"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type Transaction struct {
 	ID              int64             `json:"id"`
 	FromUserID      int64             `json:"from_user_id"`
@@ -81,10 +98,447 @@ func (b *Balance) Subtract(amount float64) {
 }
 
 type AuditLog struct {
-	ID         int64     `json:"id"`
-	EntityType string    `json:"entity_type"`
-	EntityID   int64     `json:"entity_id"`
-	Action     string    `json:"action"`
-	Details    string    `json:"details"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         int64  `json:"id"`
+	EntityType string `json:"entity_type"`
+	EntityID   int64  `json:"entity_id"`
+	Action     string `json:"action"`
+	// ActorType and ActorID are the principal that caused the entry, they are empty for
+	// actions without a caller such as background jobs.
+	ActorType PrincipalType `json:"actor_type,omitempty"`
+	ActorID   *int64        `json:"actor_id,omitempty"`
+	// RequestID, IP and UserAgent identify the HTTP request the action was made in.
+	RequestID string `json:"request_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Details   string `json:"details"`
+	// Changes maps each changed field to its AuditChange, for actions that modify a record.
+	Changes   json.RawMessage `json:"changes,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	// PrevHash and Hash link the entry into the tamper-evident chain, see ChainHash.
+	// Entries written before the chain was introduced have neither.
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	// OutboxID is the outbox message the entry was delivered from, it is not part of the hash.
+	OutboxID *int64 `json:"-"`
+}
+
+// AuditChange is the value of a field before and after an action, null when the record
+// did not exist before or does not exist after.
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// auditLogContent is the hashed form of an entry. Fields added later must be omitempty,
+// so that the hashes of older entries stay the same.
+type auditLogContent struct {
+	PrevHash   string          `json:"prev_hash"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int64           `json:"entity_id"`
+	Action     string          `json:"action"`
+	ActorType  PrincipalType   `json:"actor_type,omitempty"`
+	ActorID    *int64          `json:"actor_id,omitempty"`
+	Details    string          `json:"details"`
+	CreatedAt  int64           `json:"created_at"`
+	RequestID  string          `json:"request_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+}
+
+// ChainHash returns the hex SHA-256 of the entry's content and PrevHash. Editing any field,
+// or removing the previous entry, breaks the link to the entry's stored Hash.
+// CreatedAt is hashed in whole seconds, the precision it is stored with.
+func (l *AuditLog) ChainHash() string {
+	data, _ := json.Marshal(auditLogContent{
+		PrevHash:   l.PrevHash,
+		EntityType: l.EntityType,
+		EntityID:   l.EntityID,
+		Action:     l.Action,
+		ActorType:  l.ActorType,
+		ActorID:    l.ActorID,
+		Details:    l.Details,
+		CreatedAt:  l.CreatedAt.Unix(),
+		RequestID:  l.RequestID,
+		IP:         l.IP,
+		UserAgent:  l.UserAgent,
+		Changes:    l.Changes,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainHead is the newest entry of the hash chain. LastHash is empty before the first entry.
+type AuditChainHead struct {
+	LastEntryID int64
+	LastHash    string
+}
+
+// AuditCheckpoint is a signed record that the chain ended at EntryID with Hash. Unlike the
+// chain itself, a checkpoint cannot be recomputed by someone who can only write to the database.
+type AuditCheckpoint struct {
+	ID        int64     `json:"id"`
+	EntryID   int64     `json:"entry_id"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SignedMessage is the message covered by Signature.
+func (c *AuditCheckpoint) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("audit-checkpoint:%d:%s:%d", c.EntryID, c.Hash, c.CreatedAt.Unix()))
+}
+
+// AuditChainBreak is the first entry whose link in the chain does not hold.
+type AuditChainBreak struct {
+	EntryID int64  `json:"entry_id"`
+	Reason  string `json:"reason"`
+}
+
+type AuditChainReport struct {
+	Valid bool `json:"valid"`
+	// Verified counts the chained entries checked before the first break.
+	Verified int64 `json:"verified"`
+	// Unchained counts entries written before the chain was introduced.
+	Unchained           int64            `json:"unchained"`
+	LastEntryID         int64            `json:"last_entry_id"`
+	LastHash            string           `json:"last_hash"`
+	CheckpointsVerified int              `json:"checkpoints_verified"`
+	PublicKey           string           `json:"public_key"`
+	Broken              *AuditChainBreak `json:"broken,omitempty"`
+}
+
+// ExportFormat is a file format for exporting records.
+type ExportFormat string
+
+const (
+	ExportCSV   ExportFormat = "csv"
+	ExportJSONL ExportFormat = "jsonl"
+)
+
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleAuditor = "auditor"
+)
+
+// Permission is a named capability granted to roles, in the form "resource:action".
+type Permission string
+
+const (
+	PermUsersRead          Permission = "users:read"
+	PermUsersDelete        Permission = "users:delete"
+	PermRolesRead          Permission = "roles:read"
+	PermRolesAssign        Permission = "roles:assign"
+	PermTransactionsRead   Permission = "transactions:read"
+	PermTransactionsCredit Permission = "transactions:credit"
+	PermTransactionsDebit  Permission = "transactions:debit"
+	PermAuditRead          Permission = "audit:read"
+	PermServiceAccounts    Permission = "service_accounts:manage"
+	PermUsersImpersonate   Permission = "users:impersonate"
+	PermPaymentsImport     Permission = "payments:import"
+	PermDiagnostics        Permission = "system:diagnostics"
+)
+
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// ServiceAccount is a non-human client, such as a back-office batch system.
+type ServiceAccount struct {
+	ID               int64        `json:"id"`
+	Name             string       `json:"name"`
+	ClientID         string       `json:"client_id"`
+	ClientSecretHash string       `json:"-"`
+	Scopes           []Permission `json:"scopes"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
+
+// APIKey is a long-lived credential of a service account. Only the hash of the key is stored,
+// the prefix is used to look it up.
+type APIKey struct {
+	ID               int64        `json:"id"`
+	ServiceAccountID int64        `json:"service_account_id"`
+	Name             string       `json:"name"`
+	Prefix           string       `json:"prefix"`
+	KeyHash          string       `json:"-"`
+	Scopes           []Permission `json:"scopes"`
+	ExpiresAt        *time.Time   `json:"expires_at"`
+	LastUsedAt       *time.Time   `json:"last_used_at"`
+	RevokedAt        *time.Time   `json:"revoked_at"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
+
+// Session is a login of a user on a device. Every user token is bound to a session.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// ImpersonatorID is set when an admin acts as the user through this session.
+	ImpersonatorID *int64 `json:"impersonator_id,omitempty"`
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type PrincipalType string
+
+const (
+	PrincipalUser    PrincipalType = "user"
+	PrincipalService PrincipalType = "service"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Type PrincipalType `json:"type"`
+	ID   int64         `json:"id"`
+	// Scopes are only set for service principals, users get their permissions from their role.
+	Scopes []Permission `json:"scopes,omitempty"`
+	// SessionID is only set for user principals.
+	SessionID string `json:"session_id,omitempty"`
+	// ImpersonatorID is the admin acting as the user, zero when the user acts themselves.
+	ImpersonatorID int64 `json:"impersonator_id,omitempty"`
+	ReadOnly       bool  `json:"read_only,omitempty"`
+}
+
+func (p *Principal) IsImpersonated() bool {
+	return p.ImpersonatorID != 0
+}
+
+type contextKey string
+
+// PrincipalContextKey holds the *Principal of the request. It lives in domain so that services
+// can tell who is acting without depending on the server package.
+const PrincipalContextKey = contextKey("principal")
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(PrincipalContextKey).(*Principal)
+	return p, ok
+}
+
+// RequestInfo identifies the HTTP request an action was made in.
+type RequestInfo struct {
+	RequestID string
+	IP        string
+	UserAgent string
+}
+
+// RequestInfoContextKey holds the *RequestInfo of the request.
+const RequestInfoContextKey = contextKey("request_info")
+
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(RequestInfoContextKey).(*RequestInfo)
+	return info, ok
+}
+
+// Origin is the principal and request behind an action. It is carried over to work that
+// finishes after the request, such as worker jobs, so that their audit entries are attributed.
+type Origin struct {
+	Principal *Principal
+	Request   *RequestInfo
+}
+
+func OriginFromContext(ctx context.Context) Origin {
+	var o Origin
+	o.Principal, _ = PrincipalFromContext(ctx)
+	o.Request, _ = RequestInfoFromContext(ctx)
+	return o
+}
+
+// WithOrigin returns a copy of ctx carrying the principal and request of o.
+func WithOrigin(ctx context.Context, o Origin) context.Context {
+	if o.Principal != nil {
+		ctx = context.WithValue(ctx, PrincipalContextKey, o.Principal)
+	}
+	if o.Request != nil {
+		ctx = context.WithValue(ctx, RequestInfoContextKey, o.Request)
+	}
+	return ctx
+}
+
+type StatementFormat string
+
+const (
+	StatementCSV   StatementFormat = "csv"
+	StatementJSONL StatementFormat = "jsonl"
+	StatementPDF   StatementFormat = "pdf"
+	StatementOFX   StatementFormat = "ofx"
+	// StatementCamt053 is the ISO 20022 BankToCustomerStatement, camt.053.001.02.
+	StatementCamt053 StatementFormat = "camt053"
+)
+
+// StatementRequest covers the transactions created in [From, To).
+type StatementRequest struct {
+	UserID int64           `json:"user_id"`
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"`
+	Format StatementFormat `json:"format"`
+}
+
+type StatementJobStatus string
+
+const (
+	StatementJobPending   StatementJobStatus = "pending"
+	StatementJobRunning   StatementJobStatus = "running"
+	StatementJobCompleted StatementJobStatus = "completed"
+	StatementJobFailed    StatementJobStatus = "failed"
+)
+
+// StatementJob generates a statement in the background. The result can be downloaded until ExpiresAt.
+type StatementJob struct {
+	ID string `json:"id"`
+	StatementRequest
+	Status      StatementJobStatus `json:"status"`
+	Error       string             `json:"error,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+}
+
+// PaymentInstruction is a credit transfer from an imported payment file that passed validation
+// and can be queued as a transfer.
+type PaymentInstruction struct {
+	FromUserID int64
+	ToUserID   int64
+	Amount     float64
+	EndToEndID string
+}
+
+// TopicAuditLog carries AuditLog entries written through the outbox.
+const TopicAuditLog = "audit_log"
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxDelivered OutboxStatus = "delivered"
+	// OutboxDead messages ran out of attempts and are no longer retried.
+	OutboxDead OutboxStatus = "dead"
+)
+
+// OutboxMessage is written in the same transaction as the change it describes, so it exists
+// exactly when the change does. The outbox relay delivers it to the sinks of its Topic.
+type OutboxMessage struct {
+	ID            int64           `json:"id"`
+	Topic         string          `json:"topic"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        OutboxStatus    `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// NewOutboxMessage creates a pending message carrying payload as JSON.
+func NewOutboxMessage(topic string, payload interface{}) (*OutboxMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &OutboxMessage{
+		Topic:         topic,
+		Payload:       data,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// WebhookSubscription pushes the events of EventTypes that concern its user to URL.
+type WebhookSubscription struct {
+	ID         int64    `json:"id"`
+	UserID     int64    `json:"user_id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Secret signs the deliveries. It is only returned when the subscription is created.
+	Secret string `json:"-"`
+	// ConsecutiveFailures and CircuitOpenUntil are the endpoint's circuit breaker. While the
+	// circuit is open no deliveries are attempted, afterwards a single one tests the endpoint.
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	CircuitOpenUntil    *time.Time `json:"circuit_open_until,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryFailed deliveries ran out of attempts, they can still be redelivered by hand.
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one subscription, retried until the endpoint accepts it.
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	SubscriptionID int64                 `json:"subscription_id"`
+	EventID        string                `json:"event_id"`
+	EventType      string                `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	// LastStatusCode is zero when the endpoint could not be reached.
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+type NotificationType string
+
+const (
+	NotificationTransferReceived NotificationType = "transfer_received"
+	NotificationTransferFailed   NotificationType = "transfer_failed"
+	NotificationLowBalance       NotificationType = "low_balance"
+	NotificationNewDeviceLogin   NotificationType = "new_device_login"
+)
+
+// NotificationTypes lists every notification type, in the order they were introduced.
+var NotificationTypes = []NotificationType{NotificationTransferReceived, NotificationTransferFailed, NotificationLowBalance, NotificationNewDeviceLogin}
+
+// DefaultEmailNotifications are the types emailed to users who did not choose otherwise.
+var DefaultEmailNotifications = map[NotificationType]bool{
+	NotificationTransferReceived: false,
+	NotificationTransferFailed:   true,
+	NotificationLowBalance:       false,
+	NotificationNewDeviceLogin:   true,
+}
+
+// Notification is a message shown to a user in the app, created from the event with EventID.
+type Notification struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	Title     string           `json:"title"`
+	Body      string           `json:"body"`
+	EventID   string           `json:"event_id"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// NotificationPreferences chooses per type whether notifications are also emailed.
+type NotificationPreferences struct {
+	Email map[NotificationType]bool `json:"email"`
 }
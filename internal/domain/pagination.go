@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// TransactionCursor points at the last transaction of a page. Pages are ordered by
+// (created_at, id) descending, so the next page starts strictly after this position.
+type TransactionCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+// Encode returns the cursor as an opaque string, clients must not rely on its contents.
+func (c TransactionCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeTransactionCursor(s string) (*TransactionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c TransactionCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+type TransactionDirection string
+
+const (
+	DirectionAny      TransactionDirection = ""
+	DirectionIncoming TransactionDirection = "incoming"
+	DirectionOutgoing TransactionDirection = "outgoing"
+)
+
+// TransactionFilter selects a page of a user's transactions. Nil and empty fields are not filtered on.
+type TransactionFilter struct {
+	UserID         int64
+	From           *time.Time // inclusive
+	To             *time.Time // exclusive
+	Type           string
+	Status         TransactionStatus
+	Direction      TransactionDirection
+	CounterpartyID *int64
+	MinAmount      *float64
+	MaxAmount      *float64
+	Cursor         *TransactionCursor
+	Limit          int
+}
+
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// UserSortFields lists the columns the admin user listing can be ordered by.
+var UserSortFields = []string{"id", "username", "email", "role", "created_at"}
+
+// UserFilter selects a page of users for the admin listing. Empty fields are not filtered on.
+type UserFilter struct {
+	// Search matches a substring of the username or email.
+	Search      string
+	Role        string
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Sort        string
+	SortDesc    bool
+	Page        int
+	PageSize    int
+}
+
+type UserPage struct {
+	Users    []User `json:"users"`
+	Total    int64  `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+// AuditLogCursor points at the last entry of a page. Entries are ordered by id descending,
+// which is the order they were written in.
+type AuditLogCursor struct {
+	ID int64 `json:"id"`
+}
+
+func (c AuditLogCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeAuditLogCursor(s string) (*AuditLogCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c AuditLogCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// AuditLogFilter selects audit log entries. Nil and empty fields are not filtered on.
+type AuditLogFilter struct {
+	EntityType string
+	EntityID   *int64
+	Action     string
+	ActorType  PrincipalType
+	ActorID    *int64
+	RequestID  string
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	// Query matches entries whose details contain all of its words.
+	Query  string
+	Cursor *AuditLogCursor
+	Limit  int
+}
+
+type AuditLogPage struct {
+	Entries []AuditLog `json:"entries"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// WebhookDeliveryCursor points at the last delivery of a page, ordered by id descending.
+type WebhookDeliveryCursor struct {
+	ID int64 `json:"id"`
+}
+
+func (c WebhookDeliveryCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeWebhookDeliveryCursor(s string) (*WebhookDeliveryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c WebhookDeliveryCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// WebhookDeliveryFilter selects the delivery log of a subscription, newest first.
+type WebhookDeliveryFilter struct {
+	SubscriptionID int64
+	Status         WebhookDeliveryStatus
+	Cursor         *WebhookDeliveryCursor
+	Limit          int
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NotificationCursor points at the last notification of a page, ordered by id descending.
+type NotificationCursor struct {
+	ID int64 `json:"id"`
+}
+
+func (c NotificationCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeNotificationCursor(s string) (*NotificationCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c NotificationCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// NotificationFilter selects a user's notifications, newest first.
+type NotificationFilter struct {
+	UserID     int64
+	UnreadOnly bool
+	Cursor     *NotificationCursor
+	Limit      int
+}
+
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// NATSPublisher publishes events to NATS JetStream under the subject prefix.type, for example
+// events.transfer.completed. A stream has to capture the subjects, JetStream then acknowledges
+// every event and drops redelivered ones within the stream's duplicate window.
+type NATSPublisher struct {
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	prefix string
+}
+
+func NewNATSPublisher(url, prefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("backend-project"))
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, js: js, prefix: prefix}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(p.prefix + "." + event.Type)
+	msg.Data = data
+	msg.Header.Set("Event-Type", event.Type)
+	msg.Header.Set("Event-Version", strconv.Itoa(event.Version))
+	msg.Header.Set("Correlation-Id", event.CorrelationID)
+	// Nats-Msg-Id lets JetStream discard the event when the outbox relay delivers it again.
+	msg.Header.Set(nats.MsgIdHdr, event.ID)
+
+	_, err = p.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+// Close sends what is still buffered and closes the connection.
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,55 @@
+// Package events publishes domain events to other systems.
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// Publisher hands an event to a broker. A nil error means the broker has accepted the event,
+// so that the outbox relay can retry it otherwise.
+type Publisher interface {
+	Publish(ctx context.Context, event *domain.Event) error
+	Close() error
+}
+
+// Handler reacts to an event published in process.
+type Handler func(ctx context.Context, event *domain.Event) error
+
+// InProcessPublisher calls the handlers subscribed to an event's type before Publish returns.
+// It needs no broker and is the default for a single instance and for local development.
+type InProcessPublisher struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe calls handler for every event of eventType, or of any type when eventType is "*".
+func (p *InProcessPublisher) Subscribe(eventType string, handler Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[eventType] = append(p.handlers[eventType], handler)
+}
+
+// Publish fails with the first handler error, the event is then published to every handler again.
+func (p *InProcessPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	p.mu.RLock()
+	handlers := append(append([]Handler(nil), p.handlers[event.Type]...), p.handlers["*"]...)
+	p.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *InProcessPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+func TestInProcessPublisher(t *testing.T) {
+	failed := errors.New("handler failed")
+
+	tests := []struct {
+		name      string
+		eventType string
+		// failing lists the subscriptions whose handler returns an error.
+		failing  map[string]bool
+		wantErr  error
+		wantSeen []string
+	}{
+		{name: "subscribed type", eventType: domain.EventTransferCompleted, wantSeen: []string{domain.EventTransferCompleted, "*"}},
+		{name: "other type", eventType: domain.EventBalanceChanged, wantSeen: []string{"*"}},
+		{name: "handler error stops publishing", eventType: domain.EventTransferCompleted, failing: map[string]bool{domain.EventTransferCompleted: true}, wantErr: failed, wantSeen: []string{domain.EventTransferCompleted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []string
+			p := NewInProcessPublisher()
+			for _, subscription := range []string{domain.EventTransferCompleted, "*"} {
+				p.Subscribe(subscription, func(_ context.Context, event *domain.Event) error {
+					if event.Type != tt.eventType {
+						t.Errorf("handler got a %s event, want %s", event.Type, tt.eventType)
+					}
+					seen = append(seen, subscription)
+					if tt.failing[subscription] {
+						return failed
+					}
+					return nil
+				})
+			}
+
+			err := p.Publish(context.Background(), &domain.Event{ID: "evt-1", Type: tt.eventType, Version: 1})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(seen, tt.wantSeen) {
+				t.Errorf("handlers called %v, want %v", seen, tt.wantSeen)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// RedisStreamPublisher appends events to a Redis stream, which consumers read with consumer
+// groups. The stream is trimmed to about maxLen entries.
+type RedisStreamPublisher struct {
+	rdb    *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(rdb *redis.Client, stream string, maxLen int64) *RedisStreamPublisher {
+	return &RedisStreamPublisher{rdb: rdb, stream: stream, maxLen: maxLen}
+}
+
+// Publish adds the event with its type and version as separate fields, so consumers can skip
+// events without decoding them. The envelope is in the "event" field.
+func (p *RedisStreamPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":      event.ID,
+			"type":    event.Type,
+			"version": strconv.Itoa(event.Version),
+			"event":   data,
+		},
+	}).Err()
+}
+
+// Close leaves the Redis client open, it is shared with the rest of the application.
+func (p *RedisStreamPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+func TestRedisStreamPublisher(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		maxLen    int64
+		wantKept  int
+	}{
+		{name: "appends every event", published: 3, maxLen: 10, wantKept: 3},
+		{name: "trims the stream", published: 5, maxLen: 2, wantKept: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			p := NewRedisStreamPublisher(rdb, "events", tt.maxLen)
+
+			ctx := context.Background()
+			var sent []*domain.Event
+			for i := range tt.published {
+				event := &domain.Event{
+					ID:            "evt-" + strconv.Itoa(i),
+					Type:          domain.EventBalanceChanged,
+					Version:       1,
+					OccurredAt:    time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC),
+					CorrelationID: "req-1",
+					Data:          json.RawMessage(`{"user_id":1}`),
+				}
+				if err := p.Publish(ctx, event); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				sent = append(sent, event)
+			}
+
+			entries, err := rdb.XRange(ctx, "events", "-", "+").Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantKept {
+				t.Fatalf("stream holds %d events, want %d", len(entries), tt.wantKept)
+			}
+			// The newest events are kept, in the order they were published.
+			for i, entry := range entries {
+				want := sent[len(sent)-tt.wantKept+i]
+				if entry.Values["id"] != want.ID || entry.Values["type"] != want.Type || entry.Values["version"] != "1" {
+					t.Errorf("entry %d has fields %v, want %s %s 1", i, entry.Values, want.ID, want.Type)
+				}
+				var got domain.Event
+				if err := json.Unmarshal([]byte(entry.Values["event"].(string)), &got); err != nil {
+					t.Fatalf("entry %d does not hold an event: %v", i, err)
+				}
+				if got.ID != want.ID || got.CorrelationID != want.CorrelationID || string(got.Data) != string(want.Data) {
+					t.Errorf("entry %d holds %+v, want %+v", i, got, *want)
+				}
+			}
+		})
+	}
+}
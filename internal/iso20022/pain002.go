@@ -0,0 +1,151 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"
+
+// Status codes of a payment status report.
+const (
+	StatusAccepted          = "ACCP"
+	StatusPartiallyAccepted = "PART"
+	StatusRejected          = "RJCT"
+)
+
+// Reason codes from the ISO 20022 external status reason code list.
+const (
+	ReasonInvalidDebtorAccount    = "AC02"
+	ReasonInvalidCreditorAccount  = "AC03"
+	ReasonTransactionForbidden    = "AG01"
+	ReasonZeroAmount              = "AM01"
+	ReasonNotAllowedCurrency      = "AM03"
+	ReasonDuplication             = "AM05"
+	ReasonInvalidAmount           = "AM12"
+	ReasonInvalidGroupControlSum  = "AM16"
+	ReasonInvalidPmtInfControlSum = "AM17"
+	ReasonInvalidNumberOfTxs      = "AM18"
+	ReasonDuplicateMessageID      = "DU01"
+)
+
+// Pain002 is a CustomerPaymentStatusReport (pain.002.001.03) answering an imported pain.001.
+type Pain002 struct {
+	XMLName xml.Name     `xml:"Document"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Report  StatusReport `xml:"CstmrPmtStsRpt"`
+}
+
+type StatusReport struct {
+	GrpHdr     ReportGroupHeader       `xml:"GrpHdr"`
+	OrgnlGroup OriginalGroupStatus     `xml:"OrgnlGrpInfAndSts"`
+	OrgnlPmts  []OriginalPaymentStatus `xml:"OrgnlPmtInfAndSts"`
+}
+
+type ReportGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type OriginalGroupStatus struct {
+	OrgnlMsgId   string         `xml:"OrgnlMsgId"`
+	OrgnlMsgNmId string         `xml:"OrgnlMsgNmId"`
+	OrgnlNbOfTxs string         `xml:"OrgnlNbOfTxs,omitempty"`
+	OrgnlCtrlSum string         `xml:"OrgnlCtrlSum,omitempty"`
+	GrpSts       string         `xml:"GrpSts"`
+	StsRsnInf    []StatusReason `xml:"StsRsnInf,omitempty"`
+}
+
+type OriginalPaymentStatus struct {
+	OrgnlPmtInfId string              `xml:"OrgnlPmtInfId"`
+	PmtInfSts     string              `xml:"PmtInfSts"`
+	StsRsnInf     []StatusReason      `xml:"StsRsnInf,omitempty"`
+	TxInfAndSts   []TransactionStatus `xml:"TxInfAndSts"`
+}
+
+type TransactionStatus struct {
+	OrgnlInstrId    string         `xml:"OrgnlInstrId,omitempty"`
+	OrgnlEndToEndId string         `xml:"OrgnlEndToEndId"`
+	TxSts           string         `xml:"TxSts"`
+	StsRsnInf       []StatusReason `xml:"StsRsnInf,omitempty"`
+}
+
+type StatusReason struct {
+	Code     string `xml:"Rsn>Cd"`
+	AddtlInf string `xml:"AddtlInf,omitempty"`
+}
+
+// NewPain002 starts a report answering doc. The caller adds a status for each payment information block.
+func NewPain002(doc *Pain001, now time.Time) *Pain002 {
+	report := &Pain002{
+		Xmlns: pain002Namespace,
+		Report: StatusReport{
+			GrpHdr: ReportGroupHeader{
+				MsgId:   "STS-" + doc.GrpHdr.MsgId,
+				CreDtTm: now.UTC().Format("2006-01-02T15:04:05Z"),
+			},
+			OrgnlGroup: OriginalGroupStatus{
+				OrgnlMsgId:   doc.GrpHdr.MsgId,
+				OrgnlMsgNmId: doc.MessageName(),
+				OrgnlNbOfTxs: doc.GrpHdr.NbOfTxs,
+				OrgnlCtrlSum: doc.GrpHdr.CtrlSum,
+			},
+		},
+	}
+	return report
+}
+
+// Reject rejects the whole message, no payment information block is reported individually.
+func (p *Pain002) Reject(code, info string) {
+	p.Report.OrgnlGroup.GrpSts = StatusRejected
+	p.Report.OrgnlGroup.StsRsnInf = append(p.Report.OrgnlGroup.StsRsnInf, StatusReason{Code: code, AddtlInf: info})
+	p.Report.OrgnlPmts = nil
+}
+
+// Accepted counts the transactions reported as accepted.
+func (p *Pain002) Accepted() int { return p.count(StatusAccepted) }
+
+// Rejected counts the transactions reported as rejected.
+func (p *Pain002) Rejected() int { return p.count(StatusRejected) }
+
+func (p *Pain002) count(status string) int {
+	n := 0
+	for _, pmt := range p.Report.OrgnlPmts {
+		for _, tx := range pmt.TxInfAndSts {
+			if tx.TxSts == status {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Finish sets the group status from the transaction statuses, unless the message was rejected as a whole.
+func (p *Pain002) Finish() {
+	if p.Report.OrgnlGroup.GrpSts == StatusRejected {
+		return
+	}
+	accepted, rejected := p.Accepted(), p.Rejected()
+	switch {
+	case rejected == 0:
+		p.Report.OrgnlGroup.GrpSts = StatusAccepted
+	case accepted == 0:
+		p.Report.OrgnlGroup.GrpSts = StatusRejected
+	default:
+		p.Report.OrgnlGroup.GrpSts = StatusPartiallyAccepted
+	}
+}
+
+func (p *Pain002) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -1,23 +1,47 @@
 package logger
 
 import (
+	"context"
 	"log/slog"
 	"os"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
 )
 
 func CreateLogger(env string) *slog.Logger {
-	var log *slog.Logger
+	var handler slog.Handler
 
 	//Read from environment file and create logs based on the current app state
 	switch env {
 	case "development":
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case "staging":
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
 	case "production":
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
 	default:
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return slog.New(RequestHandler{Handler: handler})
+}
+
+// RequestHandler adds the ID of the request in the context to the records logged with it, so the
+// log lines of the services can be matched with the request that caused them.
+type RequestHandler struct {
+	slog.Handler
+}
+
+func (h RequestHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info, ok := domain.RequestInfoFromContext(ctx); ok && info.RequestID != "" {
+		r.AddAttrs(slog.String("request_id", info.RequestID))
 	}
-	return log
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h RequestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return RequestHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h RequestHandler) WithGroup(name string) slog.Handler {
+	return RequestHandler{Handler: h.Handler.WithGroup(name)}
 }
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+func TestRequestHandlerAddsRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "request", ctx: context.WithValue(context.Background(), domain.RequestInfoContextKey, &domain.RequestInfo{RequestID: "req-1"}), want: "request_id=req-1"},
+		{name: "relayed message", ctx: domain.WithOrigin(context.Background(), domain.Origin{Request: &domain.RequestInfo{RequestID: "req-2"}}), want: "request_id=req-2"},
+		{name: "background job", ctx: context.Background()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := slog.New(RequestHandler{Handler: slog.NewTextHandler(&buf, nil)}).With("job", "sweep")
+			log.ErrorContext(tt.ctx, "failed", "error", "boom")
+
+			got := buf.String()
+			if !strings.Contains(got, `msg=failed job=sweep error=boom`) {
+				t.Errorf("attributes are missing: %s", got)
+			}
+			if tt.want == "" && strings.Contains(got, "request_id") {
+				t.Errorf("logged a request ID outside of a request: %s", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("logged %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
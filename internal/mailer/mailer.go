@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Sender delivers an email message to a single recipient.
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogSender writes the messages to the application log instead of sending them.
+// It is used until a real mail provider is configured.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, to, subject, body string) error {
+	s.logger.InfoContext(ctx, "email sent", "to", to, "subject", subject, "body", body)
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package ratelimit limits how often a client may call the API, shared by all instances through
+// Redis.
+//
+// Both limiters implement GCRA, the generic cell rate algorithm: a key is represented by its
+// theoretical arrival time (TAT), the time at which it would be back to its full burst. Every
+// request moves the TAT one emission interval (Period / Limit) further, and a request is refused
+// when that would put the TAT more than Burst intervals ahead of now. This behaves like a
+// sliding window without storing the requests in it.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy is the rate allowed to one client of a group of routes.
+type Policy struct {
+	Name   string
+	Limit  int // Requests per Period in the long run
+	Period time.Duration
+	Burst  int // Requests allowed at once, at least 1
+}
+
+// interval is the time a request uses up.
+func (p Policy) interval() time.Duration {
+	return p.Period / time.Duration(p.Limit)
+}
+
+// tolerance is how far ahead of now the TAT may be after an allowed request.
+func (p Policy) tolerance() time.Duration {
+	return p.interval() * time.Duration(p.Burst)
+}
+
+// Result is the outcome of a request.
+type Result struct {
+	Allowed   bool
+	Remaining int // Requests that could be made right now
+	// RetryAfter is how long a refused client has to wait for the next request, zero when allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the client is back to the full burst.
+	ResetAfter time.Duration
+}
+
+// Limiter counts a request of key against policy. Keys of different policies are independent.
+type Limiter interface {
+	Allow(ctx context.Context, policy Policy, key string) Result
+}
+
+// result builds the Result of a request from the distance between the TAT and now, which is the
+// new TAT when the request was allowed and the unchanged one when it was refused.
+func result(policy Policy, allowed bool, ahead time.Duration) Result {
+	r := Result{Allowed: allowed, ResetAfter: ahead}
+	if !allowed {
+		r.RetryAfter = ahead + policy.interval() - policy.tolerance()
+		return r
+	}
+	r.Remaining = int((policy.tolerance() - ahead) / policy.interval())
+	return r
+}
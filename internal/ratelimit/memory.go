@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryLimiter drops the keys that are back to their full burst.
+const sweepInterval = time.Minute
+
+// MemoryLimiter keeps the TATs in process memory, so every instance limits on its own. It is used
+// while Redis is unavailable.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{tats: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, policy Policy, key string) Result {
+	return l.allow(time.Now(), policy, key)
+}
+
+func (l *MemoryLimiter) allow(now time.Time, policy Policy, key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	key = policy.Name + ":" + key
+	tat, ok := l.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(policy.interval())
+	if newTAT.Sub(now) > policy.tolerance() {
+		return result(policy, false, tat.Sub(now))
+	}
+	l.tats[key] = newTAT
+	return result(policy, true, newTAT.Sub(now))
+}
+
+// sweep removes the keys whose TAT has passed. They would start over with the full burst anyway,
+// so the map only holds the clients that made requests recently.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, tat := range l.tats {
+		if tat.Before(now) {
+			delete(l.tats, key)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// perSecond allows one request per second with a burst of three.
+var perSecond = Policy{Name: "test", Limit: 60, Period: time.Minute, Burst: 3}
+
+func TestMemoryLimiterAllow(t *testing.T) {
+	type request struct {
+		after time.Duration // since the first request
+		key   string
+		want  Result
+	}
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{
+			name: "burst then denied",
+			requests: []request{
+				{key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 1, ResetAfter: 2 * time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second}},
+				{key: "a", want: Result{Allowed: false, RetryAfter: time.Second, ResetAfter: 3 * time.Second}},
+			},
+		},
+		{
+			name: "retry after shrinks while waiting",
+			requests: []request{
+				{key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 1, ResetAfter: 2 * time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second}},
+				{after: 400 * time.Millisecond, key: "a", want: Result{Allowed: false, RetryAfter: 600 * time.Millisecond, ResetAfter: 2600 * time.Millisecond}},
+			},
+		},
+		{
+			name: "allowed again after retry after",
+			requests: []request{
+				{key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 1, ResetAfter: 2 * time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second}},
+				{after: time.Second, key: "a", want: Result{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second}},
+			},
+		},
+		{
+			name: "keys are independent",
+			requests: []request{
+				{key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 1, ResetAfter: 2 * time.Second}},
+				{key: "a", want: Result{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second}},
+				{key: "b", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+			},
+		},
+		{
+			name: "back to the full burst",
+			requests: []request{
+				{key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+				{after: time.Hour, key: "a", want: Result{Allowed: true, Remaining: 2, ResetAfter: time.Second}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryLimiter()
+			start := time.Now()
+			for i, r := range tt.requests {
+				got := l.allow(start.Add(r.after), perSecond, r.key)
+				if got != r.want {
+					t.Errorf("request %d: got %+v, want %+v", i, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Duration
+		// wantKeys are the keys kept after a request of "fresh" at after.
+		wantKeys []string
+	}{
+		{name: "before the sweep interval", after: sweepInterval - time.Second, wantKeys: []string{"test:stale", "test:busy", "test:fresh"}},
+		{name: "at the sweep interval", after: sweepInterval, wantKeys: []string{"test:busy", "test:fresh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryLimiter()
+			start := l.lastSweep
+			l.allow(start, perSecond, "stale")
+			// A client still inside its burst at the sweep, with its TAT ahead of it.
+			busy := Policy{Name: "test", Limit: 1, Period: 2 * sweepInterval, Burst: 1}
+			l.allow(start, busy, "busy")
+
+			l.allow(start.Add(tt.after), perSecond, "fresh")
+
+			if len(l.tats) != len(tt.wantKeys) {
+				t.Errorf("kept %d keys, want %v", len(l.tats), tt.wantKeys)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := l.tats[key]; !ok {
+					t.Errorf("%s was evicted", key)
+				}
+			}
+		})
+	}
+}
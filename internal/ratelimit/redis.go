@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisTimeout bounds the time a request waits for Redis before the fallback decides.
+	redisTimeout = 100 * time.Millisecond
+	// fallbackPeriod is how long the fallback is used after Redis failed, before Redis is tried again.
+	fallbackPeriod = 5 * time.Second
+)
+
+// gcraScript applies a request to the TAT stored in KEYS[1], in microseconds of the Redis clock so
+// that the instances need not agree on the time. ARGV are the interval and the tolerance in
+// microseconds. It returns whether the request is allowed and how far the TAT is ahead of now.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+if new_tat - now > tolerance then
+	return {0, tat - now}
+end
+-- Formatted explicitly, Lua would write large numbers in exponent notation.
+redis.call("SET", KEYS[1], string.format("%.0f", new_tat), "PX", math.ceil((new_tat - now) / 1000))
+return {1, new_tat - now}
+`)
+
+// RedisLimiter keeps the TATs in Redis, where they expire once they have passed. While Redis
+// fails, every instance limits on its own with the fallback.
+type RedisLimiter struct {
+	rdb      *redis.Client
+	fallback *MemoryLimiter
+	logger   *slog.Logger
+
+	mu            sync.Mutex
+	fallbackUntil time.Time
+}
+
+func NewRedisLimiter(rdb *redis.Client, logger *slog.Logger) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb, fallback: NewMemoryLimiter(), logger: logger}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, policy Policy, key string) Result {
+	l.mu.Lock()
+	usingFallback := time.Now().Before(l.fallbackUntil)
+	l.mu.Unlock()
+	if usingFallback {
+		return l.fallback.Allow(ctx, policy, key)
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	values, err := gcraScript.Run(redisCtx, l.rdb, []string{"ratelimit:" + policy.Name + ":" + key},
+		policy.interval().Microseconds(), policy.tolerance().Microseconds()).Int64Slice()
+	if err != nil {
+		// A client that went away says nothing about Redis, the others keep using it.
+		if ctx.Err() != nil {
+			return l.fallback.Allow(ctx, policy, key)
+		}
+		l.logger.ErrorContext(ctx, "rate limiter falls back to memory", "period", fallbackPeriod, "policy", policy.Name, "error", err)
+		l.mu.Lock()
+		l.fallbackUntil = time.Now().Add(fallbackPeriod)
+		l.mu.Unlock()
+		return l.fallback.Allow(ctx, policy, key)
+	}
+	return result(policy, values[0] == 1, time.Duration(values[1])*time.Microsecond)
+}
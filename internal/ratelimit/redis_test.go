@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisLimiterAllow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	l := NewRedisLimiter(rdb, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	for i := 0; i < perSecond.Burst; i++ {
+		if got := l.Allow(context.Background(), perSecond, "a"); !got.Allowed || got.Remaining != perSecond.Burst-1-i {
+			t.Fatalf("request %d: got %+v", i, got)
+		}
+	}
+	if got := l.Allow(context.Background(), perSecond, "a"); got.Allowed || got.RetryAfter <= 0 {
+		t.Errorf("request past the burst: got %+v", got)
+	}
+	if !mr.Exists("ratelimit:test:a") {
+		t.Error("the TAT is not stored in Redis")
+	}
+	if got := l.Allow(context.Background(), perSecond, "b"); !got.Allowed {
+		t.Errorf("other key: got %+v", got)
+	}
+}
+
+func TestRedisLimiterFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancel cancels the context of the request before it is made.
+		cancel bool
+		// down stops Redis before the request.
+		down         bool
+		wantFallback bool
+	}{
+		{name: "redis is up"},
+		{name: "redis is down", down: true, wantFallback: true},
+		{name: "client went away", cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+			defer rdb.Close()
+			var logs bytes.Buffer
+			l := NewRedisLimiter(rdb, slog.New(slog.NewTextHandler(&logs, nil)))
+
+			if tt.down {
+				mr.Close()
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+
+			if got := l.Allow(ctx, perSecond, "a"); !got.Allowed {
+				t.Errorf("got %+v, want the request allowed", got)
+			}
+
+			l.mu.Lock()
+			usingFallback := !l.fallbackUntil.IsZero()
+			l.mu.Unlock()
+			if usingFallback != tt.wantFallback {
+				t.Errorf("using the fallback = %v, want %v", usingFallback, tt.wantFallback)
+			}
+			if logged := strings.Contains(logs.String(), "rate limiter falls back to memory"); logged != tt.wantFallback {
+				t.Errorf("logged %q", logs.String())
+			}
+		})
+	}
+}
@@ -3,29 +3,271 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
 
 	"github.com/yusuf4ktas/backend-project/internal/domain"
 )
 
 type auditLogRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewAuditLogRepository(db *sql.DB) domain.AuditLogRepository {
+func NewAuditLogRepository(db DBTX) domain.AuditLogRepository {
 	return &auditLogRepository{db: db}
 }
 
 func (r *auditLogRepository) Create(ctx context.Context, log *domain.AuditLog) error {
-	query := `INSERT INTO audit_logs (entity_type, entity_id, action, details, created_at) VALUES (?, ?, ?, ?, ?)`
+	query := `INSERT INTO audit_logs (entity_type, entity_id, action, actor_type, actor_id, request_id, ip, user_agent, details, changes, created_at, prev_hash, hash, outbox_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := r.db.ExecContext(
+	result, err := r.db.ExecContext(
 		ctx,
 		query,
 		log.EntityType,
 		log.EntityID,
 		log.Action,
+		nullString(string(log.ActorType)),
+		log.ActorID,
+		nullString(log.RequestID),
+		nullString(log.IP),
+		nullString(log.UserAgent),
 		log.Details,
+		nullString(string(log.Changes)),
 		log.CreatedAt,
+		log.PrevHash,
+		log.Hash,
+		log.OutboxID,
 	)
+	if err != nil {
+		return err
+	}
+	log.ID, err = result.LastInsertId()
 	return err
 }
+
+// nullString stores empty optional values as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+const auditLogColumns = `id, entity_type, entity_id, action, actor_type, actor_id, request_id, ip, user_agent, details, changes, created_at, prev_hash, hash`
+
+func (r *auditLogRepository) List(ctx context.Context, filter domain.AuditLogFilter) ([]domain.AuditLog, error) {
+	where, args := auditLogConditions(filter)
+	if filter.Cursor != nil {
+		where = append(where, `id < ?`)
+		args = append(args, filter.Cursor.ID)
+	}
+
+	query := `SELECT ` + auditLogColumns + ` FROM audit_logs` + whereClause(where) + ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	logs := []domain.AuditLog{}
+	err := r.query(ctx, query, args, func(log *domain.AuditLog) error {
+		logs = append(logs, *log)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (r *auditLogRepository) ForEach(ctx context.Context, filter domain.AuditLogFilter, fn func(*domain.AuditLog) error) error {
+	where, args := auditLogConditions(filter)
+	query := `SELECT ` + auditLogColumns + ` FROM audit_logs` + whereClause(where) + ` ORDER BY id`
+	return r.query(ctx, query, args, fn)
+}
+
+func (r *auditLogRepository) query(ctx context.Context, query string, args []interface{}, fn func(*domain.AuditLog) error) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var log domain.AuditLog
+		var actorType, requestID, ip, userAgent, details, changes, prevHash, hash sql.NullString
+		var actorID sql.NullInt64
+		if err := rows.Scan(
+			&log.ID,
+			&log.EntityType,
+			&log.EntityID,
+			&log.Action,
+			&actorType,
+			&actorID,
+			&requestID,
+			&ip,
+			&userAgent,
+			&details,
+			&changes,
+			&log.CreatedAt,
+			&prevHash,
+			&hash,
+		); err != nil {
+			return err
+		}
+		log.ActorType = domain.PrincipalType(actorType.String)
+		if actorID.Valid {
+			log.ActorID = &actorID.Int64
+		}
+		log.RequestID = requestID.String
+		log.IP = ip.String
+		log.UserAgent = userAgent.String
+		log.Details = details.String
+		if changes.Valid {
+			log.Changes = json.RawMessage(changes.String)
+		}
+		log.PrevHash = prevHash.String
+		log.Hash = hash.String
+		if err := fn(&log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// auditLogConditions builds the WHERE conditions shared by List and ForEach. Every filter has a
+// matching index, see the add_audit_log_actor_and_indexes migration.
+func auditLogConditions(filter domain.AuditLogFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.EntityType != "" {
+		conditions = append(conditions, `entity_type = ?`)
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		conditions = append(conditions, `entity_id = ?`)
+		args = append(args, *filter.EntityID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, `action = ?`)
+		args = append(args, filter.Action)
+	}
+	if filter.ActorType != "" {
+		conditions = append(conditions, `actor_type = ?`)
+		args = append(args, filter.ActorType)
+	}
+	if filter.ActorID != nil {
+		conditions = append(conditions, `actor_id = ?`)
+		args = append(args, *filter.ActorID)
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, `request_id = ?`)
+		args = append(args, filter.RequestID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, *filter.To)
+	}
+	if query := fullTextQuery(filter.Query); query != "" {
+		conditions = append(conditions, `MATCH(details) AGAINST (? IN BOOLEAN MODE)`)
+		args = append(args, query)
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(conditions, ` AND `)
+}
+
+// fullTextQuery turns free text into a boolean mode query that requires every word, matching
+// words by prefix. Characters with a meaning in boolean mode are dropped so input is taken literally.
+func fullTextQuery(s string) string {
+	clean := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`+-<>()~*"@`, r) {
+			return ' '
+		}
+		return r
+	}, s)
+
+	words := strings.Fields(clean)
+	for i, word := range words {
+		words[i] = "+" + word + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+func (r *auditLogRepository) LockChainHead(ctx context.Context) (*domain.AuditChainHead, error) {
+	return r.chainHead(ctx, `SELECT last_entry_id, last_hash FROM audit_chain_head WHERE id = 1 FOR UPDATE`)
+}
+
+func (r *auditLogRepository) GetChainHead(ctx context.Context) (*domain.AuditChainHead, error) {
+	return r.chainHead(ctx, `SELECT last_entry_id, last_hash FROM audit_chain_head WHERE id = 1`)
+}
+
+func (r *auditLogRepository) chainHead(ctx context.Context, query string) (*domain.AuditChainHead, error) {
+	var head domain.AuditChainHead
+	var lastEntryID sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query).Scan(&lastEntryID, &head.LastHash); err != nil {
+		return nil, err
+	}
+	head.LastEntryID = lastEntryID.Int64
+	return &head, nil
+}
+
+func (r *auditLogRepository) UpdateChainHead(ctx context.Context, head *domain.AuditChainHead) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE audit_chain_head SET last_entry_id = ?, last_hash = ? WHERE id = 1`, head.LastEntryID, head.LastHash)
+	return err
+}
+
+func (r *auditLogRepository) CreateCheckpoint(ctx context.Context, checkpoint *domain.AuditCheckpoint) error {
+	query := `INSERT IGNORE INTO audit_checkpoints (entry_id, hash, signature, created_at) VALUES (?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, checkpoint.EntryID, checkpoint.Hash, checkpoint.Signature, checkpoint.CreatedAt)
+	return err
+}
+
+const auditCheckpointColumns = `id, entry_id, hash, signature, created_at`
+
+// LatestCheckpoint returns nil when no checkpoint has been made yet.
+func (r *auditLogRepository) LatestCheckpoint(ctx context.Context) (*domain.AuditCheckpoint, error) {
+	var c domain.AuditCheckpoint
+	err := r.db.QueryRowContext(ctx, `SELECT `+auditCheckpointColumns+` FROM audit_checkpoints ORDER BY entry_id DESC LIMIT 1`).
+		Scan(&c.ID, &c.EntryID, &c.Hash, &c.Signature, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *auditLogRepository) ListCheckpoints(ctx context.Context) ([]domain.AuditCheckpoint, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+auditCheckpointColumns+` FROM audit_checkpoints ORDER BY entry_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []domain.AuditCheckpoint{}
+	for rows.Next() {
+		var c domain.AuditCheckpoint
+		if err := rows.Scan(&c.ID, &c.EntryID, &c.Hash, &c.Signature, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func (r *auditLogRepository) ExistsForOutbox(ctx context.Context, outboxID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM audit_logs WHERE outbox_id = ?)`, outboxID).Scan(&exists)
+	return exists, err
+}
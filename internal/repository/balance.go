@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -36,7 +38,7 @@ func (r *balanceRepository) Create(ctx context.Context, balance *domain.Balance)
 		return err
 	}
 	key := fmt.Sprintf("balance:user:%d", balance.UserID)
-	r.rdb.Del(ctx, key)
+	invalidate(ctx, r.db, r.rdb, key)
 
 	return nil
 }
@@ -59,6 +61,9 @@ func (r *balanceRepository) GetByUserID(ctx context.Context, userID int64) (*dom
 	query := `SELECT user_id, amount, last_updated_at FROM balances WHERE user_id = ?;`
 	err = r.db.QueryRowContext(ctx, query, userID).Scan(&balance.UserID, &balance.Amount, &balance.LastUpdatedAt)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrBalanceNotFound
+		}
 		return nil, err
 	}
 
@@ -86,7 +91,7 @@ func (r *balanceRepository) Update(ctx context.Context, balance *domain.Balance)
 
 	// After a successful write, invalidating the cache.
 	key := fmt.Sprintf("balance:user:%d", balance.UserID)
-	r.rdb.Del(ctx, key)
+	invalidate(ctx, r.db, r.rdb, key)
 
 	return nil
 }
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"database/sql"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // DBTX to write repository methods that can work with either a normal database connection/database transaction for atomic operations.
@@ -11,3 +13,60 @@ type DBTX interface {
 	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
 	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
 }
+
+// Tx is a transaction that holds cache invalidation back until it commits. An entry deleted before
+// the commit can be cached again from the old row by a concurrent reader, and would then outlive
+// the change by its full TTL.
+type Tx struct {
+	*sql.Tx
+	afterCommit []func()
+}
+
+func BeginTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+// AfterCommit registers fn to run once the transaction has committed. It is dropped on rollback.
+func (tx *Tx) AfterCommit(fn func()) {
+	tx.afterCommit = append(tx.afterCommit, fn)
+}
+
+func (tx *Tx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+	hooks := tx.afterCommit
+	tx.afterCommit = nil
+	for _, fn := range hooks {
+		fn()
+	}
+	return nil
+}
+
+// invalidate deletes the cache keys, after the commit when db is a transaction.
+func invalidate(ctx context.Context, db DBTX, rdb *redis.Client, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	if tx, ok := db.(*Tx); ok {
+		// The request may be gone by the time the transaction commits.
+		ctx = context.WithoutCancel(ctx)
+		tx.AfterCommit(func() { rdb.Del(ctx, keys...) })
+		return
+	}
+	rdb.Del(ctx, keys...)
+}
+
+// SchemaVersion returns the number of the last migration golang-migrate applied and whether it
+// failed halfway, which leaves the schema dirty.
+func SchemaVersion(ctx context.Context, db DBTX) (version int64, dirty bool, err error) {
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1;`
+	if err := db.QueryRowContext(ctx, query).Scan(&version, &dirty); err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type emailVerificationRepository struct {
+	rdb *redis.Client
+}
+
+// Pending email changes are short-lived, so they are kept only in Redis.
+func NewEmailVerificationRepository(rdb *redis.Client) domain.EmailVerificationRepository {
+	return &emailVerificationRepository{rdb: rdb}
+}
+
+func (r *emailVerificationRepository) Create(ctx context.Context, v *domain.EmailVerification) error {
+	key := fmt.Sprintf("email_verification:%s", v.Token)
+
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, key, jsonData, time.Until(v.ExpiresAt)).Err()
+}
+
+func (r *emailVerificationRepository) Get(ctx context.Context, token string) (*domain.EmailVerification, error) {
+	key := fmt.Sprintf("email_verification:%s", token)
+	return decodeEmailVerification(r.rdb.Get(ctx, key).Result())
+}
+
+func (r *emailVerificationRepository) Consume(ctx context.Context, token string) (*domain.EmailVerification, error) {
+	key := fmt.Sprintf("email_verification:%s", token)
+	return decodeEmailVerification(r.rdb.GetDel(ctx, key).Result())
+}
+
+func decodeEmailVerification(data string, err error) (*domain.EmailVerification, error) {
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, domain.ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	var v domain.EmailVerification
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
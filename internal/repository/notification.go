@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type notificationRepository struct {
+	db DBTX
+}
+
+func NewNotificationRepository(db DBTX) domain.NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+func (r *notificationRepository) Create(ctx context.Context, n *domain.Notification) (bool, error) {
+	query := `INSERT IGNORE INTO notifications (user_id, type, title, body, event_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, n.UserID, n.Type, n.Title, n.Body, n.EventID, n.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+	n.ID, err = result.LastInsertId()
+	return err == nil, err
+}
+
+func (r *notificationRepository) List(ctx context.Context, filter domain.NotificationFilter) ([]domain.Notification, error) {
+	where := []string{`user_id = ?`}
+	args := []interface{}{filter.UserID}
+	if filter.UnreadOnly {
+		where = append(where, `read_at IS NULL`)
+	}
+	if filter.Cursor != nil {
+		where = append(where, `id < ?`)
+		args = append(args, filter.Cursor.ID)
+	}
+
+	query := `SELECT id, user_id, type, title, body, event_id, read_at, created_at FROM notifications` + whereClause(where) + ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []domain.Notification{}
+	for rows.Next() {
+		var n domain.Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Body, &n.EventID, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *notificationRepository) CountUnread(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *notificationRepository) MarkRead(ctx context.Context, userID, id int64, readAt time.Time) error {
+	// Reading a notification again keeps the time it was first read.
+	result, err := r.db.ExecContext(ctx, `UPDATE notifications SET read_at = COALESCE(read_at, ?) WHERE id = ? AND user_id = ?`, readAt, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// MySQL does not count rows that were matched but left unchanged.
+		var exists bool
+		err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ? AND user_id = ?)`, id, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return domain.ErrNotificationNotFound
+		}
+	}
+	return nil
+}
+
+func (r *notificationRepository) MarkAllRead(ctx context.Context, userID int64, readAt time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`, readAt, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *notificationRepository) GetEmailPreferences(ctx context.Context, userID int64) (map[domain.NotificationType]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT type, email FROM notification_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	email := make(map[domain.NotificationType]bool)
+	for rows.Next() {
+		var t domain.NotificationType
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		email[t] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return email, nil
+}
+
+func (r *notificationRepository) SetEmailPreferences(ctx context.Context, userID int64, email map[domain.NotificationType]bool) error {
+	if len(email) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(email))
+	args := make([]interface{}, 0, 3*len(email))
+	for t, enabled := range email {
+		values = append(values, `(?, ?, ?)`)
+		args = append(args, userID, t, enabled)
+	}
+	query := `INSERT INTO notification_preferences (user_id, type, email) VALUES ` + strings.Join(values, `, `) + `
+		ON DUPLICATE KEY UPDATE email = VALUES(email)`
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type outboxRepository struct {
+	db DBTX
+}
+
+// NewOutboxRepository should be given the transaction making the change the messages describe.
+func NewOutboxRepository(db DBTX) domain.OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Create(ctx context.Context, msg *domain.OutboxMessage) error {
+	query := `INSERT INTO outbox (topic, payload, status, attempts, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, msg.Topic, string(msg.Payload), msg.Status, msg.Attempts, msg.NextAttemptAt, msg.CreatedAt)
+	if err != nil {
+		return err
+	}
+	msg.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *outboxRepository) ClaimDue(ctx context.Context, now time.Time, limit int) ([]domain.OutboxMessage, error) {
+	query := `SELECT id, topic, payload, status, attempts, next_attempt_at, last_error, created_at
+		FROM outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED`
+
+	rows, err := r.db.QueryContext(ctx, query, domain.OutboxPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []domain.OutboxMessage{}
+	for rows.Next() {
+		var msg domain.OutboxMessage
+		var payload string
+		var lastError sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.Topic, &payload, &msg.Status, &msg.Attempts, &msg.NextAttemptAt, &lastError, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		msg.Payload = []byte(payload)
+		msg.LastError = lastError.String
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *outboxRepository) Lease(ctx context.Context, ids []int64, until time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := inClause(ids)
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET next_attempt_at = ? WHERE id `+in, append([]interface{}{until}, args...)...)
+	return err
+}
+
+func (r *outboxRepository) MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET status = ?, delivered_at = ?, last_error = NULL WHERE id = ?`, domain.OutboxDelivered, deliveredAt, id)
+	return err
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, msg *domain.OutboxMessage) error {
+	query := `UPDATE outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, msg.Status, msg.Attempts, msg.NextAttemptAt, msg.LastError, msg.ID)
+	return err
+}
+
+func (r *outboxRepository) CountPending(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox WHERE status = ?`, domain.OutboxPending).Scan(&count)
+	return count, err
+}
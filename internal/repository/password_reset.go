@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type passwordResetRepository struct {
+	rdb *redis.Client
+}
+
+// Password resets are short-lived, so they are kept only in Redis.
+func NewPasswordResetRepository(rdb *redis.Client) domain.PasswordResetRepository {
+	return &passwordResetRepository{rdb: rdb}
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, reset *domain.PasswordReset) error {
+	key := fmt.Sprintf("password_reset:%s", reset.Token)
+
+	jsonData, err := json.Marshal(reset)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, key, jsonData, time.Until(reset.ExpiresAt)).Err()
+}
+
+func (r *passwordResetRepository) Get(ctx context.Context, token string) (*domain.PasswordReset, error) {
+	key := fmt.Sprintf("password_reset:%s", token)
+	return decodePasswordReset(r.rdb.Get(ctx, key).Result())
+}
+
+func (r *passwordResetRepository) Consume(ctx context.Context, token string) (*domain.PasswordReset, error) {
+	key := fmt.Sprintf("password_reset:%s", token)
+	return decodePasswordReset(r.rdb.GetDel(ctx, key).Result())
+}
+
+func decodePasswordReset(data string, err error) (*domain.PasswordReset, error) {
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, domain.ErrInvalidResetToken
+		}
+		return nil, err
+	}
+
+	var reset domain.PasswordReset
+	if err := json.Unmarshal([]byte(data), &reset); err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
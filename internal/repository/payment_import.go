@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type paymentImportRepository struct {
+	rdb *redis.Client
+}
+
+func NewPaymentImportRepository(rdb *redis.Client) domain.PaymentImportRepository {
+	return &paymentImportRepository{rdb: rdb}
+}
+
+func (r *paymentImportRepository) ClaimMessageID(ctx context.Context, owner, msgID string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("payment_import:%s:%s", owner, msgID)
+	return r.rdb.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+}
+
+func (r *paymentImportRepository) ReleaseMessageID(ctx context.Context, owner, msgID string) error {
+	key := fmt.Sprintf("payment_import:%s:%s", owner, msgID)
+	return r.rdb.Del(ctx, key).Err()
+}
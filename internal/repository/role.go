@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// roleCacheTTL bounds how long a permission change takes to apply, wherever it was made. Roles are
+// read on every permission check, so even a short lifetime saves most queries.
+const roleCacheTTL = 30 * time.Second
+
+type roleRepository struct {
+	db  DBTX
+	rdb *redis.Client
+	// schemaVersion is part of the cache key, so permissions granted by a migration apply as soon
+	// as the instance is restarted on the new schema.
+	schemaVersion int64
+}
+
+func NewRoleRepository(db DBTX, rdb *redis.Client, schemaVersion int64) domain.RoleRepository {
+	return &roleRepository{
+		db:            db,
+		rdb:           rdb,
+		schemaVersion: schemaVersion,
+	}
+}
+
+func (r *roleRepository) GetByName(ctx context.Context, name string) (*domain.Role, error) {
+	key := fmt.Sprintf("role:%d:%s", r.schemaVersion, name)
+
+	cachedRole, err := r.rdb.Get(ctx, key).Result()
+	if err == nil {
+		var role domain.Role
+		if json.Unmarshal([]byte(cachedRole), &role) == nil {
+			return &role, nil
+		}
+	}
+
+	var role domain.Role
+	query := `SELECT name, description FROM roles WHERE name = ?;`
+	if err := r.db.QueryRowContext(ctx, query, name).Scan(&role.Name, &role.Description); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	query = `SELECT permission_name FROM role_permissions WHERE role_name = ? ORDER BY permission_name;`
+	rows, err := r.db.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	role.Permissions = []domain.Permission{}
+	for rows.Next() {
+		var perm domain.Permission
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		role.Permissions = append(role.Permissions, perm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	jsonData, _ := json.Marshal(&role)
+	r.rdb.Set(ctx, key, jsonData, roleCacheTTL)
+
+	return &role, nil
+}
+
+func (r *roleRepository) List(ctx context.Context) ([]domain.Role, error) {
+	query := `SELECT r.name, r.description, rp.permission_name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.name
+		ORDER BY r.name, rp.permission_name;`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []domain.Role
+	for rows.Next() {
+		var name, description string
+		var perm sql.NullString
+		if err := rows.Scan(&name, &description, &perm); err != nil {
+			return nil, err
+		}
+		// Rows are ordered by role, so a new name starts a new role.
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, domain.Role{Name: name, Description: description, Permissions: []domain.Permission{}})
+		}
+		if perm.Valid {
+			current := &roles[len(roles)-1]
+			current.Permissions = append(current.Permissions, domain.Permission(perm.String))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *roleRepository) ListPermissions(ctx context.Context) ([]domain.Permission, error) {
+	query := `SELECT name FROM permissions ORDER BY name;`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perms []domain.Permission
+	for rows.Next() {
+		var perm domain.Permission
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return perms, nil
+}
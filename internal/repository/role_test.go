@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+func expectRole(mock sqlmock.Sqlmock, name string, perms ...domain.Permission) {
+	mock.ExpectQuery("SELECT name, description FROM roles").WithArgs(name).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "description"}).AddRow(name, "Administrator"))
+	rows := sqlmock.NewRows([]string{"permission_name"})
+	for _, perm := range perms {
+		rows.AddRow(string(perm))
+	}
+	mock.ExpectQuery("SELECT permission_name FROM role_permissions").WithArgs(name).WillReturnRows(rows)
+}
+
+func TestRoleCache(t *testing.T) {
+	granted := []domain.Permission{"audit:read"}
+	changed := []domain.Permission{"audit:read", "system:diagnostics"}
+
+	tests := []struct {
+		name     string
+		cachedAt int64
+		readAt   int64
+		// elapsed is the time between the two lookups.
+		elapsed time.Duration
+		// reloaded reports whether the second lookup has to query the database.
+		reloaded bool
+		want     []domain.Permission
+	}{
+		{name: "same schema reads the cache", cachedAt: 15, readAt: 15, want: granted},
+		{name: "migration reloads the permissions", cachedAt: 15, readAt: 16, reloaded: true, want: changed},
+		{name: "change outside a migration is read within the TTL", cachedAt: 15, readAt: 15, elapsed: roleCacheTTL, reloaded: true, want: changed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			ctx := context.Background()
+
+			expectRole(mock, "admin", granted...)
+			if _, err := NewRoleRepository(db, rdb, tt.cachedAt).GetByName(ctx, "admin"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			mr.FastForward(tt.elapsed)
+			if tt.reloaded {
+				expectRole(mock, "admin", changed...)
+			}
+
+			role, err := NewRoleRepository(db, rdb, tt.readAt).GetByName(ctx, "admin")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(role.Permissions, tt.want) {
+				t.Errorf("permissions = %v, want %v", role.Permissions, tt.want)
+			}
+		})
+	}
+}
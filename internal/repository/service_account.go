@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type serviceAccountRepository struct {
+	db  DBTX
+	rdb *redis.Client
+}
+
+func NewServiceAccountRepository(db DBTX, rdb *redis.Client) domain.ServiceAccountRepository {
+	return &serviceAccountRepository{
+		db:  db,
+		rdb: rdb,
+	}
+}
+
+// Scopes are stored space separated, the same way OAuth2 transmits them.
+func joinScopes(scopes []domain.Permission) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+func splitScopes(s string) []domain.Permission {
+	scopes := []domain.Permission{}
+	for _, part := range strings.Fields(s) {
+		scopes = append(scopes, domain.Permission(part))
+	}
+	return scopes
+}
+
+func (r *serviceAccountRepository) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	query := `INSERT INTO service_accounts (name, client_id, client_secret_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?);`
+
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		account.Name,
+		account.ClientID,
+		account.ClientSecretHash,
+		joinScopes(account.Scopes),
+		account.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID after creating service account: %w", err)
+	}
+	account.ID = id
+
+	return nil
+}
+
+func (r *serviceAccountRepository) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	key := fmt.Sprintf("service_account:%d", id)
+
+	cachedAccount, err := r.rdb.Get(ctx, key).Result()
+	if err == nil {
+		var account domain.ServiceAccount
+		if json.Unmarshal([]byte(cachedAccount), &account) == nil {
+			return &account, nil
+		}
+	}
+
+	query := `SELECT id, name, client_id, client_secret_hash, scopes, created_at FROM service_accounts WHERE id = ?;`
+	account, err := scanServiceAccount(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, _ := json.Marshal(account)
+	// 1 hour lifespan in cache
+	r.rdb.Set(ctx, key, jsonData, 1*time.Hour)
+
+	return account, nil
+}
+
+func (r *serviceAccountRepository) GetByClientID(ctx context.Context, clientID string) (*domain.ServiceAccount, error) {
+	query := `SELECT id, name, client_id, client_secret_hash, scopes, created_at FROM service_accounts WHERE client_id = ?;`
+	return scanServiceAccount(r.db.QueryRowContext(ctx, query, clientID))
+}
+
+func scanServiceAccount(row *sql.Row) (*domain.ServiceAccount, error) {
+	var account domain.ServiceAccount
+	var scopes string
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.ClientID,
+		&account.ClientSecretHash,
+		&scopes,
+		&account.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrServiceAccountNotFound
+		}
+		return nil, err
+	}
+	account.Scopes = splitScopes(scopes)
+	return &account, nil
+}
+
+func (r *serviceAccountRepository) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	query := `SELECT id, name, client_id, scopes, created_at FROM service_accounts ORDER BY id;`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []domain.ServiceAccount{}
+	for rows.Next() {
+		var account domain.ServiceAccount
+		var scopes string
+		if err := rows.Scan(&account.ID, &account.Name, &account.ClientID, &scopes, &account.CreatedAt); err != nil {
+			return nil, err
+		}
+		account.Scopes = splitScopes(scopes)
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (r *serviceAccountRepository) CreateAPIKey(ctx context.Context, key *domain.APIKey) error {
+	query := `INSERT INTO api_keys (service_account_id, name, prefix, key_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?);`
+
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		key.ServiceAccountID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		joinScopes(key.Scopes),
+		key.ExpiresAt,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID after creating api key: %w", err)
+	}
+	key.ID = id
+
+	return nil
+}
+
+// API keys are not cached, so revocations take effect immediately.
+func (r *serviceAccountRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	query := `SELECT id, service_account_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at FROM api_keys WHERE prefix = ?;`
+
+	var key domain.APIKey
+	var scopes string
+	err := r.db.QueryRowContext(ctx, query, prefix).Scan(
+		&key.ID,
+		&key.ServiceAccountID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	key.Scopes = splitScopes(scopes)
+
+	return &key, nil
+}
+
+func (r *serviceAccountRepository) ListAPIKeys(ctx context.Context, serviceAccountID int64) ([]domain.APIKey, error) {
+	query := `SELECT id, service_account_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM api_keys WHERE service_account_id = ? ORDER BY id;`
+
+	rows, err := r.db.QueryContext(ctx, query, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		var key domain.APIKey
+		var scopes string
+		if err := rows.Scan(
+			&key.ID,
+			&key.ServiceAccountID,
+			&key.Name,
+			&key.Prefix,
+			&scopes,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+			&key.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		key.Scopes = splitScopes(scopes)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *serviceAccountRepository) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int64, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND service_account_id = ? AND revoked_at IS NULL;`
+
+	result, err := r.db.ExecContext(ctx, query, revokedAt, keyID, serviceAccountID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *serviceAccountRepository) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = ? WHERE id = ?;`
+	_, err := r.db.ExecContext(ctx, query, usedAt, keyID)
+	return err
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type sessionRepository struct {
+	db  DBTX
+	rdb *redis.Client
+}
+
+func NewSessionRepository(db DBTX, rdb *redis.Client) domain.SessionRepository {
+	return &sessionRepository{
+		db:  db,
+		rdb: rdb,
+	}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	query := `INSERT INTO sessions (id, user_id, device, user_agent, ip_address, created_at, last_seen_at, expires_at, impersonator_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.Device,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+		session.ImpersonatorID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetByID is called on every authenticated request, so sessions are cached.
+// Every write to a session invalidates its cache entry.
+func (r *sessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	key := fmt.Sprintf("session:%s", id)
+
+	cachedSession, err := r.rdb.Get(ctx, key).Result()
+	if err == nil {
+		var session domain.Session
+		if json.Unmarshal([]byte(cachedSession), &session) == nil {
+			return &session, nil
+		}
+	}
+
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?;`
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	jsonData, _ := json.Marshal(session)
+	// 15 minute lifespan in cache.
+	r.rdb.Set(ctx, key, jsonData, 15*time.Minute)
+
+	return session, nil
+}
+
+func (r *sessionRepository) ListActiveByUserID(ctx context.Context, userID int64, now time.Time) ([]domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = ? AND impersonator_id IS NULL AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC;`
+	return r.list(ctx, query, userID, now)
+}
+
+func (r *sessionRepository) ListActiveImpersonations(ctx context.Context, now time.Time) ([]domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE impersonator_id IS NOT NULL AND revoked_at IS NULL AND expires_at > ? ORDER BY created_at DESC;`
+	return r.list(ctx, query, now)
+}
+
+func (r *sessionRepository) list(ctx context.Context, query string, args ...interface{}) ([]domain.Session, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+const sessionColumns = `id, user_id, device, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, impersonator_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*domain.Session, error) {
+	var session domain.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.ImpersonatorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) Touch(ctx context.Context, id string, lastSeenAt time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = ? WHERE id = ?;`
+	if _, err := r.db.ExecContext(ctx, query, lastSeenAt, id); err != nil {
+		return err
+	}
+	invalidate(ctx, r.db, r.rdb, fmt.Sprintf("session:%s", id))
+	return nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, userID int64, id string, revokedAt time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL;`
+
+	result, err := r.db.ExecContext(ctx, query, revokedAt, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	invalidate(ctx, r.db, r.rdb, fmt.Sprintf("session:%s", id))
+	return nil
+}
+
+func (r *sessionRepository) RevokeAllExcept(ctx context.Context, userID int64, keepID string, revokedAt time.Time) error {
+	// The IDs are needed to invalidate the cache entries of the revoked sessions.
+	query := `SELECT id FROM sessions WHERE user_id = ? AND id <> ? AND revoked_at IS NULL;`
+	rows, err := r.db.QueryContext(ctx, query, userID, keepID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		keys = append(keys, fmt.Sprintf("session:%s", id))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL;`
+	if _, err := r.db.ExecContext(ctx, query, revokedAt, userID, keepID); err != nil {
+		return err
+	}
+
+	invalidate(ctx, r.db, r.rdb, keys...)
+	return nil
+}
+
+func (r *sessionRepository) CountDeviceSessions(ctx context.Context, userID int64, device string) (int, int, error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(device = ?), 0) FROM sessions WHERE user_id = ? AND impersonator_id IS NULL;`
+	var total, onDevice int
+	if err := r.db.QueryRowContext(ctx, query, device, userID).Scan(&total, &onDevice); err != nil {
+		return 0, 0, err
+	}
+	return total, onDevice, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type statementFileStore struct {
+	dir string
+}
+
+// NewStatementFileStore keeps statement files in dir, which every instance serving downloads has
+// to share. Files are streamed to disk as they are generated, however large the statement.
+func NewStatementFileStore(dir string) (domain.StatementFileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create statement directory: %w", err)
+	}
+	return &statementFileStore{dir: dir}, nil
+}
+
+// path rejects IDs that would leave the directory, job IDs are UUIDs.
+func (s *statementFileStore) path(id string) (string, error) {
+	if id == "" || filepath.Base(id) != id || id[0] == '.' {
+		return "", domain.ErrStatementJobNotFound
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+// Write generates the file under a temporary name and renames it once complete, so a reader never
+// sees a partial statement.
+func (s *statementFileStore) Write(ctx context.Context, id string, write func(w io.Writer) error) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, "."+id+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *statementFileStore) Open(ctx context.Context, id string) (io.ReadSeekCloser, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.ErrStatementJobNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *statementFileStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+func TestStatementFileStore(t *testing.T) {
+	failed := errors.New("statement failed")
+
+	tests := []struct {
+		name     string
+		id       string
+		write    func(w io.Writer) error
+		wantErr  error
+		wantFile string
+	}{
+		{
+			name:     "stored once written",
+			id:       "0b5e6f3c-8f3a-4f43-9a52-3c7c1d1e2f10",
+			write:    func(w io.Writer) error { _, err := io.WriteString(w, "date,amount\n"); return err },
+			wantFile: "date,amount\n",
+		},
+		{
+			name: "nothing stored when generation fails",
+			id:   "0b5e6f3c-8f3a-4f43-9a52-3c7c1d1e2f11",
+			write: func(w io.Writer) error {
+				io.WriteString(w, "date,amount\n")
+				return failed
+			},
+			wantErr: failed,
+		},
+		{
+			name:    "id leaving the directory",
+			id:      "../statement",
+			write:   func(w io.Writer) error { return nil },
+			wantErr: domain.ErrStatementJobNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := NewStatementFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			if err := store.Write(ctx, tt.id, tt.write); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			// Temporary files are gone either way, only a complete statement is left.
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantEntries := 0
+			if tt.wantFile != "" {
+				wantEntries = 1
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("directory holds %d files, want %d", len(entries), wantEntries)
+			}
+
+			file, err := store.Open(ctx, tt.id)
+			if tt.wantFile == "" {
+				if !errors.Is(err, domain.ErrStatementJobNotFound) {
+					t.Errorf("Open() err = %v, want %v", err, domain.ErrStatementJobNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil || string(data) != tt.wantFile {
+				t.Errorf("file holds %q (%v), want %q", data, err, tt.wantFile)
+			}
+
+			if err := store.Delete(ctx, tt.id); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Open(ctx, tt.id); !errors.Is(err, domain.ErrStatementJobNotFound) {
+				t.Errorf("deleted file still opens: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type statementJobRepository struct {
+	db DBTX
+}
+
+// Statement jobs are kept in the database, so that a job outlives the instance that accepted it
+// and any instance can pick it up or serve its download.
+func NewStatementJobRepository(db DBTX) domain.StatementJobRepository {
+	return &statementJobRepository{db: db}
+}
+
+const statementJobColumns = `id, user_id, period_from, period_to, format, status, error, created_at, completed_at, expires_at`
+
+func scanStatementJob(row interface{ Scan(...interface{}) error }) (*domain.StatementJob, error) {
+	var job domain.StatementJob
+	var jobError sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.From,
+		&job.To,
+		&job.Format,
+		&job.Status,
+		&jobError,
+		&job.CreatedAt,
+		&completedAt,
+		&job.ExpiresAt,
+	); err != nil {
+		return nil, err
+	}
+	job.Error = jobError.String
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
+
+func (r *statementJobRepository) Create(ctx context.Context, job *domain.StatementJob) error {
+	query := `INSERT INTO statement_jobs (id, user_id, period_from, period_to, format, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, job.ID, job.UserID, job.From, job.To, job.Format, job.Status, job.CreatedAt, job.ExpiresAt)
+	return err
+}
+
+func (r *statementJobRepository) Get(ctx context.Context, id string, now time.Time) (*domain.StatementJob, error) {
+	query := `SELECT ` + statementJobColumns + ` FROM statement_jobs WHERE id = ? AND expires_at > ?`
+	job, err := scanStatementJob(r.db.QueryRowContext(ctx, query, id, now))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrStatementJobNotFound
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *statementJobRepository) ClaimPending(ctx context.Context) (*domain.StatementJob, error) {
+	query := `SELECT ` + statementJobColumns + ` FROM statement_jobs WHERE status = ? ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+	job, err := scanStatementJob(r.db.QueryRowContext(ctx, query, domain.StatementJobPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+func (r *statementJobRepository) MarkRunning(ctx context.Context, id string, leaseUntil time.Time) error {
+	query := `UPDATE statement_jobs SET status = ?, lease_until = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, domain.StatementJobRunning, leaseUntil, id)
+	return err
+}
+
+func (r *statementJobRepository) RenewLease(ctx context.Context, id string, leaseUntil time.Time) error {
+	query := `UPDATE statement_jobs SET lease_until = ? WHERE id = ? AND status = ?`
+	_, err := r.db.ExecContext(ctx, query, leaseUntil, id, domain.StatementJobRunning)
+	return err
+}
+
+func (r *statementJobRepository) Finish(ctx context.Context, job *domain.StatementJob) error {
+	query := `UPDATE statement_jobs SET status = ?, error = ?, completed_at = ?, lease_until = NULL WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, job.Status, nullString(job.Error), job.CompletedAt, job.ID)
+	return err
+}
+
+func (r *statementJobRepository) FailAbandoned(ctx context.Context, now time.Time, reason string) (int64, error) {
+	query := `UPDATE statement_jobs SET status = ?, error = ?, completed_at = ?, lease_until = NULL WHERE status = ? AND lease_until <= ?`
+	result, err := r.db.ExecContext(ctx, query, domain.StatementJobFailed, reason, now, domain.StatementJobRunning, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *statementJobRepository) ListExpired(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM statement_jobs WHERE expires_at <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *statementJobRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM statement_jobs WHERE expires_at <= ?`, now)
+	return err
+}
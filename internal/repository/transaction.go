@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -22,10 +25,15 @@ func NewTransactionRepository(db DBTX, rdb *redis.Client) *transactionRepository
 	}
 }
 
+// Create inserts the transaction and sets its ID, so that events and audit entries written in
+// the same database transaction can refer to it.
 func (tr *transactionRepository) Create(ctx context.Context, tx *domain.Transaction) error {
 	query := `INSERT INTO transactions (from_user_id, to_user_id, amount, transaction_type, status, created_at) VALUES (?,?,?,?,?,?);`
 
-	_, err := tr.db.ExecContext(
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now()
+	}
+	result, err := tr.db.ExecContext(
 		ctx,
 		query,
 		tx.FromUserID,
@@ -33,21 +41,48 @@ func (tr *transactionRepository) Create(ctx context.Context, tx *domain.Transact
 		tx.Amount,
 		tx.TransactionType,
 		tx.Status,
-		time.Now(),
+		tx.CreatedAt,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	tx.ID = id
+	return nil
 }
 
-func (tr *transactionRepository) GetByUserID(ctx context.Context, userID int64) ([]domain.Transaction, error) {
-	query := `SELECT id, from_user_id, to_user_id, amount, transaction_type, status, created_at FROM transactions WHERE from_user_id = ? OR to_user_id = ?;`
+const transactionColumns = `id, from_user_id, to_user_id, amount, transaction_type, status, created_at`
+
+// List pages through a user's transactions newest first. Each direction is queried separately
+// so that both can use their (user, created_at, id) index, and the halves are merged with UNION ALL.
+func (tr *transactionRepository) List(ctx context.Context, filter domain.TransactionFilter) ([]domain.Transaction, error) {
+	limit := filter.Limit + 1
 
-	rows, err := tr.db.QueryContext(ctx, query, userID, userID)
+	var query string
+	var args []interface{}
+	switch filter.Direction {
+	case domain.DirectionOutgoing:
+		query, args = transactionBranch(filter, "from_user_id", "to_user_id", limit)
+	case domain.DirectionIncoming:
+		query, args = transactionBranch(filter, "to_user_id", "from_user_id", limit)
+	default:
+		outgoing, outgoingArgs := transactionBranch(filter, "from_user_id", "to_user_id", limit)
+		incoming, incomingArgs := transactionBranch(filter, "to_user_id", "from_user_id", limit)
+		query = `SELECT ` + transactionColumns + ` FROM ((` + outgoing + `) UNION ALL (` + incoming + `)) AS t
+			ORDER BY created_at DESC, id DESC LIMIT ?`
+		args = append(append(outgoingArgs, incomingArgs...), limit)
+	}
+
+	rows, err := tr.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var transactions []domain.Transaction
+	transactions := []domain.Transaction{}
 	for rows.Next() {
 		var tx domain.Transaction
 		if err := rows.Scan(
@@ -62,10 +97,106 @@ func (tr *transactionRepository) GetByUserID(ctx context.Context, userID int64)
 		}
 		transactions = append(transactions, tx)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return transactions, nil
 }
 
+// transactionBranch builds the query for one direction, where userColumn holds the filtered user
+// and counterpartyColumn the other side of the transaction.
+func transactionBranch(filter domain.TransactionFilter, userColumn, counterpartyColumn string, limit int) (string, []interface{}) {
+	conditions := []string{userColumn + ` = ?`}
+	args := []interface{}{filter.UserID}
+
+	if filter.CounterpartyID != nil {
+		conditions = append(conditions, counterpartyColumn+` = ?`)
+		args = append(args, *filter.CounterpartyID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, *filter.To)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, `transaction_type = ?`)
+		args = append(args, filter.Type)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, `status = ?`)
+		args = append(args, filter.Status)
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, `amount >= ?`)
+		args = append(args, *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, `amount <= ?`)
+		args = append(args, *filter.MaxAmount)
+	}
+	if filter.Cursor != nil {
+		conditions = append(conditions, `(created_at, id) < (?, ?)`)
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.ID)
+	}
+
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE ` + strings.Join(conditions, ` AND `) +
+		` ORDER BY created_at DESC, id DESC LIMIT ?`
+	return query, append(args, limit)
+}
+
+func (tr *transactionRepository) NetAmountBefore(ctx context.Context, userID int64, before time.Time) (float64, error) {
+	// Summing each direction separately keeps both halves on their (user, created_at, id) index.
+	query := `SELECT
+		(SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE to_user_id = ? AND status = ? AND created_at < ?) -
+		(SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE from_user_id = ? AND status = ? AND created_at < ?)`
+
+	var net float64
+	err := tr.db.QueryRowContext(ctx, query,
+		userID, domain.StatusCompleted, before,
+		userID, domain.StatusCompleted, before,
+	).Scan(&net)
+	return net, err
+}
+
+func (tr *transactionRepository) ForEachInRange(ctx context.Context, userID int64, from, to time.Time, fn func(*domain.Transaction) error) error {
+	query := `SELECT ` + transactionColumns + ` FROM (
+		(SELECT ` + transactionColumns + ` FROM transactions WHERE from_user_id = ? AND status = ? AND created_at >= ? AND created_at < ?)
+		UNION ALL
+		(SELECT ` + transactionColumns + ` FROM transactions WHERE to_user_id = ? AND status = ? AND created_at >= ? AND created_at < ?)
+	) AS t ORDER BY created_at, id`
+
+	rows, err := tr.db.QueryContext(ctx, query,
+		userID, domain.StatusCompleted, from, to,
+		userID, domain.StatusCompleted, from, to,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tx domain.Transaction
+		if err := rows.Scan(
+			&tx.ID,
+			&tx.FromUserID,
+			&tx.ToUserID,
+			&tx.Amount,
+			&tx.TransactionType,
+			&tx.Status,
+			&tx.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(&tx); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (tr *transactionRepository) GetByTransactionID(ctx context.Context, transactionID int64) (*domain.Transaction, error) {
 	key := fmt.Sprintf("transaction:%d", transactionID)
 
@@ -92,6 +223,9 @@ func (tr *transactionRepository) GetByTransactionID(ctx context.Context, transac
 		&transaction.CreatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrTransactionNotFound
+		}
 		return nil, err
 	}
 
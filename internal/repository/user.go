@@ -4,19 +4,32 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/redis/go-redis/v9"
 	"github.com/yusuf4ktas/backend-project/internal/domain"
 )
 
+// mysqlDuplicateEntry is the MySQL error number of a unique key violation.
+const mysqlDuplicateEntry = 1062
+
+// isDuplicateEntry reports whether err is a unique key violation. The email is the only unique
+// column of users besides the id.
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
 type userRepository struct {
-	db  *sql.DB
+	db  DBTX
 	rdb *redis.Client
 }
 
-func NewUserRepository(db *sql.DB, rdb *redis.Client) domain.UserRepository {
+func NewUserRepository(db DBTX, rdb *redis.Client) domain.UserRepository {
 	return &userRepository{
 		db:  db,
 		rdb: rdb,
@@ -37,6 +50,9 @@ func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 		user.UpdatedAt,
 	)
 	if err != nil {
+		if isDuplicateEntry(err) {
+			return domain.ErrDuplicateEmail
+		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
@@ -68,6 +84,9 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.
 		&user.UpdatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
 		return nil, err
 	}
 	return &user, nil
@@ -91,6 +110,9 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*domain.User, e
 		&user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
 		return nil, err
 	}
 
@@ -113,11 +135,25 @@ func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 		user.ID,
 	)
 	if err != nil {
+		if isDuplicateEntry(err) {
+			return domain.ErrDuplicateEmail
+		}
 		return err
 	}
 	// After a successful update, invalidate the cache
 	key := fmt.Sprintf("user:%d", user.ID)
-	r.rdb.Del(ctx, key)
+	invalidate(ctx, r.db, r.rdb, key)
+	return nil
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, userID int64, passwordHash string, updatedAt time.Time) error {
+	query := `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?;`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, updatedAt, userID)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("user:%d", userID)
+	invalidate(ctx, r.db, r.rdb, key)
 	return nil
 }
 
@@ -130,40 +166,93 @@ func (r *userRepository) Delete(ctx context.Context, id int64) error {
 	}
 	// After a successful delete, invalidate the cache
 	key := fmt.Sprintf("user:%d", id)
-	r.rdb.Del(ctx, key)
+	invalidate(ctx, r.db, r.rdb, key)
 	return err
 }
 
-func (r *userRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
-	query := `SELECT id, username, email, password_hash, role, created_at, updated_at FROM users;`
+// userSortColumns maps the sort fields accepted by the listing to their columns.
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"username":   "username",
+	"email":      "email",
+	"role":       "role",
+	"created_at": "created_at",
+}
 
-	rows, err := r.db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
+func (r *userRepository) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, int64, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		conditions = append(conditions, `(username LIKE ? OR email LIKE ?)`)
+		args = append(args, pattern, pattern)
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, `role = ?`)
+		args = append(args, filter.Role)
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, *filter.CreatedTo)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
 	}
-	defer rows.Close() // close the rows iterator.
 
-	var users []domain.User
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		column = "id"
+	}
+	order := "ASC"
+	if filter.SortDesc {
+		order = "DESC"
+	}
+	// id breaks ties so that pages stay stable when the sort column has duplicates.
+	query := `SELECT id, username, email, role, created_at, updated_at FROM users` + where +
+		` ORDER BY ` + column + ` ` + order + `, id ` + order + ` LIMIT ? OFFSET ?`
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
 
+	users := []domain.User{}
 	for rows.Next() {
 		var user domain.User
-		// For each row, scan the columns into a user struct.
 		if err := rows.Scan(
 			&user.ID,
 			&user.Username,
 			&user.Email,
-			&user.PasswordHash,
 			&user.Role,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		users = append(users, user)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return users, nil
+	return users, total, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input so that it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+type webhookRepository struct {
+	db DBTX
+}
+
+func NewWebhookRepository(db DBTX) domain.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+// inClause returns "IN (?, ?, ...)" for ids together with its arguments.
+func inClause(ids []int64) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return `IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)`, args
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, sub *domain.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (user_id, url, event_types, secret, created_at) VALUES (?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, sub.UserID, sub.URL, strings.Join(sub.EventTypes, " "), sub.Secret, sub.CreatedAt)
+	if err != nil {
+		return err
+	}
+	sub.ID, err = result.LastInsertId()
+	return err
+}
+
+const webhookSubscriptionColumns = `id, user_id, url, event_types, secret, consecutive_failures, circuit_open_until, created_at`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }) (*domain.WebhookSubscription, error) {
+	var sub domain.WebhookSubscription
+	var eventTypes string
+	var circuitOpenUntil sql.NullTime
+	if err := row.Scan(&sub.ID, &sub.UserID, &sub.URL, &eventTypes, &sub.Secret, &sub.ConsecutiveFailures, &circuitOpenUntil, &sub.CreatedAt); err != nil {
+		return nil, err
+	}
+	sub.EventTypes = strings.Fields(eventTypes)
+	if circuitOpenUntil.Valid {
+		sub.CircuitOpenUntil = &circuitOpenUntil.Time
+	}
+	return &sub, nil
+}
+
+func (r *webhookRepository) GetSubscription(ctx context.Context, userID, id int64) (*domain.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = ? AND user_id = ?`
+	sub, err := scanWebhookSubscription(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context, userID int64) ([]domain.WebhookSubscription, error) {
+	return r.listSubscriptions(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE user_id = ? ORDER BY id`, userID)
+}
+
+func (r *webhookRepository) ListSubscriptionsForUsers(ctx context.Context, userIDs []int64) ([]domain.WebhookSubscription, error) {
+	if len(userIDs) == 0 {
+		return []domain.WebhookSubscription{}, nil
+	}
+	in, args := inClause(userIDs)
+	return r.listSubscriptions(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE user_id `+in+` ORDER BY id`, args...)
+}
+
+func (r *webhookRepository) GetSubscriptionsByID(ctx context.Context, ids []int64) (map[int64]*domain.WebhookSubscription, error) {
+	subs := make(map[int64]*domain.WebhookSubscription, len(ids))
+	if len(ids) == 0 {
+		return subs, nil
+	}
+	in, args := inClause(ids)
+	list, err := r.listSubscriptions(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id `+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		subs[list[i].ID] = &list[i]
+	}
+	return subs, nil
+}
+
+func (r *webhookRepository) listSubscriptions(ctx context.Context, query string, args ...interface{}) ([]domain.WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []domain.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `INSERT IGNORE INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		delivery.SubscriptionID,
+		delivery.EventID,
+		delivery.EventType,
+		string(delivery.Payload),
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	delivery.ID, err = result.LastInsertId()
+	return err
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	var payload string
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+	if err := row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&lastStatusCode,
+		&lastError,
+		&d.CreatedAt,
+		&deliveredAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	d.LastStatusCode = int(lastStatusCode.Int64)
+	d.LastError = lastError.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func (r *webhookRepository) GetDelivery(ctx context.Context, subscriptionID, id int64) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ? AND subscription_id = ?`
+	d, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, id, subscriptionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) ([]domain.WebhookDelivery, error) {
+	where := []string{`subscription_id = ?`}
+	args := []interface{}{filter.SubscriptionID}
+	if filter.Status != "" {
+		where = append(where, `status = ?`)
+		args = append(args, filter.Status)
+	}
+	if filter.Cursor != nil {
+		where = append(where, `id < ?`)
+		args = append(args, filter.Cursor.ID)
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries` + whereClause(where) + ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
+	return r.listDeliveries(ctx, query, args...)
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	query := `SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND (s.circuit_open_until IS NULL OR s.circuit_open_until <= ?)
+			AND (s.probe_in_flight_until IS NULL OR s.probe_in_flight_until <= ?)
+		ORDER BY d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED`
+	return r.listDeliveries(ctx, query, domain.WebhookDeliveryPending, now, now, now, limit)
+}
+
+func (r *webhookRepository) ClaimProbe(ctx context.Context, subscriptionID int64, now, until time.Time) (bool, error) {
+	// The row lock taken by the update makes a concurrent claim wait and then see this one.
+	query := `UPDATE webhook_subscriptions SET probe_in_flight_until = ?
+		WHERE id = ? AND (probe_in_flight_until IS NULL OR probe_in_flight_until <= ?)`
+	result, err := r.db.ExecContext(ctx, query, until, subscriptionID, now)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *webhookRepository) listDeliveries(ctx context.Context, query string, args ...interface{}) ([]domain.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepository) LeaseDeliveries(ctx context.Context, ids []int64, until time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := inClause(ids)
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id `+in, append([]interface{}{until}, args...)...)
+	return err
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, delivered_at = ? WHERE id = ?`
+	var lastStatusCode sql.NullInt64
+	if d.LastStatusCode != 0 {
+		lastStatusCode = sql.NullInt64{Int64: int64(d.LastStatusCode), Valid: true}
+	}
+	_, err := r.db.ExecContext(ctx, query, d.Status, d.Attempts, d.NextAttemptAt, lastStatusCode, nullString(d.LastError), d.DeliveredAt, d.ID)
+	return err
+}
+
+func (r *webhookRepository) RecordEndpointSuccess(ctx context.Context, subscriptionID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_subscriptions SET consecutive_failures = 0, circuit_open_until = NULL, probe_in_flight_until = NULL WHERE id = ?`, subscriptionID)
+	return err
+}
+
+func (r *webhookRepository) RecordEndpointFailure(ctx context.Context, subscriptionID int64, threshold int, openUntil time.Time) error {
+	// MySQL assigns from left to right, the condition sees the incremented count.
+	query := `UPDATE webhook_subscriptions
+		SET consecutive_failures = consecutive_failures + 1,
+			circuit_open_until = IF(consecutive_failures >= ?, ?, circuit_open_until),
+			probe_in_flight_until = NULL
+		WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, threshold, openUntil, subscriptionID)
+	return err
+}
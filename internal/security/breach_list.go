@@ -0,0 +1,72 @@
+package security
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Length of the hash prefix used to bucket the list, the same as the Pwned Passwords range API.
+const hashPrefixLength = 5
+
+// BreachList is an offline list of SHA-1 hashes of breached passwords, bucketed by hash prefix
+// in the same k-anonymity layout as the Pwned Passwords range API.
+type BreachList struct {
+	buckets map[string]map[string]struct{}
+}
+
+// LoadBreachList reads a file with one uppercase or lowercase SHA-1 hex hash per line,
+// optionally followed by ":<count>" as in the Pwned Passwords downloads. Empty lines and
+// lines starting with '#' are ignored.
+func LoadBreachList(path string) (*BreachList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	list := &BreachList{buckets: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid hash on line %d of breached password list", lineNumber)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("invalid hash on line %d of breached password list", lineNumber)
+		}
+
+		prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+		if list.buckets[prefix] == nil {
+			list.buckets[prefix] = make(map[string]struct{})
+		}
+		list.buckets[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return list, nil
+}
+
+func (l *BreachList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	bucket, ok := l.buckets[hash[:hashPrefixLength]]
+	if !ok {
+		return false, nil
+	}
+	_, found := bucket[hash[hashPrefixLength:]]
+	return found, nil
+}
@@ -0,0 +1,71 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SHA-1 of "password" and of "letmein".
+const (
+	passwordSHA1 = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	letmeinSHA1  = "B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3"
+)
+
+func writeBreachList(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breaches.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachList(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		password string
+		want     bool
+		wantErr  string
+	}{
+		{name: "listed", lines: []string{passwordSHA1}, password: "password", want: true},
+		{name: "lowercase hash with count", lines: []string{strings.ToLower(passwordSHA1) + ":3861493"}, password: "password", want: true},
+		{name: "comments and empty lines", lines: []string{"# Pwned Passwords", "", "  " + letmeinSHA1 + "  ", passwordSHA1}, password: "letmein", want: true},
+		{name: "prefix matches, suffix does not", lines: []string{passwordSHA1[:hashPrefixLength] + strings.Repeat("0", len(passwordSHA1)-hashPrefixLength)}, password: "password"},
+		{name: "prefix does not match", lines: []string{letmeinSHA1}, password: "password"},
+		{name: "empty list", lines: nil, password: "password"},
+		{name: "short hash", lines: []string{passwordSHA1, passwordSHA1[:39]}, wantErr: "line 2"},
+		{name: "not hex", lines: []string{"# list", strings.Repeat("Z", 40)}, wantErr: "line 2"},
+		{name: "count only", lines: []string{":12"}, wantErr: "line 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := LoadBreachList(writeBreachList(t, tt.lines...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want an error on %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := list.IsBreached(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBreachListMissingFile(t *testing.T) {
+	if _, err := LoadBreachList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,203 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into self-describing strings that start with an algorithm prefix,
+// such as "$2a$" for bcrypt or "$argon2id$" for argon2id.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches a hash produced by this hasher.
+	Verify(password, hash string) (bool, error)
+	// Supports reports whether the hash carries this hasher's algorithm prefix.
+	Supports(hash string) bool
+	// NeedsRehash reports whether the hash should be replaced by one using the current algorithm and parameters.
+	NeedsRehash(hash string) bool
+}
+
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      memory,
+		Iterations:  iterations,
+		Parallelism: parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func decodeArgon2id(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnsupportedHash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	return &p, nil
+}
+
+func (h *Argon2idHasher) Verify(password, hash string) (bool, error) {
+	p, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	// The stored parameters are used, so hashes made with older settings still verify.
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *Argon2idHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory ||
+		p.iterations != h.Iterations ||
+		p.parallelism != h.Parallelism ||
+		uint32(len(p.salt)) != h.SaltLength ||
+		uint32(len(p.key)) != h.KeyLength
+}
+
+// multiHasher hashes with the current hasher and still verifies hashes of the legacy ones,
+// so existing users can log in and be upgraded after a configuration change.
+type multiHasher struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+func NewPasswordHasher(current PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &multiHasher{current: current, legacy: legacy}
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *multiHasher) Verify(password, hash string) (bool, error) {
+	if h.current.Supports(hash) {
+		return h.current.Verify(password, hash)
+	}
+	for _, hasher := range h.legacy {
+		if hasher.Supports(hash) {
+			return hasher.Verify(password, hash)
+		}
+	}
+	return false, ErrUnsupportedHash
+}
+
+func (h *multiHasher) Supports(hash string) bool {
+	if h.current.Supports(hash) {
+		return true
+	}
+	for _, hasher := range h.legacy {
+		if hasher.Supports(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *multiHasher) NeedsRehash(hash string) bool {
+	return !h.current.Supports(hash) || h.current.NeedsRehash(hash)
+}
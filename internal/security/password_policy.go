@@ -0,0 +1,139 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// BcryptMaxLength is the number of bytes bcrypt actually uses, anything longer is silently ignored.
+const BcryptMaxLength = 72
+
+// Violation codes are stable so that clients can map them to their own messages.
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationMissingUpper  = "missing_uppercase"
+	ViolationMissingLower  = "missing_lowercase"
+	ViolationMissingDigit  = "missing_digit"
+	ViolationMissingSymbol = "missing_symbol"
+	ViolationPersonalInfo  = "contains_personal_info"
+	ViolationBreached      = "breached"
+	ViolationCheckFailed   = "check_failed"
+)
+
+// Banned values shorter than this are ignored, they would reject too many legitimate passwords.
+const minBannedSubstringRunes = 3
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke, not just the first one.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// BreachChecker reports whether a password appears in a list of known breached passwords.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Breaches is optional, no breach check is done when it is nil.
+	Breaches BreachChecker
+}
+
+// Check validates the password against the policy. The banned values (such as the username
+// and email) must not appear in the password, ignoring case.
+func (p *PasswordPolicy) Check(password string, banned ...string) error {
+	var violations []Violation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, Violation{Code: ViolationTooShort, Message: fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, Violation{Code: ViolationTooLong, Message: fmt.Sprintf("password must be at most %d bytes", p.MaxLength)})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, Violation{Code: ViolationMissingUpper, Message: "password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, Violation{Code: ViolationMissingLower, Message: "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Code: ViolationMissingDigit, Message: "password must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Code: ViolationMissingSymbol, Message: "password must contain a symbol"})
+	}
+
+	lowered := strings.ToLower(password)
+	for _, value := range bannedSubstrings(banned) {
+		if strings.Contains(lowered, value) {
+			violations = append(violations, Violation{Code: ViolationPersonalInfo, Message: "password must not contain your username or email address"})
+			break
+		}
+	}
+
+	if p.Breaches != nil {
+		breached, err := p.Breaches.IsBreached(password)
+		if err != nil {
+			violations = append(violations, Violation{Code: ViolationCheckFailed, Message: "password could not be checked against the breached password list"})
+		} else if breached {
+			violations = append(violations, Violation{Code: ViolationBreached, Message: "password appears in a list of breached passwords"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// bannedSubstrings lowercases the banned values and also bans the local part of email addresses.
+func bannedSubstrings(banned []string) []string {
+	var values []string
+	for _, value := range banned {
+		value = strings.ToLower(strings.TrimSpace(value))
+		candidates := []string{value}
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			if len([]rune(candidate)) >= minBannedSubstringRunes {
+				values = append(values, candidate)
+			}
+		}
+	}
+	return values
+}
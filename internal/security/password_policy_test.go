@@ -0,0 +1,85 @@
+package security
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// breachChecker reports every password as breached, or fails with err.
+type breachChecker struct {
+	breached bool
+	err      error
+}
+
+func (c breachChecker) IsBreached(password string) (bool, error) {
+	return c.breached, c.err
+}
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want a *PolicyError", err)
+	}
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	lengthOnly := PasswordPolicy{MinLength: 8, MaxLength: BcryptMaxLength}
+	classes := PasswordPolicy{MinLength: 8, MaxLength: BcryptMaxLength, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		banned   []string
+		want     []string
+	}{
+		{name: "at the min length", policy: lengthOnly, password: "abcdefgh"},
+		{name: "one under the min length", policy: lengthOnly, password: "abcdefg", want: []string{ViolationTooShort}},
+		{name: "at the max byte length", policy: lengthOnly, password: strings.Repeat("a", BcryptMaxLength)},
+		{name: "one over the max byte length", policy: lengthOnly, password: strings.Repeat("a", BcryptMaxLength+1), want: []string{ViolationTooLong}},
+		{name: "multibyte at the max byte length", policy: lengthOnly, password: strings.Repeat("ü", BcryptMaxLength/2)},
+		{name: "multibyte over the max byte length in fewer characters", policy: lengthOnly, password: strings.Repeat("ü", BcryptMaxLength/2) + "a", want: []string{ViolationTooLong}},
+		{name: "min length counts characters, not bytes", policy: lengthOnly, password: "üüüüüüü", want: []string{ViolationTooShort}},
+		{name: "empty", policy: lengthOnly, password: "", want: []string{ViolationTooShort}},
+
+		{name: "every class", policy: classes, password: "Correct-Horse-1"},
+		{name: "missing uppercase", policy: classes, password: "correct-horse-1", want: []string{ViolationMissingUpper}},
+		{name: "missing lowercase", policy: classes, password: "CORRECT-HORSE-1", want: []string{ViolationMissingLower}},
+		{name: "missing digit", policy: classes, password: "Correct-Horse-X", want: []string{ViolationMissingDigit}},
+		{name: "missing symbol", policy: classes, password: "CorrectHorse1", want: []string{ViolationMissingSymbol}},
+		{name: "space is a symbol", policy: classes, password: "Correct Horse 1"},
+		{name: "non-ascii letters count", policy: classes, password: "Ünïcödé-1"},
+		{name: "every violation is listed", policy: classes, password: "abc", want: []string{ViolationTooShort, ViolationMissingUpper, ViolationMissingDigit, ViolationMissingSymbol}},
+
+		{name: "username", policy: lengthOnly, password: "i am alice!", banned: []string{"alice"}, want: []string{ViolationPersonalInfo}},
+		{name: "username in another case", policy: lengthOnly, password: "i am ALICE!", banned: []string{"Alice"}, want: []string{ViolationPersonalInfo}},
+		{name: "email", policy: lengthOnly, password: "x-bob@example.com-x", banned: []string{"Bob@Example.com"}, want: []string{ViolationPersonalInfo}},
+		{name: "local part of the email", policy: lengthOnly, password: "hello BOB.SMITH", banned: []string{"bob.smith@example.com"}, want: []string{ViolationPersonalInfo}},
+		{name: "short banned values are ignored", policy: lengthOnly, password: "always aligned", banned: []string{"al", "al@example.com"}},
+		{name: "personal info is reported once", policy: lengthOnly, password: "alice alice@example.com", banned: []string{"alice", "alice@example.com"}, want: []string{ViolationPersonalInfo}},
+
+		{name: "breached", policy: PasswordPolicy{MinLength: 8, MaxLength: BcryptMaxLength, Breaches: breachChecker{breached: true}}, password: "password1", want: []string{ViolationBreached}},
+		{name: "breach check fails", policy: PasswordPolicy{MinLength: 8, MaxLength: BcryptMaxLength, Breaches: breachChecker{err: errors.New("disk")}}, password: "password1", want: []string{ViolationCheckFailed}},
+		{name: "not breached", policy: PasswordPolicy{MinLength: 8, MaxLength: BcryptMaxLength, Breaches: breachChecker{}}, password: "password1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationCodes(t, tt.policy.Check(tt.password, tt.banned...))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) violations = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
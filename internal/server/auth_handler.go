@@ -2,28 +2,81 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
 	"github.com/yusuf4ktas/backend-project/internal/service"
 )
 
+// Value of the "mode" claim of impersonation tokens that allow writes, any other value is read-only.
+const impersonationReadWrite = "read_write"
+
+// Access tokens from the client_credentials grant are short-lived, clients simply request a new one.
+const serviceTokenTTL = time.Hour
+
 type AuthHandler struct {
-	userService service.UserService
-	jwtSecret   []byte
+	userService           service.UserService
+	sessionService        service.SessionService
+	serviceAccountService service.ServiceAccountService
+	jwtSecret             []byte
 }
 
-func NewAuthHandler(us service.UserService, secret []byte) *AuthHandler {
+func NewAuthHandler(us service.UserService, ss service.SessionService, sas service.ServiceAccountService, secret []byte) *AuthHandler {
 	return &AuthHandler{
-		userService: us,
-		jwtSecret:   secret,
+		userService:           us,
+		sessionService:        ss,
+		serviceAccountService: sas,
+		jwtSecret:             secret,
 	}
 }
 
 type loginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Device is an optional human readable name shown in the session list, defaults to the user agent.
+	Device string `json:"device"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type impersonateRequest struct {
+	UserID int64  `json:"user_id"`
+	Reason string `json:"reason"`
+	// AllowWrites must be set explicitly, impersonation is read-only by default.
+	AllowWrites bool `json:"allow_writes"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type confirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// User tokens are bound to a session and expire together with it.
+func (h *AuthHandler) generateToken(userID int64, sessionID string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"typ": string(domain.PrincipalUser),
+		"exp": time.Now().Add(service.SessionTTL).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(h.jwtSecret)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) *apiError {
@@ -32,21 +85,24 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) *apiError {
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
 	}
 
+	// Unknown emails and wrong passwords get the same answer, so that logins cannot be used to
+	// find out which emails are registered.
 	user, err := h.userService.Login(r.Context(), req.Email, req.Password)
+	if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrIncorrectPassword) {
+		return &apiError{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: "Invalid email or password"}
+	}
 	if err != nil {
-		return &apiError{Status: http.StatusUnauthorized, Message: "Invalid email or password"}
+		return errorResponse(err, "Failed to log in")
 	}
 
-	// JWT generation
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(time.Hour * 72).Unix(), //Token expire time is set to 72 hours, can be adjusted
-		"iat": time.Now().Unix(),
+	session, err := h.sessionService.Create(r.Context(), user.ID, req.Device, r.UserAgent(), clientIP(r))
+	if err != nil {
+		return errorResponse(err, "Failed to create session")
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(h.jwtSecret)
+
+	tokenString, err := h.generateToken(user.ID, session.ID)
 	if err != nil {
-		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to generate token"}
+		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to generate token", Err: err}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -56,3 +112,211 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) *apiError {
 	})
 	return nil
 }
+
+// ChangePassword keeps the current session and revokes every other session of the user.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) *apiError {
+	principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Principal not found in context"}
+	}
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	if err := h.userService.ChangePassword(r.Context(), principal.ID, principal.SessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		return errorResponse(err, "Failed to change password")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// RequestPasswordReset always answers 202 so that it cannot be used to probe for registered emails.
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) *apiError {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	if err := h.userService.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		return errorResponse(err, "Failed to request password reset")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the email is registered, a reset token has been sent."})
+	return nil
+}
+
+func (h *AuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) *apiError {
+	var req confirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	if err := h.userService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		return errorResponse(err, "Failed to reset password")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) *apiError {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	user, err := h.userService.ConfirmEmailChange(r.Context(), req.Token)
+	if err != nil {
+		return errorResponse(err, "Failed to verify email")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+	return nil
+}
+
+func (h *AuthHandler) generateServiceToken(accountID int64, scopes []domain.Permission) (string, error) {
+	scopeStrings := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeStrings[i] = string(scope)
+	}
+	claims := jwt.MapClaims{
+		"sub":   accountID,
+		"typ":   string(domain.PrincipalService),
+		"scope": strings.Join(scopeStrings, " "),
+		"exp":   time.Now().Add(serviceTokenTTL).Unix(),
+		"iat":   time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(h.jwtSecret)
+}
+
+// writeOAuthError writes an error response in the format required by RFC 6749 section 5.2.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// Token implements the OAuth2 client_credentials grant for service accounts.
+// Client credentials are accepted through HTTP Basic authentication or the form body.
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) *apiError {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return nil
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+		return nil
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client credentials are required")
+		return nil
+	}
+
+	var requested []domain.Permission
+	for _, scope := range strings.Fields(r.PostForm.Get("scope")) {
+		requested = append(requested, domain.Permission(scope))
+	}
+
+	account, granted, err := h.serviceAccountService.AuthenticateClient(r.Context(), clientID, clientSecret, requested)
+	switch {
+	case errors.Is(err, domain.ErrUnknownScope):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return nil
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		return nil
+	case err != nil:
+		return errorResponse(err, "Failed to authenticate client")
+	}
+
+	tokenString, err := h.generateServiceToken(account.ID, granted)
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to generate token", Err: err}
+	}
+
+	scopeStrings := make([]string, len(granted))
+	for i, scope := range granted {
+		scopeStrings[i] = string(scope)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": tokenString,
+		"token_type":   "Bearer",
+		"expires_in":   int(serviceTokenTTL.Seconds()),
+		"scope":        strings.Join(scopeStrings, " "),
+	})
+	return nil
+}
+
+func (h *AuthHandler) generateImpersonationToken(actorID int64, session *domain.Session, readOnly bool) (string, error) {
+	mode := "read_only"
+	if !readOnly {
+		mode = impersonationReadWrite
+	}
+	claims := jwt.MapClaims{
+		"sub":  session.UserID,
+		"sid":  session.ID,
+		"typ":  string(domain.PrincipalUser),
+		"act":  map[string]interface{}{"sub": actorID},
+		"mode": mode,
+		"exp":  session.ExpiresAt.Unix(),
+		"iat":  time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(h.jwtSecret)
+}
+
+// Impersonate issues a short-lived token that lets an admin act as another user.
+func (h *AuthHandler) Impersonate(w http.ResponseWriter, r *http.Request) *apiError {
+	actorID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	var req impersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	readOnly := !req.AllowWrites
+	session, err := h.sessionService.StartImpersonation(r.Context(), actorID, req.UserID, req.Reason, readOnly, r.UserAgent(), clientIP(r))
+	if err != nil {
+		return errorResponse(err, "Failed to start impersonation")
+	}
+
+	tokenString, err := h.generateImpersonationToken(actorID, session, readOnly)
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to generate token", Err: err}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      tokenString,
+		"session_id": session.ID,
+		"expires_at": session.ExpiresAt,
+		"read_only":  readOnly,
+	})
+	return nil
+}
@@ -1,9 +1,7 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/yusuf4ktas/backend-project/internal/service"
@@ -27,10 +25,7 @@ func (h *BalanceHandler) GetCurrentBalance(w http.ResponseWriter, r *http.Reques
 	//Call the service to get the current balance.
 	balance, err := h.balanceService.GetCurrent(r.Context(), userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &apiError{Status: http.StatusNotFound, Message: "Balance for user not found"}
-		}
-		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to retrieve balance"}
+		return errorResponse(err, "Failed to retrieve balance")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
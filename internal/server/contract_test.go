@@ -0,0 +1,884 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/config"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/iso20022"
+	"github.com/yusuf4ktas/backend-project/internal/ratelimit"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+	"github.com/yusuf4ktas/backend-project/internal/worker"
+)
+
+const (
+	contractSecret    = "contract-test-secret"
+	contractUserID    = 1
+	contractSessionID = "session-1"
+	contractAccountID = 7
+)
+
+var fixtureTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakes backs the fake services of the contract test. A method fails with errs[method] or, when
+// it is set, with failAll. Authentication itself never fails.
+type fakes struct {
+	errs       map[string]error
+	failAll    error
+	jobPending bool
+	// impersonatorID makes the session an impersonation by that user.
+	impersonatorID int64
+}
+
+func (f *fakes) err(method string) error {
+	if err := f.errs[method]; err != nil {
+		return err
+	}
+	return f.failAll
+}
+
+func fixtureUser() *domain.User {
+	return &domain.User{ID: contractUserID, Username: "alice", Email: "alice@example.com", Role: "admin", CreatedAt: fixtureTime, UpdatedAt: fixtureTime}
+}
+
+func fixtureSession() *domain.Session {
+	return &domain.Session{
+		ID: contractSessionID, UserID: contractUserID, Device: "laptop", UserAgent: "test", IPAddress: "192.0.2.1",
+		CreatedAt: fixtureTime, LastSeenAt: fixtureTime, ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func fixtureTransaction() *domain.Transaction {
+	return &domain.Transaction{ID: 42, FromUserID: contractUserID, ToUserID: 2, Amount: 25, TransactionType: "transfer", Status: domain.StatusCompleted, CreatedAt: fixtureTime}
+}
+
+func fixtureAccount() *domain.ServiceAccount {
+	return &domain.ServiceAccount{ID: contractAccountID, Name: "billing", ClientID: "sa_client", Scopes: []domain.Permission{domain.PermTransactionsRead}, CreatedAt: fixtureTime}
+}
+
+func fixtureAPIKey() *domain.APIKey {
+	return &domain.APIKey{ID: 3, ServiceAccountID: contractAccountID, Name: "ci", Prefix: "sk_abcd", Scopes: []domain.Permission{domain.PermTransactionsRead}, CreatedAt: fixtureTime}
+}
+
+func fixtureStatementJob(status domain.StatementJobStatus) *domain.StatementJob {
+	job := &domain.StatementJob{
+		ID:               "job-1",
+		StatementRequest: domain.StatementRequest{UserID: contractUserID, From: fixtureTime, To: fixtureTime.AddDate(0, 6, 0), Format: domain.StatementCSV},
+		Status:           status,
+		CreatedAt:        fixtureTime,
+		ExpiresAt:        fixtureTime.Add(24 * time.Hour),
+	}
+	if status == domain.StatementJobCompleted {
+		completedAt := fixtureTime.Add(time.Minute)
+		job.CompletedAt = &completedAt
+	}
+	return job
+}
+
+func fixtureWebhook() *domain.WebhookSubscription {
+	return &domain.WebhookSubscription{ID: 5, UserID: contractUserID, URL: "https://example.com/hook", EventTypes: []string{domain.EventTransferCompleted}, CreatedAt: fixtureTime}
+}
+
+func fixtureDelivery() *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID: 9, SubscriptionID: 5, EventID: "evt-1", EventType: domain.EventTransferCompleted, Payload: []byte(`{"id":"evt-1"}`),
+		Status: domain.WebhookDeliveryPending, NextAttemptAt: fixtureTime, CreatedAt: fixtureTime,
+	}
+}
+
+func fixturePreferences() *domain.NotificationPreferences {
+	return &domain.NotificationPreferences{Email: maps.Clone(domain.DefaultEmailNotifications)}
+}
+
+type fakeUserService struct {
+	service.UserService
+	*fakes
+}
+
+func (s fakeUserService) Register(ctx context.Context, username, email, password string) (*domain.User, error) {
+	return fixtureUser(), s.err("Register")
+}
+
+func (s fakeUserService) Login(ctx context.Context, email, password string) (*domain.User, error) {
+	return fixtureUser(), s.err("Login")
+}
+
+func (s fakeUserService) GetByID(ctx context.Context, userID int64) (*domain.User, error) {
+	return fixtureUser(), s.err("GetByID")
+}
+
+func (s fakeUserService) ListUsers(ctx context.Context, filter domain.UserFilter) (*domain.UserPage, error) {
+	return &domain.UserPage{Users: []domain.User{*fixtureUser()}, Total: 1, Page: 1, PageSize: 20}, s.err("ListUsers")
+}
+
+func (s fakeUserService) Delete(ctx context.Context, userID int64) error {
+	return s.err("Delete")
+}
+
+func (s fakeUserService) UpdateProfile(ctx context.Context, userID int64, username string) (*domain.User, error) {
+	user := fixtureUser()
+	user.Username = username
+	return user, s.err("UpdateProfile")
+}
+
+func (s fakeUserService) RequestEmailChange(ctx context.Context, userID int64, email string) error {
+	return s.err("RequestEmailChange")
+}
+
+func (s fakeUserService) ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error) {
+	return fixtureUser(), s.err("ConfirmEmailChange")
+}
+
+func (s fakeUserService) ChangePassword(ctx context.Context, userID int64, sessionID string, currentPassword, newPassword string) error {
+	return s.err("ChangePassword")
+}
+
+func (s fakeUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	return s.err("RequestPasswordReset")
+}
+
+func (s fakeUserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	return s.err("ResetPassword")
+}
+
+type fakeSessionService struct {
+	service.SessionService
+	*fakes
+}
+
+func (s fakeSessionService) Validate(ctx context.Context, sessionID string, userID int64) (*domain.Session, error) {
+	session := fixtureSession()
+	if s.impersonatorID != 0 {
+		session.ImpersonatorID = &s.impersonatorID
+	}
+	return session, nil
+}
+
+func (s fakeSessionService) Create(ctx context.Context, userID int64, device, userAgent, ipAddress string) (*domain.Session, error) {
+	return fixtureSession(), s.err("Create")
+}
+
+func (s fakeSessionService) ListActive(ctx context.Context, userID int64) ([]domain.Session, error) {
+	return []domain.Session{*fixtureSession()}, s.err("ListActive")
+}
+
+func (s fakeSessionService) Revoke(ctx context.Context, userID int64, sessionID string) error {
+	return s.err("Revoke")
+}
+
+func (s fakeSessionService) StartImpersonation(ctx context.Context, actorID, subjectID int64, reason string, readOnly bool, userAgent, ipAddress string) (*domain.Session, error) {
+	session := fixtureSession()
+	session.ID, session.UserID, session.ImpersonatorID = "session-2", subjectID, &actorID
+	return session, s.err("StartImpersonation")
+}
+
+func (s fakeSessionService) ListImpersonations(ctx context.Context) ([]domain.Session, error) {
+	session := fixtureSession()
+	actorID := int64(contractUserID)
+	session.ID, session.UserID, session.ImpersonatorID = "session-2", 2, &actorID
+	return []domain.Session{*session}, s.err("ListImpersonations")
+}
+
+func (s fakeSessionService) RevokeImpersonation(ctx context.Context, actorID int64, sessionID string) error {
+	return s.err("RevokeImpersonation")
+}
+
+type fakeRoleService struct {
+	service.RoleService
+	*fakes
+}
+
+func (s fakeRoleService) GetUserPermissions(ctx context.Context, userID int64) ([]domain.Permission, error) {
+	return []domain.Permission{
+		domain.PermUsersRead, domain.PermUsersDelete, domain.PermRolesRead, domain.PermRolesAssign,
+		domain.PermTransactionsRead, domain.PermTransactionsCredit, domain.PermTransactionsDebit,
+		domain.PermAuditRead, domain.PermServiceAccounts, domain.PermUsersImpersonate,
+		domain.PermPaymentsImport, domain.PermDiagnostics,
+	}, s.err("GetUserPermissions")
+}
+
+func (s fakeRoleService) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	return []domain.Role{{Name: "admin", Description: "Administrators", Permissions: []domain.Permission{domain.PermUsersRead}}}, s.err("ListRoles")
+}
+
+func (s fakeRoleService) AssignRole(ctx context.Context, userID int64, roleName string) (*domain.User, error) {
+	user := fixtureUser()
+	user.Role = roleName
+	return user, s.err("AssignRole")
+}
+
+type fakeServiceAccountService struct {
+	service.ServiceAccountService
+	*fakes
+}
+
+func (s fakeServiceAccountService) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	return fixtureAccount(), nil
+}
+
+func (s fakeServiceAccountService) Create(ctx context.Context, name string, scopes []domain.Permission) (*domain.ServiceAccount, string, error) {
+	return fixtureAccount(), "client-secret", s.err("Create")
+}
+
+func (s fakeServiceAccountService) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	return []domain.ServiceAccount{*fixtureAccount()}, s.err("List")
+}
+
+func (s fakeServiceAccountService) CreateAPIKey(ctx context.Context, accountID int64, name string, scopes []domain.Permission, expiresAt *time.Time) (*domain.APIKey, string, error) {
+	key := fixtureAPIKey()
+	key.ExpiresAt = expiresAt
+	return key, "sk_abcd_secret", s.err("CreateAPIKey")
+}
+
+func (s fakeServiceAccountService) ListAPIKeys(ctx context.Context, accountID int64) ([]domain.APIKey, error) {
+	return []domain.APIKey{*fixtureAPIKey()}, s.err("ListAPIKeys")
+}
+
+func (s fakeServiceAccountService) RevokeAPIKey(ctx context.Context, accountID, keyID int64) error {
+	return s.err("RevokeAPIKey")
+}
+
+func (s fakeServiceAccountService) AuthenticateClient(ctx context.Context, clientID, clientSecret string, requested []domain.Permission) (*domain.ServiceAccount, []domain.Permission, error) {
+	account := fixtureAccount()
+	return account, account.Scopes, s.err("AuthenticateClient")
+}
+
+type fakeTransactionService struct {
+	service.TransactionService
+	*fakes
+}
+
+func (s fakeTransactionService) CheckTransfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) error {
+	return s.err("CheckTransfer")
+}
+
+func (s fakeTransactionService) CheckCredit(ctx context.Context, userID int64, amount float64) error {
+	return s.err("CheckCredit")
+}
+
+func (s fakeTransactionService) CheckDebit(ctx context.Context, userID int64, amount float64) error {
+	return s.err("CheckDebit")
+}
+
+func (s fakeTransactionService) GetTransactionHistory(ctx context.Context, filter domain.TransactionFilter) (*domain.TransactionPage, error) {
+	cursor := domain.TransactionCursor{CreatedAt: fixtureTime, ID: 42}
+	return &domain.TransactionPage{Transactions: []domain.Transaction{*fixtureTransaction()}, NextCursor: cursor.Encode()}, s.err("GetTransactionHistory")
+}
+
+func (s fakeTransactionService) GetByTransactionID(ctx context.Context, id int64) (*domain.Transaction, error) {
+	return fixtureTransaction(), s.err("GetByTransactionID")
+}
+
+type fakeBalanceService struct {
+	*fakes
+}
+
+func (s fakeBalanceService) GetCurrent(ctx context.Context, userID int64) (*domain.Balance, error) {
+	return &domain.Balance{UserID: userID, Amount: 100, LastUpdatedAt: fixtureTime}, s.err("GetCurrent")
+}
+
+type fakeStatementService struct {
+	service.StatementService
+	*fakes
+}
+
+func (s fakeStatementService) Generate(ctx context.Context, req domain.StatementRequest, w io.Writer) error {
+	if err := s.err("Generate"); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "date,amount\n2026-01-02,25.00\n")
+	return err
+}
+
+func (s fakeStatementService) StartJob(ctx context.Context, req domain.StatementRequest) (*domain.StatementJob, error) {
+	return fixtureStatementJob(domain.StatementJobPending), s.err("StartJob")
+}
+
+func (s fakeStatementService) GetJob(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, error) {
+	return fixtureStatementJob(domain.StatementJobCompleted), s.err("GetJob")
+}
+
+// statementFile is the file of a completed statement job.
+type statementFile struct {
+	*strings.Reader
+}
+
+func (statementFile) Close() error { return nil }
+
+func (s fakeStatementService) GetJobFile(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, io.ReadSeekCloser, error) {
+	if s.jobPending {
+		return fixtureStatementJob(domain.StatementJobRunning), nil, s.err("GetJobFile")
+	}
+	if err := s.err("GetJobFile"); err != nil {
+		return nil, nil, err
+	}
+	return fixtureStatementJob(domain.StatementJobCompleted), statementFile{strings.NewReader("date,amount\n2026-01-02,25.00\n")}, nil
+}
+
+type fakePaymentImportService struct {
+	*fakes
+}
+
+func (s fakePaymentImportService) ImportPain001(ctx context.Context, principal *domain.Principal, anyDebtor bool, doc *iso20022.Pain001) (*iso20022.Pain002, []domain.PaymentInstruction, error) {
+	report := iso20022.NewPain002(doc, fixtureTime)
+	report.Finish()
+	return report, []domain.PaymentInstruction{{FromUserID: contractUserID, ToUserID: 2, Amount: 10, EndToEndID: "E2E-1"}}, s.err("ImportPain001")
+}
+
+type fakeAuditLogService struct {
+	service.AuditLogService
+	*fakes
+}
+
+func (s fakeAuditLogService) ListLogs(ctx context.Context, filter domain.AuditLogFilter) (*domain.AuditLogPage, error) {
+	actorID := int64(contractUserID)
+	entry := domain.AuditLog{ID: 1, EntityType: "user", EntityID: 2, Action: "login", ActorType: domain.PrincipalUser, ActorID: &actorID, Details: "User 2 logged in", CreatedAt: fixtureTime}
+	return &domain.AuditLogPage{Entries: []domain.AuditLog{entry}}, s.err("ListLogs")
+}
+
+func (s fakeAuditLogService) Export(ctx context.Context, filter domain.AuditLogFilter, format domain.ExportFormat, w io.Writer) error {
+	if err := s.err("Export"); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "id,action\n1,login\n")
+	return err
+}
+
+func (s fakeAuditLogService) Verify(ctx context.Context) (*domain.AuditChainReport, error) {
+	return &domain.AuditChainReport{Valid: true, Verified: 1, LastEntryID: 1, LastHash: "abc", PublicKey: "key"}, s.err("Verify")
+}
+
+type fakeWebhookService struct {
+	service.WebhookService
+	*fakes
+}
+
+func (s fakeWebhookService) CreateSubscription(ctx context.Context, userID int64, url string, eventTypes []string, secret string) (*domain.WebhookSubscription, string, error) {
+	return fixtureWebhook(), "whsec_secret", s.err("CreateSubscription")
+}
+
+func (s fakeWebhookService) ListSubscriptions(ctx context.Context, userID int64) ([]domain.WebhookSubscription, error) {
+	return []domain.WebhookSubscription{*fixtureWebhook()}, s.err("ListSubscriptions")
+}
+
+func (s fakeWebhookService) GetSubscription(ctx context.Context, userID, id int64) (*domain.WebhookSubscription, error) {
+	return fixtureWebhook(), s.err("GetSubscription")
+}
+
+func (s fakeWebhookService) DeleteSubscription(ctx context.Context, userID, id int64) error {
+	return s.err("DeleteSubscription")
+}
+
+func (s fakeWebhookService) ListDeliveries(ctx context.Context, userID int64, filter domain.WebhookDeliveryFilter) (*domain.WebhookDeliveryPage, error) {
+	return &domain.WebhookDeliveryPage{Deliveries: []domain.WebhookDelivery{*fixtureDelivery()}}, s.err("ListDeliveries")
+}
+
+func (s fakeWebhookService) Redeliver(ctx context.Context, userID, subscriptionID, deliveryID int64) (*domain.WebhookDelivery, error) {
+	return fixtureDelivery(), s.err("Redeliver")
+}
+
+type fakeNotificationService struct {
+	service.NotificationService
+	*fakes
+}
+
+func (s fakeNotificationService) List(ctx context.Context, filter domain.NotificationFilter) (*domain.NotificationPage, error) {
+	notification := domain.Notification{ID: 1, UserID: contractUserID, Type: domain.NotificationTransferReceived, Title: "Transfer received", Body: "You received 25.00", EventID: "evt-1", CreatedAt: fixtureTime}
+	return &domain.NotificationPage{Notifications: []domain.Notification{notification}}, s.err("List")
+}
+
+func (s fakeNotificationService) CountUnread(ctx context.Context, userID int64) (int, error) {
+	return 1, s.err("CountUnread")
+}
+
+func (s fakeNotificationService) MarkRead(ctx context.Context, userID, id int64) error {
+	return s.err("MarkRead")
+}
+
+func (s fakeNotificationService) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	return 1, s.err("MarkAllRead")
+}
+
+func (s fakeNotificationService) GetPreferences(ctx context.Context, userID int64) (*domain.NotificationPreferences, error) {
+	return fixturePreferences(), s.err("GetPreferences")
+}
+
+func (s fakeNotificationService) UpdatePreferences(ctx context.Context, userID int64, email map[domain.NotificationType]bool) (*domain.NotificationPreferences, error) {
+	return fixturePreferences(), s.err("UpdatePreferences")
+}
+
+type fakeLiveUpdateService struct {
+	service.LiveUpdateService
+	*fakes
+}
+
+// Subscribe sends one update and closes the channel, which ends the stream.
+func (s fakeLiveUpdateService) Subscribe(ctx context.Context, userID int64, lastEventID string) (<-chan domain.LiveUpdate, error) {
+	if err := s.err("Subscribe"); err != nil {
+		return nil, err
+	}
+	updates := make(chan domain.LiveUpdate, 1)
+	updates <- domain.LiveUpdate{ID: "1-0", Event: &domain.Event{ID: "evt-1", Type: domain.EventBalanceChanged, Version: 1, OccurredAt: fixtureTime, CorrelationID: "evt-1", Data: []byte(`{"user_id":1}`)}}
+	close(updates)
+	return updates, nil
+}
+
+// refusingLimiter refuses every request.
+type refusingLimiter struct{}
+
+func (refusingLimiter) Allow(ctx context.Context, policy ratelimit.Policy, key string) ratelimit.Result {
+	return ratelimit.Result{RetryAfter: time.Second, ResetAfter: time.Second}
+}
+
+type caller int
+
+const (
+	asUser caller = iota
+	asService
+	anonymous
+)
+
+func contractToken(t *testing.T, as caller) string {
+	t.Helper()
+	claims := jwt.MapClaims{"sub": contractUserID, "sid": contractSessionID, "typ": string(domain.PrincipalUser), "exp": time.Now().Add(time.Hour).Unix()}
+	if as == asService {
+		// No scopes, so the account may use none of the protected routes.
+		claims = jwt.MapClaims{"sub": contractAccountID, "typ": string(domain.PrincipalService), "scope": "", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(contractSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// newContractServer builds the server on the fake services, with sqlmock and miniredis behind the
+// health checks.
+func newContractServer(t *testing.T, f *fakes, limiter ratelimit.Limiter) (*Server, *HealthHandler) {
+	t.Helper()
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := &config.Config{Env: "test", JWTSecret: contractSecret}
+	unlimited := config.RateLimitPolicy{PerMinute: 1000000, Burst: 1000000}
+	cfg.RateLimit.Login, cfg.RateLimit.Transfer, cfg.RateLimit.Read, cfg.RateLimit.Write = unlimited, unlimited, unlimited, unlimited
+
+	users := fakeUserService{fakes: f}
+	sessions := fakeSessionService{fakes: f}
+	roles := fakeRoleService{fakes: f}
+	accounts := fakeServiceAccountService{fakes: f}
+	audit := fakeAuditLogService{fakes: f}
+	transactions := fakeTransactionService{fakes: f}
+	dispatcher := worker.NewDispatcher(1, transactions)
+	health := NewHealthHandler(db, rdb, dispatcher, time.Second)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := NewServer(cfg, logger, users, roles, accounts, sessions, audit,
+		NewUserHandler(users),
+		NewTransactionHandler(dispatcher, transactions),
+		NewAuthHandler(users, sessions, accounts, []byte(contractSecret)),
+		NewBalanceHandler(fakeBalanceService{fakes: f}),
+		NewRoleHandler(roles),
+		NewServiceAccountHandler(accounts),
+		NewSessionHandler(sessions),
+		NewStatementHandler(fakeStatementService{fakes: f}),
+		NewPaymentHandler(dispatcher, fakePaymentImportService{fakes: f}),
+		NewAuditHandler(audit),
+		NewWebhookHandler(fakeWebhookService{fakes: f}),
+		NewStreamHandler(fakeLiveUpdateService{fakes: f}, fakeSessionService{fakes: f}),
+		NewNotificationHandler(fakeNotificationService{fakes: f}),
+		health,
+		limiter,
+	)
+	return srv, health
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	srv, _ := newContractServer(t, &fakes{}, ratelimit.NewMemoryLimiter())
+	if err := srv.CheckRoutes(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestImpersonationIsDenied checks that an impersonator, even in read-write mode, cannot take over
+// the account or act on other accounts through it.
+func TestImpersonationIsDenied(t *testing.T) {
+	const actorID = 99
+	claims := jwt.MapClaims{
+		"sub": contractUserID, "sid": contractSessionID, "typ": string(domain.PrincipalUser),
+		"act": map[string]interface{}{"sub": actorID}, "mode": impersonationReadWrite,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(contractSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "update profile", method: "PATCH", target: "/api/v1/users/me", body: `{"email":"mallory@example.com"}`, want: http.StatusForbidden},
+		{name: "change password", method: "POST", target: "/api/v1/users/me/password",
+			body: `{"current_password":"Correct-Horse-1","new_password":"Correct-Horse-2"}`, want: http.StatusForbidden},
+		{name: "delete user", method: "DELETE", target: "/api/v1/users/2", want: http.StatusForbidden},
+		{name: "redeliver", method: "POST", target: "/api/v1/webhooks/5/deliveries/9/redeliver", want: http.StatusForbidden},
+		{name: "impersonate", method: "POST", target: "/api/v1/admin/impersonations",
+			body: `{"user_id":2,"reason":"Support ticket 123"}`, want: http.StatusForbidden},
+		// Writes on behalf of the user remain available in read-write mode.
+		{name: "transfer", method: "POST", target: "/api/v1/transactions/transfer", body: `{"to_user_id":2,"amount":25}`, want: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newContractServer(t, &fakes{impersonatorID: actorID}, ratelimit.NewMemoryLimiter())
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			srv.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "impersonation_not_allowed") {
+				t.Errorf("body = %s, want impersonation_not_allowed", rec.Body.String())
+			}
+		})
+	}
+}
+
+const testPain001 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr><MsgId>MSG-1</MsgId><CreDtTm>2026-01-02T03:04:05</CreDtTm><NbOfTxs>1</NbOfTxs><CtrlSum>10.00</CtrlSum></GrpHdr>
+    <PmtInf>
+      <PmtInfId>PMT-1</PmtInfId>
+      <DbtrAcct><Id><Othr><Id>1</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="EUR">10.00</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>2</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`
+
+// contractCase is a request and the status it is answered with.
+type contractCase struct {
+	name        string
+	method      string
+	target      string
+	body        string
+	contentType string // application/json when a body is given
+	caller      caller
+
+	errs       map[string]error
+	failAll    bool
+	jobPending bool
+	refuse     bool // the rate limiter refuses every request
+	drain      bool
+
+	want int
+
+	// notFound are the errors turning a successful request into a 404, invalidTarget is a target
+	// answered with a 400. The error cases derived from them are added by variants.
+	notFound      map[string]error
+	invalidTarget string
+}
+
+// contractCases are the successful requests of every operation.
+var contractCases = []contractCase{
+	{name: "metrics", method: "GET", target: "/metrics", caller: anonymous, want: 200},
+	{name: "liveness", method: "GET", target: "/healthz", caller: anonymous, want: 200},
+	{name: "readiness", method: "GET", target: "/readyz", caller: anonymous, want: 200},
+	{name: "openapi", method: "GET", target: "/api/v1/openapi.json", caller: anonymous, want: 200},
+	{name: "register", method: "POST", target: "/api/v1/auth/register", caller: anonymous, want: 201,
+		body: `{"username":"alice","email":"alice@example.com","password":"Correct-Horse-1"}`},
+	{name: "login", method: "POST", target: "/api/v1/auth/login", caller: anonymous, want: 200,
+		body: `{"email":"alice@example.com","password":"Correct-Horse-1","device":"laptop"}`},
+	{name: "verify email", method: "POST", target: "/api/v1/auth/verify-email", caller: anonymous, want: 200,
+		body: `{"token":"verification-token"}`},
+	{name: "request password reset", method: "POST", target: "/api/v1/auth/password-reset", caller: anonymous, want: 202,
+		body: `{"email":"alice@example.com"}`},
+	{name: "confirm password reset", method: "POST", target: "/api/v1/auth/password-reset/confirm", caller: anonymous, want: 204,
+		body: `{"token":"reset-token","new_password":"Correct-Horse-2"}`},
+	{name: "oauth token", method: "POST", target: "/api/v1/oauth/token", caller: anonymous, want: 200,
+		body: "grant_type=client_credentials&client_id=sa_client&client_secret=client-secret", contentType: "application/x-www-form-urlencoded"},
+	{name: "update profile", method: "PATCH", target: "/api/v1/users/me", want: 200,
+		body: `{"username":"alice2","email":"alice2@example.com"}`},
+	{name: "change password", method: "POST", target: "/api/v1/users/me/password", want: 204,
+		body: `{"current_password":"Correct-Horse-1","new_password":"Correct-Horse-2"}`},
+	{name: "list sessions", method: "GET", target: "/api/v1/users/me/sessions", want: 200},
+	{name: "revoke session", method: "DELETE", target: "/api/v1/users/me/sessions/session-3", want: 204,
+		notFound: map[string]error{"Revoke": domain.ErrSessionNotFound}},
+	{name: "list users", method: "GET", target: "/api/v1/users?sort=-created_at&page=1&page_size=20", want: 200,
+		invalidTarget: "/api/v1/users?page=0"},
+	{name: "get user", method: "GET", target: "/api/v1/users/1", want: 200,
+		notFound: map[string]error{"GetByID": domain.ErrUserNotFound}, invalidTarget: "/api/v1/users/abc"},
+	{name: "delete user", method: "DELETE", target: "/api/v1/users/1", want: 204,
+		notFound: map[string]error{"Delete": domain.ErrUserNotFound}, invalidTarget: "/api/v1/users/abc"},
+	{name: "assign role", method: "PUT", target: "/api/v1/users/2/role", want: 200, body: `{"role":"admin"}`,
+		notFound: map[string]error{"AssignRole": domain.ErrUserNotFound}},
+	{name: "list roles", method: "GET", target: "/api/v1/roles", want: 200},
+	{name: "transfer", method: "POST", target: "/api/v1/transactions/transfer", want: 202, body: `{"to_user_id":2,"amount":25}`,
+		notFound: map[string]error{"CheckTransfer": domain.ErrUserNotFound}},
+	{name: "credit", method: "POST", target: "/api/v1/transactions/credit", want: 202, body: `{"user_id":2,"amount":25}`},
+	{name: "debit", method: "POST", target: "/api/v1/transactions/debit", want: 202, body: `{"user_id":2,"amount":25}`,
+		notFound: map[string]error{"CheckDebit": domain.ErrUserNotFound}},
+	{name: "transaction history", method: "GET", target: "/api/v1/transactions/history?direction=outgoing&limit=10", want: 200,
+		invalidTarget: "/api/v1/transactions/history?type=refund"},
+	{name: "get transaction", method: "GET", target: "/api/v1/transactions/42", want: 200,
+		notFound: map[string]error{"GetByTransactionID": domain.ErrTransactionNotFound}, invalidTarget: "/api/v1/transactions/abc"},
+	{name: "current balance", method: "GET", target: "/api/v1/balances/current", want: 200,
+		notFound: map[string]error{"GetCurrent": domain.ErrBalanceNotFound}},
+	{name: "statement", method: "GET", target: "/api/v1/statements?from=2026-01-01&to=2026-01-31", want: 200,
+		invalidTarget: "/api/v1/statements?from=yesterday&to=2026-01-31"},
+	{name: "statement job", method: "GET", target: "/api/v1/statements?from=2026-01-01&to=2026-01-31&async=true", want: 202},
+	{name: "get statement job", method: "GET", target: "/api/v1/statements/jobs/job-1", want: 200,
+		notFound: map[string]error{"GetJob": domain.ErrStatementJobNotFound}},
+	{name: "download statement job", method: "GET", target: "/api/v1/statements/jobs/job-1/download", want: 200,
+		notFound: map[string]error{"GetJobFile": domain.ErrStatementJobNotFound}},
+	{name: "import pain.001", method: "POST", target: "/api/v1/payments/pain001", want: 200, body: testPain001, contentType: "application/xml"},
+	{name: "audit logs", method: "GET", target: "/api/v1/audit-logs?entity_type=user&limit=10", want: 200,
+		invalidTarget: "/api/v1/audit-logs?from=yesterday"},
+	{name: "export audit logs", method: "GET", target: "/api/v1/audit-logs/export?format=csv", want: 200,
+		invalidTarget: "/api/v1/audit-logs/export?format=xml"},
+	{name: "verify audit logs", method: "GET", target: "/api/v1/audit-logs/verify", want: 200},
+	{name: "create service account", method: "POST", target: "/api/v1/service-accounts", want: 201,
+		body: `{"name":"billing","scopes":["transactions:read"]}`},
+	{name: "list service accounts", method: "GET", target: "/api/v1/service-accounts", want: 200},
+	{name: "create api key", method: "POST", target: "/api/v1/service-accounts/7/keys", want: 201,
+		body:     `{"name":"ci","scopes":["transactions:read"],"expires_in_hours":24}`,
+		notFound: map[string]error{"CreateAPIKey": domain.ErrServiceAccountNotFound}},
+	{name: "list api keys", method: "GET", target: "/api/v1/service-accounts/7/keys", want: 200,
+		invalidTarget: "/api/v1/service-accounts/abc/keys"},
+	{name: "revoke api key", method: "DELETE", target: "/api/v1/service-accounts/7/keys/3", want: 204,
+		notFound: map[string]error{"RevokeAPIKey": domain.ErrAPIKeyNotFound}, invalidTarget: "/api/v1/service-accounts/7/keys/abc"},
+	{name: "impersonate", method: "POST", target: "/api/v1/admin/impersonations", want: 201,
+		body:     `{"user_id":2,"reason":"Support ticket 123"}`,
+		notFound: map[string]error{"StartImpersonation": domain.ErrUserNotFound}},
+	{name: "list impersonations", method: "GET", target: "/api/v1/admin/impersonations", want: 200},
+	{name: "revoke impersonation", method: "DELETE", target: "/api/v1/admin/impersonations/session-2", want: 204,
+		notFound: map[string]error{"RevokeImpersonation": domain.ErrSessionNotFound}},
+	{name: "diagnostics", method: "GET", target: "/api/v1/admin/diagnostics", want: 200},
+	{name: "create webhook", method: "POST", target: "/api/v1/webhooks", want: 201,
+		body: `{"url":"https://example.com/hook","event_types":["transfer.completed"]}`},
+	{name: "list webhooks", method: "GET", target: "/api/v1/webhooks", want: 200},
+	{name: "get webhook", method: "GET", target: "/api/v1/webhooks/5", want: 200,
+		notFound: map[string]error{"GetSubscription": domain.ErrWebhookNotFound}, invalidTarget: "/api/v1/webhooks/abc"},
+	{name: "delete webhook", method: "DELETE", target: "/api/v1/webhooks/5", want: 204,
+		notFound: map[string]error{"DeleteSubscription": domain.ErrWebhookNotFound}, invalidTarget: "/api/v1/webhooks/abc"},
+	{name: "webhook deliveries", method: "GET", target: "/api/v1/webhooks/5/deliveries?status=pending", want: 200,
+		notFound: map[string]error{"ListDeliveries": domain.ErrWebhookNotFound}, invalidTarget: "/api/v1/webhooks/5/deliveries?status=lost"},
+	{name: "redeliver", method: "POST", target: "/api/v1/webhooks/5/deliveries/9/redeliver", want: 202,
+		notFound: map[string]error{"Redeliver": domain.ErrWebhookDeliveryNotFound}, invalidTarget: "/api/v1/webhooks/5/deliveries/abc/redeliver"},
+	{name: "stream", method: "GET", target: "/api/v1/stream", want: 200},
+	{name: "notifications", method: "GET", target: "/api/v1/notifications?unread=true&limit=10", want: 200,
+		invalidTarget: "/api/v1/notifications?unread=maybe"},
+	{name: "unread notifications", method: "GET", target: "/api/v1/notifications/unread-count", want: 200},
+	{name: "mark notifications read", method: "POST", target: "/api/v1/notifications/read", want: 200},
+	{name: "mark notification read", method: "POST", target: "/api/v1/notifications/1/read", want: 204,
+		notFound: map[string]error{"MarkRead": domain.ErrNotificationNotFound}, invalidTarget: "/api/v1/notifications/abc/read"},
+	{name: "notification preferences", method: "GET", target: "/api/v1/notifications/preferences", want: 200},
+	{name: "update notification preferences", method: "PUT", target: "/api/v1/notifications/preferences", want: 200,
+		body: `{"email":{"transfer_received":false}}`},
+}
+
+// contractErrorCases are the errors that cannot be derived from a successful request.
+var contractErrorCases = []contractCase{
+	{name: "readiness while draining", method: "GET", target: "/readyz", caller: anonymous, drain: true, want: 503},
+	{name: "register taken email", method: "POST", target: "/api/v1/auth/register", caller: anonymous, want: 409,
+		body: `{"username":"alice","email":"alice@example.com","password":"Correct-Horse-1"}`,
+		errs: map[string]error{"Register": domain.ErrDuplicateEmail}},
+	{name: "login wrong password", method: "POST", target: "/api/v1/auth/login", caller: anonymous, want: 401,
+		body: `{"email":"alice@example.com","password":"wrong"}`,
+		errs: map[string]error{"Login": domain.ErrIncorrectPassword}},
+	{name: "verify email bad token", method: "POST", target: "/api/v1/auth/verify-email", caller: anonymous, want: 400,
+		body: `{"token":"expired"}`,
+		errs: map[string]error{"ConfirmEmailChange": domain.ErrInvalidVerificationToken}},
+	{name: "oauth token unsupported grant", method: "POST", target: "/api/v1/oauth/token", caller: anonymous, want: 400,
+		body: "grant_type=password", contentType: "application/x-www-form-urlencoded"},
+	{name: "oauth token wrong secret", method: "POST", target: "/api/v1/oauth/token", caller: anonymous, want: 401,
+		body: "grant_type=client_credentials&client_id=sa_client&client_secret=wrong", contentType: "application/x-www-form-urlencoded",
+		errs: map[string]error{"AuthenticateClient": domain.ErrInvalidCredentials}},
+	{name: "update profile taken email", method: "PATCH", target: "/api/v1/users/me", want: 409,
+		body: `{"email":"bob@example.com"}`,
+		errs: map[string]error{"RequestEmailChange": domain.ErrDuplicateEmail}},
+	{name: "transfer insufficient funds", method: "POST", target: "/api/v1/transactions/transfer", want: 422,
+		body: `{"to_user_id":2,"amount":2500}`,
+		errs: map[string]error{"CheckTransfer": domain.ErrInsufficientFunds}},
+	{name: "credit negative amount", method: "POST", target: "/api/v1/transactions/credit", want: 400,
+		body: `{"user_id":2,"amount":-5}`,
+		errs: map[string]error{"CheckCredit": domain.ErrInvalidAmount}},
+	{name: "debit insufficient funds", method: "POST", target: "/api/v1/transactions/debit", want: 422,
+		body: `{"user_id":2,"amount":2500}`,
+		errs: map[string]error{"CheckDebit": domain.ErrInsufficientFunds}},
+	{name: "download unfinished statement job", method: "GET", target: "/api/v1/statements/jobs/job-1/download", jobPending: true, want: 409},
+	{name: "import invalid pain.001", method: "POST", target: "/api/v1/payments/pain001", want: 400,
+		body: `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"/>`, contentType: "application/xml"},
+	{name: "import oversized pain.001", method: "POST", target: "/api/v1/payments/pain001", want: 413,
+		body: "<Document>" + strings.Repeat("x", maxPaymentFileSize) + "</Document>", contentType: "application/xml"},
+	{name: "stream invalid last event ID", method: "GET", target: "/api/v1/stream?last_event_id=abc", want: 400,
+		errs: map[string]error{"Subscribe": domain.ErrInvalidCursor}},
+}
+
+func documents(op *openapi3.Operation, status int) bool {
+	return op.Responses.Status(status) != nil
+}
+
+// variants derives the error responses every operation documents from its successful request.
+func variants(c contractCase, op *openapi3.Operation) []contractCase {
+	var cases []contractCase
+	add := func(suffix string, want int, change func(*contractCase)) {
+		if !documents(op, want) {
+			return
+		}
+		v := c
+		v.name = c.name + " " + suffix
+		v.want = want
+		change(&v)
+		cases = append(cases, v)
+	}
+
+	if c.caller != anonymous {
+		add("without credentials", http.StatusUnauthorized, func(v *contractCase) { v.caller = anonymous })
+		add("by service account without scopes", http.StatusForbidden, func(v *contractCase) { v.caller = asService })
+	}
+	if hasJSONBody(op) {
+		add("with malformed body", http.StatusBadRequest, func(v *contractCase) { v.body = "{" })
+	} else if c.invalidTarget != "" {
+		add("with invalid parameters", http.StatusBadRequest, func(v *contractCase) { v.target = c.invalidTarget })
+	}
+	if c.notFound != nil {
+		add("not found", http.StatusNotFound, func(v *contractCase) { v.errs = c.notFound })
+	}
+	add("rate limited", http.StatusTooManyRequests, func(v *contractCase) { v.refuse = true })
+	add("failing", http.StatusInternalServerError, func(v *contractCase) { v.failAll = true })
+	return cases
+}
+
+// TestResponsesMatchSpec sends requests to every operation and validates the responses against
+// the OpenAPI document. Every documented response has to be seen at least once.
+func TestResponsesMatchSpec(t *testing.T) {
+	// The downloads are only checked for their content type, their schema is a string.
+	for _, contentType := range []string{"application/pdf", "application/x-ofx", "application/xml", "application/x-ndjson", "text/event-stream"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.PlainBodyDecoder)
+		t.Cleanup(func() { openapi3filter.UnregisterBodyDecoder(contentType) })
+	}
+
+	spec := loadAPISpec()
+	findOperation := func(c contractCase) (*openapi3.Operation, string) {
+		route, _, err := spec.router.FindRoute(httptest.NewRequest(c.method, c.target, nil))
+		if err != nil {
+			t.Fatalf("%s %s is not documented: %v", c.method, c.target, err)
+		}
+		return route.Operation, route.Method + " " + route.Path
+	}
+
+	cases := slices.Clone(contractErrorCases)
+	for _, c := range contractCases {
+		op, _ := findOperation(c)
+		cases = append(cases, c)
+		cases = append(cases, variants(c, op)...)
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range cases {
+		op, key := findOperation(c)
+		seen[fmt.Sprintf("%s %d", key, c.want)] = true
+
+		t.Run(c.name, func(t *testing.T) {
+			f := &fakes{errs: c.errs, jobPending: c.jobPending}
+			if c.failAll {
+				f.failAll = fmt.Errorf("connection refused")
+			}
+			var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+			if c.refuse {
+				limiter = refusingLimiter{}
+			}
+			srv, health := newContractServer(t, f, limiter)
+			if c.drain {
+				health.Drain()
+			}
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.body != "" {
+				contentType := c.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				req.Header.Set("Content-Type", contentType)
+			}
+			if c.caller != anonymous {
+				req.Header.Set("Authorization", "Bearer "+contractToken(t, c.caller))
+			}
+			rec := httptest.NewRecorder()
+			srv.Router().ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, c.want, rec.Body.String())
+			}
+
+			route, pathParams, err := spec.router.FindRoute(httptest.NewRequest(c.method, c.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route},
+				Status:                 rec.Code,
+				Header:                 rec.Header(),
+				Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+			}
+			input.SetBodyBytes(rec.Body.Bytes())
+			if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+				t.Errorf("%s %s: response does not match the specification:\n%s\nbody: %s",
+					c.method, route.Path, strings.Join(validationErrors(err), "\n"), rec.Body.String())
+			}
+			if op.Responses.Status(rec.Code) == nil {
+				t.Errorf("status %d is not documented", rec.Code)
+			}
+		})
+	}
+
+	var missing []string
+	for path, item := range spec.doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			for status := range op.Responses.Map() {
+				if key := fmt.Sprintf("%s %s %s", method, path, status); !seen[key] {
+					missing = append(missing, key)
+				}
+			}
+		}
+	}
+	slices.Sort(missing)
+	for _, key := range missing {
+		t.Errorf("no test case for the documented response %s", key)
+	}
+}
@@ -2,12 +2,129 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/security"
 )
 
+// apiError is answered as an RFC 7807 problem. Clients branch on Code, which never changes for a
+// given error, while Message is meant for humans.
 type apiError struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status int
+	// Code defaults to the code of the status, see statusCodes.
+	Code    string
+	Message string
+	Details interface{}
+	// Err is the internal cause. It is logged, never sent to the client.
+	Err error
+}
+
+// problem is the application/problem+json body. The type is always about:blank, as the problems
+// are told apart by their code.
+type problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
+}
+
+// statusCodes are the codes of errors without a more specific one.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// domainErrors maps the errors of the domain package to their responses. Errors are matched with
+// errors.Is in order, see problemDetail for the message that is sent.
+var domainErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{domain.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{domain.ErrTransactionNotFound, http.StatusNotFound, "transaction_not_found"},
+	{domain.ErrBalanceNotFound, http.StatusNotFound, "balance_not_found"},
+	{domain.ErrServiceAccountNotFound, http.StatusNotFound, "service_account_not_found"},
+	{domain.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found"},
+	{domain.ErrSessionNotFound, http.StatusNotFound, "session_not_found"},
+	{domain.ErrStatementJobNotFound, http.StatusNotFound, "statement_job_not_found"},
+	{domain.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found"},
+	{domain.ErrWebhookDeliveryNotFound, http.StatusNotFound, "webhook_delivery_not_found"},
+	{domain.ErrNotificationNotFound, http.StatusNotFound, "notification_not_found"},
+	{domain.ErrDuplicateEmail, http.StatusConflict, "duplicate_email"},
+	{domain.ErrInsufficientFunds, http.StatusUnprocessableEntity, "insufficient_funds"},
+	{domain.ErrInvalidTransfer, http.StatusUnprocessableEntity, "invalid_transfer"},
+	{domain.ErrIncorrectPassword, http.StatusUnauthorized, "incorrect_password"},
+	{domain.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{domain.ErrSessionInactive, http.StatusUnauthorized, "session_inactive"},
+	{domain.ErrInvalidVerificationToken, http.StatusBadRequest, "invalid_verification_token"},
+	{domain.ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token"},
+	{domain.ErrRoleNotFound, http.StatusBadRequest, "role_not_found"},
+	{domain.ErrUnknownScope, http.StatusBadRequest, "unknown_scope"},
+	{domain.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{domain.ErrInvalidFilter, http.StatusBadRequest, "invalid_filter"},
+	{domain.ErrInvalidProfile, http.StatusBadRequest, "invalid_profile"},
+	{domain.ErrInvalidImpersonation, http.StatusBadRequest, "invalid_impersonation"},
+	{domain.ErrInvalidServiceAccount, http.StatusBadRequest, "invalid_service_account"},
+	{domain.ErrInvalidWebhook, http.StatusBadRequest, "invalid_webhook"},
+	{domain.ErrInvalidPreferences, http.StatusBadRequest, "invalid_preferences"},
+	{domain.ErrInvalidAmount, http.StatusBadRequest, "invalid_amount"},
+}
+
+// errorResponse maps an error returned by a service. Unknown errors are internal: the client only
+// gets message, err is logged.
+func errorResponse(err error, message string) *apiError {
+	if apiErr := passwordPolicyError(err); apiErr != nil {
+		return apiErr
+	}
+	for _, e := range domainErrors {
+		if errors.Is(err, e.err) {
+			return &apiError{Status: e.status, Code: e.code, Message: problemDetail(err, e.err)}
+		}
+	}
+	return &apiError{Status: http.StatusInternalServerError, Message: message, Err: err}
+}
+
+// problemDetail is the message of the matched domain error together with the explanation a service
+// wrapped it with as "%w: explanation". Text added around it further up, like "failed to ...: %w",
+// is internal and left out.
+func problemDetail(err, matched error) string {
+	msg := err.Error()
+	i := strings.Index(msg, matched.Error())
+	if i < 0 {
+		return matched.Error()
+	}
+	return msg[i:]
+}
+
+// passwordPolicyError returns a 400 listing every policy violation, or nil when err is not a policy error.
+func passwordPolicyError(err error) *apiError {
+	var policyErr *security.PolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    "password_policy",
+		Message: "Password does not meet the password policy",
+		Details: policyErr.Violations,
+	}
 }
 
 type appHandler func(w http.ResponseWriter, r *http.Request) *apiError
@@ -15,8 +132,32 @@ type appHandler func(w http.ResponseWriter, r *http.Request) *apiError
 // Method allows appHandler to satisfy the http.Handler interface.
 func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := fn(w, r); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(err.Status)
-		json.NewEncoder(w).Encode(err)
+		writeAPIError(w, r, err)
+	}
+}
+
+// writeAPIError answers with the problem of err. Handlers, middleware and chi's own not found and
+// method not allowed responses all go through it.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	requestID, _ := r.Context().Value(RequestIDContextKey).(string)
+	if err.Err != nil {
+		loggerFrom(r.Context()).Error(err.Message, "method", r.Method, "path", r.URL.Path, "error", err.Err)
+	}
+
+	code := err.Code
+	if code == "" {
+		code = statusCodes[err.Status]
 	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(err.Status),
+		Status:    err.Status,
+		Detail:    err.Message,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestID,
+		Errors:    err.Details,
+	})
 }
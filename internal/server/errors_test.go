@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			name:       "domain error",
+			err:        domain.ErrUserNotFound,
+			wantStatus: http.StatusNotFound,
+			wantCode:   "user_not_found",
+			wantDetail: "user not found",
+		},
+		{
+			name:       "explanation is kept",
+			err:        fmt.Errorf("%w: receiver 5", domain.ErrUserNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "user_not_found",
+			wantDetail: "user not found: receiver 5",
+		},
+		{
+			name:       "wrapper text is dropped",
+			err:        fmt.Errorf("failed to get balance: %w", fmt.Errorf("could not read row 7: %w", domain.ErrBalanceNotFound)),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "balance_not_found",
+			wantDetail: "balance not found",
+		},
+		{
+			name:       "wrapped explanation",
+			err:        fmt.Errorf("failed to list: %w", fmt.Errorf("%w: from must be before to", domain.ErrInvalidFilter)),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_filter",
+			wantDetail: "invalid filter: from must be before to",
+		},
+		{
+			name:       "invalid amount",
+			err:        domain.ErrInvalidAmount,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_amount",
+			wantDetail: "amount must be a positive number",
+		},
+		{
+			name:       "internal error",
+			err:        errors.New("dial tcp 10.0.0.3:3306: connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantDetail: "Failed to do it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := errorResponse(tt.err, "Failed to do it")
+			if apiErr.Status != tt.wantStatus || apiErr.Code != tt.wantCode || apiErr.Message != tt.wantDetail {
+				t.Errorf("errorResponse() = %d %q %q, want %d %q %q", apiErr.Status, apiErr.Code, apiErr.Message, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestWriteAPIErrorLogsCauseWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil)).With("request_id", "req-1")
+	ctx := context.WithValue(context.Background(), RequestIDContextKey, "req-1")
+	ctx = context.WithValue(ctx, loggerContextKey, logger)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	writeAPIError(rec, req, errorResponse(errors.New("connection refused"), "Failed to retrieve user"))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not one JSON entry: %q", logs.String())
+	}
+	if entry["request_id"] != "req-1" || entry["error"] != "connection refused" || entry["path"] != "/api/v1/users/me" {
+		t.Errorf("logged %v, want the request ID, path and cause", entry)
+	}
+	if strings.Contains(rec.Body.String(), "connection refused") {
+		t.Errorf("cause was sent to the client: %s", rec.Body.String())
+	}
+}
+
+func TestGRPCErrorCarriesCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *apiError
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{name: "domain error", err: errorResponse(domain.ErrInsufficientFunds, ""), wantCode: codes.FailedPrecondition, wantReason: "insufficient_funds"},
+		{name: "explicit code", err: &apiError{Status: http.StatusUnauthorized, Code: "invalid_api_key", Message: "Invalid API key"}, wantCode: codes.Unauthenticated, wantReason: "invalid_api_key"},
+		{name: "status code", err: &apiError{Status: http.StatusTooManyRequests, Message: "Too many requests"}, wantCode: codes.ResourceExhausted, wantReason: "rate_limited"},
+		{name: "internal error", err: errorResponse(errors.New("connection refused"), "Failed"), wantCode: codes.Internal, wantReason: "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(grpcError(context.Background(), tt.err))
+			if st.Code() != tt.wantCode {
+				t.Errorf("code = %s, want %s", st.Code(), tt.wantCode)
+			}
+			var info *errdetails.ErrorInfo
+			for _, d := range st.Details() {
+				if i, ok := d.(*errdetails.ErrorInfo); ok {
+					info = i
+				}
+			}
+			if info == nil {
+				t.Fatal("status has no ErrorInfo")
+			}
+			if info.Reason != tt.wantReason || info.Domain != grpcErrorDomain {
+				t.Errorf("ErrorInfo = %s/%s, want %s/%s", info.Domain, info.Reason, grpcErrorDomain, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	bankv1 "github.com/yusuf4ktas/backend-project/api/bank/v1"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/ratelimit"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// grpcMethodRule is the gRPC counterpart of the middleware a REST route is registered with.
+type grpcMethodRule struct {
+	// public methods need no credentials.
+	public bool
+	// userOnly methods act on the caller's own account, like routes behind RequireUser.
+	userOnly bool
+	// write methods are refused in read-only impersonation sessions.
+	write      bool
+	permission domain.Permission
+	// ratePolicy overrides the read or write rate limit policy the method gets from write.
+	ratePolicy string
+}
+
+// Methods missing from grpcMethodRules are refused. Checks that depend on the request, such as
+// access to other users' accounts, are made by the method itself as in the REST handlers.
+var grpcMethodRules = map[string]grpcMethodRule{
+	bankv1.UserService_Register_FullMethodName:                {public: true, write: true, ratePolicy: ratePolicyLogin},
+	bankv1.UserService_GetUser_FullMethodName:                 {},
+	bankv1.UserService_ListUsers_FullMethodName:               {permission: domain.PermUsersRead},
+	bankv1.UserService_DeleteUser_FullMethodName:              {write: true},
+	bankv1.TransactionService_Transfer_FullMethodName:         {userOnly: true, write: true, ratePolicy: ratePolicyTransfer},
+	bankv1.TransactionService_Credit_FullMethodName:           {write: true, permission: domain.PermTransactionsCredit, ratePolicy: ratePolicyTransfer},
+	bankv1.TransactionService_Debit_FullMethodName:            {write: true, permission: domain.PermTransactionsDebit, ratePolicy: ratePolicyTransfer},
+	bankv1.TransactionService_GetTransaction_FullMethodName:   {},
+	bankv1.TransactionService_ListTransactions_FullMethodName: {userOnly: true},
+	bankv1.BalanceService_GetBalance_FullMethodName:           {userOnly: true},
+}
+
+var (
+	grpcRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_requests_total",
+		Help: "Total number of gRPC requests.",
+	}, []string{"method", "code"})
+
+	grpcRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_request_duration_seconds",
+		Help:    "Duration of gRPC requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// NewGRPCServer serves the user, transaction and balance APIs over gRPC, with the same
+// authentication, rate limiting, logging and metrics as the REST routes.
+func (s *Server) NewGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		s.grpcRecoveryInterceptor,
+		s.grpcLoggingInterceptor,
+		grpcMetricsInterceptor,
+		s.grpcAuthInterceptor,
+		s.grpcRateLimitInterceptor,
+	))
+
+	bankv1.RegisterUserServiceServer(srv, &grpcUserService{userService: s.userService})
+	bankv1.RegisterTransactionServiceServer(srv, &grpcTransactionService{
+		dispatcher: s.transactionHandler.dispatcher,
+		service:    s.transactionHandler.service,
+	})
+	bankv1.RegisterBalanceServiceServer(srv, &grpcBalanceService{balanceService: s.balanceHandler.balanceService})
+
+	if s.config.Env == "development" {
+		reflection.Register(srv)
+	}
+	return srv
+}
+
+func (s *Server) grpcRecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			s.logger.Error("panic in grpc handler", "method", info.FullMethod, "panic", p, "stack", string(debug.Stack()))
+			err = grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "Internal server error"})
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (s *Server) grpcLoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	requestID := uuid.New().String()
+	ctx = context.WithValue(ctx, RequestIDContextKey, requestID)
+	ctx = context.WithValue(ctx, domain.RequestInfoContextKey, &domain.RequestInfo{
+		RequestID: requestID,
+		IP:        grpcPeerIP(ctx),
+		UserAgent: firstMetadata(ctx, "user-agent"),
+	})
+	ctx = context.WithValue(ctx, loggerContextKey, s.logger.With("request_id", requestID))
+
+	s.logger.Info("incoming grpc request",
+		"id", requestID,
+		"method", info.FullMethod,
+		"peer", grpcPeerIP(ctx),
+	)
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	s.logger.Info("finished grpc request",
+		"id", requestID,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start).String(),
+	)
+	return resp, err
+}
+
+func grpcMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	grpcRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	grpcRequestsTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return resp, err
+}
+
+// grpcRateLimitInterceptor applies the method's policy like RateLimit does for routes. It runs
+// after grpcAuthInterceptor, so that authenticated calls are limited per principal.
+func (s *Server) grpcRateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	rule, ok := grpcMethodRules[info.FullMethod]
+	if !ok {
+		// Only reflection gets here, the auth interceptor refuses other unknown methods.
+		return handler(ctx, req)
+	}
+	name := rule.ratePolicy
+	if name == "" {
+		name = ratePolicyRead
+		if rule.write {
+			name = ratePolicyWrite
+		}
+	}
+	if err := s.allowGRPC(ctx, s.ratePolicies[name], rateLimitKey(ctx, grpcPeerIP(ctx))); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// allowGRPC is allowRequest for gRPC calls, the headers are sent as response metadata.
+func (s *Server) allowGRPC(ctx context.Context, policy ratelimit.Policy, key string) error {
+	result := s.rateLimiter.Allow(ctx, policy, key)
+
+	md := metadata.Pairs(
+		"ratelimit-limit", strconv.Itoa(policy.Burst),
+		"ratelimit-remaining", strconv.Itoa(result.Remaining),
+		"ratelimit-reset", ceilSeconds(result.ResetAfter),
+	)
+	if !result.Allowed {
+		md.Append("retry-after", ceilSeconds(result.RetryAfter))
+	}
+	// Fails only when the headers were already sent, which cannot happen before the handler ran.
+	grpc.SetHeader(ctx, md)
+
+	if !result.Allowed {
+		rateLimitedTotal.WithLabelValues(policy.Name).Inc()
+		return grpcError(ctx, &apiError{Status: http.StatusTooManyRequests, Message: "Too many requests, slow down"})
+	}
+	return nil
+}
+
+// grpcAuthInterceptor authenticates the authorization metadata like AuthMiddleware, then applies
+// the method's rule. Impersonated calls are audited like in ImpersonationMiddleware.
+func (s *Server) grpcAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	// Reflection is only registered in development.
+	if strings.HasPrefix(info.FullMethod, "/grpc.reflection.") {
+		return handler(ctx, req)
+	}
+	rule, ok := grpcMethodRules[info.FullMethod]
+	if !ok {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusForbidden, Message: "Forbidden: This method is not available"})
+	}
+	if rule.public {
+		return handler(ctx, req)
+	}
+
+	principal, err := s.authenticateGRPC(ctx)
+	if err != nil {
+		// Failed attempts count against the login policy, as in AuthMiddleware.
+		if status.Code(err) == codes.Unauthenticated {
+			if limitErr := s.allowGRPC(ctx, s.ratePolicies[ratePolicyLogin], rateLimitKey(ctx, grpcPeerIP(ctx))); limitErr != nil {
+				return nil, limitErr
+			}
+		}
+		return nil, err
+	}
+	ctx = s.withPrincipal(ctx, principal)
+
+	if rule.userOnly && principal.Type != domain.PrincipalUser {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusForbidden, Code: "user_account_required", Message: "Forbidden: This method is only available to user accounts"})
+	}
+	if rule.permission != "" {
+		allowed, err := hasPermission(ctx, rule.permission)
+		if err != nil {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "Failed to retrieve user permissions", Err: err})
+		}
+		if !allowed {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusForbidden, Code: "permission_denied", Message: fmt.Sprintf("Forbidden: This action requires the %s permission", rule.permission)})
+		}
+	}
+
+	if !principal.IsImpersonated() {
+		return handler(ctx, req)
+	}
+
+	var resp interface{}
+	if principal.ReadOnly && rule.write {
+		err = grpcError(ctx, &apiError{Status: http.StatusForbidden, Code: "impersonation_read_only", Message: "Forbidden: This impersonation session is read-only"})
+	} else {
+		resp, err = handler(ctx, req)
+	}
+
+	details := fmt.Sprintf("User %d impersonating user %d: %s responded %s", principal.ImpersonatorID, principal.ID, info.FullMethod, status.Code(err))
+	if _, auditErr := s.auditService.Log(ctx, "user", principal.ID, "impersonated_request", details); auditErr != nil {
+		s.logger.Error("failed to audit impersonated request", "error", auditErr, "actor_id", principal.ImpersonatorID, "subject_id", principal.ID)
+	}
+	return resp, err
+}
+
+func (s *Server) authenticateGRPC(ctx context.Context) (*domain.Principal, error) {
+	authHeader := firstMetadata(ctx, "authorization")
+	if authHeader == "" {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusUnauthorized, Code: "missing_credentials", Message: "Authorization metadata is required"})
+	}
+	headerParts := strings.Split(authHeader, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusUnauthorized, Code: "invalid_authorization_header", Message: "Authorization metadata format must be Bearer {token}"})
+	}
+	tokenString := headerParts[1]
+
+	if strings.HasPrefix(tokenString, service.APIKeyPrefix) {
+		principal, err := s.serviceAccountService.AuthenticateAPIKey(ctx, tokenString)
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidCredentials) {
+				return nil, grpcError(ctx, &apiError{Status: http.StatusUnauthorized, Code: "invalid_api_key", Message: "Invalid, expired or revoked API key"})
+			}
+			return nil, grpcError(ctx, errorResponse(err, "Failed to validate API key"))
+		}
+		return principal, nil
+	}
+
+	principal, authErr := s.authenticateJWT(ctx, tokenString)
+	if authErr != nil {
+		return nil, grpcError(ctx, authErr)
+	}
+	return principal, nil
+}
+
+// grpcErrorDomain is the domain of the ErrorInfo attached to gRPC errors.
+const grpcErrorDomain = "bank.v1"
+
+// grpcError converts the error a REST handler would have answered with. As in writeAPIError, the
+// internal cause is only logged, and the stable code is sent as the reason of an ErrorInfo detail.
+func grpcError(ctx context.Context, err *apiError) error {
+	if err.Err != nil {
+		loggerFrom(ctx).Error(err.Message, "error", err.Err)
+	}
+	code := codes.Internal
+	switch err.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusUnprocessableEntity:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	}
+	reason := err.Code
+	if reason == "" {
+		reason = statusCodes[err.Status]
+	}
+	st := status.New(code, err.Message)
+	if detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: grpcErrorDomain}); detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcPeerIP returns the host part of the client address, without the port.
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
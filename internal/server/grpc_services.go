@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	bankv1 "github.com/yusuf4ktas/backend-project/api/bank/v1"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+	"github.com/yusuf4ktas/backend-project/internal/worker"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The gRPC services mirror the REST handlers of the same operations, including their access checks.
+
+type grpcUserService struct {
+	bankv1.UnimplementedUserServiceServer
+	userService service.UserService
+}
+
+func (s *grpcUserService) Register(ctx context.Context, req *bankv1.RegisterRequest) (*bankv1.User, error) {
+	user, err := s.userService.Register(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to register user"))
+	}
+	return userToProto(user), nil
+}
+
+func (s *grpcUserService) GetUser(ctx context.Context, req *bankv1.GetUserRequest) (*bankv1.User, error) {
+	// Users can always see their own account, anyone else (including service accounts) needs users:read.
+	requestingUserID, isUser := ctx.Value(UserIDContextKey).(int64)
+	if !isUser || requestingUserID != req.GetId() {
+		allowed, err := hasPermission(ctx, domain.PermUsersRead)
+		if err != nil {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "Could not retrieve requesting user's permissions", Err: err})
+		}
+		if !allowed {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusForbidden, Message: "You do not have permission to view this user"})
+		}
+	}
+
+	user, err := s.userService.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to retrieve user"))
+	}
+	return userToProto(user), nil
+}
+
+func (s *grpcUserService) ListUsers(ctx context.Context, req *bankv1.ListUsersRequest) (*bankv1.ListUsersResponse, error) {
+	filter := domain.UserFilter{
+		Search:   strings.TrimSpace(req.GetSearch()),
+		Role:     req.GetRole(),
+		Sort:     req.GetSort(),
+		SortDesc: req.GetSortDesc(),
+		Page:     int(req.GetPage()),
+		PageSize: int(req.GetPageSize()),
+	}
+	if req.CreatedFrom != nil {
+		t := req.CreatedFrom.AsTime()
+		filter.CreatedFrom = &t
+	}
+	if req.CreatedTo != nil {
+		t := req.CreatedTo.AsTime()
+		filter.CreatedTo = &t
+	}
+
+	page, err := s.userService.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to list users"))
+	}
+
+	resp := &bankv1.ListUsersResponse{
+		Total:    page.Total,
+		Page:     int32(page.Page),
+		PageSize: int32(page.PageSize),
+	}
+	for i := range page.Users {
+		resp.Users = append(resp.Users, userToProto(&page.Users[i]))
+	}
+	return resp, nil
+}
+
+func (s *grpcUserService) DeleteUser(ctx context.Context, req *bankv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	// Allow if the user is deleting their own account OR holds the users:delete permission.
+	requestingUserID, isUser := ctx.Value(UserIDContextKey).(int64)
+	if !isUser || requestingUserID != req.GetId() {
+		allowed, err := hasPermission(ctx, domain.PermUsersDelete)
+		if err != nil {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "Could not retrieve requesting user's permissions", Err: err})
+		}
+		if !allowed {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusForbidden, Message: "You do not have permission to delete this user"})
+		}
+	}
+
+	if err := s.userService.Delete(ctx, req.GetId()); err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to delete user"))
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func userToProto(u *domain.User) *bankv1.User {
+	return &bankv1.User{
+		Id:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		Role:      u.Role,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+	}
+}
+
+type grpcTransactionService struct {
+	bankv1.UnimplementedTransactionServiceServer
+	dispatcher *worker.Dispatcher
+	service    service.TransactionService
+}
+
+func (s *grpcTransactionService) Transfer(ctx context.Context, req *bankv1.TransferRequest) (*bankv1.TransferResponse, error) {
+	fromUserID, ok := ctx.Value(UserIDContextKey).(int64)
+	if !ok {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"})
+	}
+	if err := s.service.CheckTransfer(ctx, fromUserID, req.GetToUserId(), req.GetAmount()); err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to check the transfer"))
+	}
+
+	s.dispatcher.AddJob(ctx, worker.Job{
+		FromUserID:      fromUserID,
+		ToUserID:        req.GetToUserId(),
+		Amount:          req.GetAmount(),
+		TransactionType: "transfer",
+	})
+	return &bankv1.TransferResponse{}, nil
+}
+
+func (s *grpcTransactionService) Credit(ctx context.Context, req *bankv1.CreditRequest) (*bankv1.CreditResponse, error) {
+	if err := s.service.CheckCredit(ctx, req.GetUserId(), req.GetAmount()); err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to check the credit"))
+	}
+	s.dispatcher.AddJob(ctx, worker.Job{
+		ToUserID:        req.GetUserId(),
+		Amount:          req.GetAmount(),
+		TransactionType: "credit",
+	})
+	return &bankv1.CreditResponse{}, nil
+}
+
+func (s *grpcTransactionService) Debit(ctx context.Context, req *bankv1.DebitRequest) (*bankv1.DebitResponse, error) {
+	if err := s.service.CheckDebit(ctx, req.GetUserId(), req.GetAmount()); err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to check the debit"))
+	}
+	s.dispatcher.AddJob(ctx, worker.Job{
+		FromUserID:      req.GetUserId(),
+		Amount:          req.GetAmount(),
+		TransactionType: "debit",
+	})
+	return &bankv1.DebitResponse{}, nil
+}
+
+func (s *grpcTransactionService) GetTransaction(ctx context.Context, req *bankv1.GetTransactionRequest) (*bankv1.Transaction, error) {
+	transaction, err := s.service.GetByTransactionID(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to retrieve transaction"))
+	}
+
+	// Participants can always see the transaction, anyone else (including service accounts) needs transactions:read.
+	userID, isUser := ctx.Value(UserIDContextKey).(int64)
+	if !isUser || (transaction.FromUserID != userID && transaction.ToUserID != userID) {
+		allowed, err := hasPermission(ctx, domain.PermTransactionsRead)
+		if err != nil {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "Could not retrieve requesting user's permissions", Err: err})
+		}
+		if !allowed {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusNotFound, Code: "transaction_not_found", Message: domain.ErrTransactionNotFound.Error()})
+		}
+	}
+	return transactionToProto(transaction), nil
+}
+
+func (s *grpcTransactionService) ListTransactions(ctx context.Context, req *bankv1.ListTransactionsRequest) (*bankv1.ListTransactionsResponse, error) {
+	userID, ok := ctx.Value(UserIDContextKey).(int64)
+	if !ok {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"})
+	}
+
+	filter := domain.TransactionFilter{
+		UserID:         userID,
+		Type:           req.GetType(),
+		Status:         domain.TransactionStatus(req.GetStatus()),
+		Direction:      domain.TransactionDirection(req.GetDirection()),
+		CounterpartyID: req.CounterpartyId,
+		MinAmount:      req.MinAmount,
+		MaxAmount:      req.MaxAmount,
+		Limit:          int(req.GetLimit()),
+	}
+	if req.From != nil {
+		t := req.From.AsTime()
+		filter.From = &t
+	}
+	if req.To != nil {
+		t := req.To.AsTime()
+		filter.To = &t
+	}
+	if req.GetCursor() != "" {
+		cursor, err := domain.DecodeTransactionCursor(req.GetCursor())
+		if err != nil {
+			return nil, grpcError(ctx, &apiError{Status: http.StatusBadRequest, Code: "invalid_cursor", Message: "Invalid cursor"})
+		}
+		filter.Cursor = cursor
+	}
+
+	page, err := s.service.GetTransactionHistory(ctx, filter)
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to retrieve transaction history"))
+	}
+
+	resp := &bankv1.ListTransactionsResponse{NextCursor: page.NextCursor}
+	for i := range page.Transactions {
+		resp.Transactions = append(resp.Transactions, transactionToProto(&page.Transactions[i]))
+	}
+	return resp, nil
+}
+
+func transactionToProto(t *domain.Transaction) *bankv1.Transaction {
+	return &bankv1.Transaction{
+		Id:              t.ID,
+		FromUserId:      t.FromUserID,
+		ToUserId:        t.ToUserID,
+		Amount:          t.Amount,
+		TransactionType: t.TransactionType,
+		Status:          string(t.Status),
+		CreatedAt:       timestamppb.New(t.CreatedAt),
+	}
+}
+
+type grpcBalanceService struct {
+	bankv1.UnimplementedBalanceServiceServer
+	balanceService service.BalanceService
+}
+
+func (s *grpcBalanceService) GetBalance(ctx context.Context, req *bankv1.GetBalanceRequest) (*bankv1.Balance, error) {
+	userID, ok := ctx.Value(UserIDContextKey).(int64)
+	if !ok {
+		return nil, grpcError(ctx, &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"})
+	}
+
+	balance, err := s.balanceService.GetCurrent(ctx, userID)
+	if err != nil {
+		return nil, grpcError(ctx, errorResponse(err, "Failed to retrieve balance"))
+	}
+	return &bankv1.Balance{
+		UserId:        balance.UserID,
+		Amount:        balance.Amount,
+		LastUpdatedAt: timestamppb.New(balance.LastUpdatedAt),
+	}, nil
+}
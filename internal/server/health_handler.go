@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/worker"
+)
+
+// HealthHandler serves the probes of Docker Compose and the orchestrator, and the diagnostics
+// behind them for admins.
+type HealthHandler struct {
+	db           *sql.DB
+	rdb          *redis.Client
+	dispatcher   *worker.Dispatcher
+	checkTimeout time.Duration
+	startedAt    time.Time
+	draining     atomic.Bool
+}
+
+func NewHealthHandler(db *sql.DB, rdb *redis.Client, dispatcher *worker.Dispatcher, checkTimeout time.Duration) *HealthHandler {
+	return &HealthHandler{
+		db:           db,
+		rdb:          rdb,
+		dispatcher:   dispatcher,
+		checkTimeout: checkTimeout,
+		startedAt:    time.Now(),
+	}
+}
+
+// Drain makes the readiness probe fail from now on. It is called when the graceful shutdown begins.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+
+	err error
+}
+
+// runChecks runs every dependency check concurrently, each limited to the check timeout.
+func (h *HealthHandler) runChecks(ctx context.Context) (map[string]*checkResult, bool) {
+	checks := map[string]func(context.Context) error{
+		"mysql": h.db.PingContext,
+		"redis": func(ctx context.Context) error {
+			return h.rdb.Ping(ctx).Err()
+		},
+		"worker_pool": func(context.Context) error {
+			if stats := h.dispatcher.Stats(); stats.Saturated() {
+				return fmt.Errorf("job queue is full (%d/%d)", stats.QueuedJobs, stats.QueueCapacity)
+			}
+			return nil
+		},
+	}
+
+	results := make(map[string]*checkResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, h.checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := &checkResult{Status: "up", DurationMS: time.Since(start).Milliseconds(), err: err}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, result := range results {
+		healthy = healthy && result.err == nil
+	}
+	return results, healthy
+}
+
+// Liveness only reports that the process serves requests. Failing dependencies are left to the
+// readiness probe, restarting the server would not fix them.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) *apiError {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	return nil
+}
+
+// Readiness reports whether the server should receive traffic: MySQL and Redis respond, the job
+// queue has room and no shutdown is under way. Failed checks only name the kind of failure, the
+// causes are logged and shown in the diagnostics.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) *apiError {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if h.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "draining"})
+		return nil
+	}
+
+	results, healthy := h.runChecks(r.Context())
+	for name, result := range results {
+		if result.err == nil {
+			continue
+		}
+		loggerFrom(r.Context()).Error("readiness check failed", "check", name, "error", result.err)
+		result.Error = "check failed"
+		if errors.Is(result.err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("check timed out after %s", h.checkTimeout)
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	if !healthy {
+		status, code = "unready", http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+	return nil
+}
+
+type dbPoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMS     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+type redisPoolStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// Diagnostics shows the checks with their errors, along with the connection and worker pools.
+func (h *HealthHandler) Diagnostics(w http.ResponseWriter, r *http.Request) *apiError {
+	results, healthy := h.runChecks(r.Context())
+	status := "ready"
+	switch {
+	case h.draining.Load():
+		status = "draining"
+	case !healthy:
+		status = "unready"
+	}
+
+	dbStats := h.db.Stats()
+	redisStats := h.rdb.PoolStats()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         status,
+		"uptime_seconds": int64(time.Since(h.startedAt).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"checks":         results,
+		"mysql_pool": dbPoolStats{
+			MaxOpenConnections: dbStats.MaxOpenConnections,
+			OpenConnections:    dbStats.OpenConnections,
+			InUse:              dbStats.InUse,
+			Idle:               dbStats.Idle,
+			WaitCount:          dbStats.WaitCount,
+			WaitDurationMS:     dbStats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      dbStats.MaxIdleClosed,
+			MaxIdleTimeClosed:  dbStats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  dbStats.MaxLifetimeClosed,
+		},
+		"redis_pool": redisPoolStats{
+			Hits:       redisStats.Hits,
+			Misses:     redisStats.Misses,
+			Timeouts:   redisStats.Timeouts,
+			TotalConns: redisStats.TotalConns,
+			IdleConns:  redisStats.IdleConns,
+			StaleConns: redisStats.StaleConns,
+		},
+		"worker_pool": h.dispatcher.Stats(),
+	})
+	return nil
+}
@@ -2,8 +2,12 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -15,7 +19,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"golang.org/x/time/rate"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
 )
 
 // Creating a custom type context key to avoid collisions.
@@ -23,11 +28,31 @@ type contextKey string
 
 const UserIDContextKey = contextKey("userID")
 const RequestIDContextKey = contextKey("requestID")
+const PermissionsContextKey = contextKey("permissions")
+const PrincipalContextKey = domain.PrincipalContextKey
+
+// loggerContextKey holds the logger of a request, which carries its request ID.
+const loggerContextKey = contextKey("logger")
+
+// loggerFrom returns the logger of the request in ctx, or the default logger outside of requests.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
 
 func (s *Server) RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requestID := uuid.New().String()
 		ctx := context.WithValue(r.Context(), RequestIDContextKey, requestID)
+		// Services record the request in the audit log.
+		ctx = context.WithValue(ctx, domain.RequestInfoContextKey, &domain.RequestInfo{
+			RequestID: requestID,
+			IP:        clientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+		ctx = context.WithValue(ctx, loggerContextKey, s.logger.With("request_id", requestID))
 
 		s.logger.Info("incoming request",
 			"id", requestID,
@@ -49,102 +74,217 @@ func (s *Server) RequestLogger(next http.Handler) http.Handler {
 	})
 }
 
-func RateLimiter(next http.Handler) http.Handler {
-	clients := make(map[string]*rate.Limiter)
-	var mu sync.Mutex // Use a mutex to safely access the map concurrently.
+// clientIP returns the host part of the remote address, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
 
+// Recoverer answers a panicking request with a 500 problem and logs the panic, like
+// grpcRecoveryInterceptor does for gRPC calls.
+func (s *Server) Recoverer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the IP address for the current user.
-		ip := r.RemoteAddr
-
-		// --- Optional improvement ---
-		// For the case when needed only the host (IP) part without the port:
-		//
-		// host, _, err := net.SplitHostPort(r.RemoteAddr)
-		// if err == nil {
-		//     ip = host
-		// }
-		// -------------------------------------------------------
-
-		mu.Lock()
-		// Checking if there is a limiter for the IP address yet.
-		if _, found := clients[ip]; !found {
-			// Creating a new limiter that allows 1 request per second, with a burst of 7
-			clients[ip] = rate.NewLimiter(1, 7)
-		}
-
-		if !clients[ip].Allow() {
-			mu.Unlock()
-			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
-			return
-		}
-		mu.Unlock()
-
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// Aborted on purpose, the connection is closed without a response.
+				panic(p)
+			}
+			s.logger.Error("panic in http handler", "method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+			writeAPIError(w, r, &apiError{Status: http.StatusInternalServerError, Message: "Internal server error"})
+		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
+// AuthMiddleware accepts both JWTs (issued to users or through the client_credentials grant)
+// and service account API keys, and stores the resulting principal in the request context.
+// Failed attempts count against the login policy of the client IP, so that credentials cannot
+// be guessed faster than passwords.
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+		principal, authErr := s.authenticateRequest(r)
+		if authErr != nil {
+			if authErr.Status == http.StatusUnauthorized && !s.allowRequest(w, r, s.ratePolicies[ratePolicyLogin], rateLimitKey(r.Context(), clientIP(r))) {
+				return
+			}
+			writeAPIError(w, r, authErr)
 			return
 		}
 
-		// Extracting the token from the "Bearer <token>" format
-		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
-			return
-		}
-		tokenString := headerParts[1]
+		next.ServeHTTP(w, r.WithContext(s.withPrincipal(r.Context(), principal)))
+	})
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+func (s *Server) authenticateRequest(r *http.Request) (*domain.Principal, *apiError) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "missing_credentials", Message: "Authorization header is required"}
+	}
+
+	// Extracting the token from the "Bearer <token>" format
+	headerParts := strings.Split(authHeader, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_authorization_header", Message: "Authorization header format must be Bearer {token}"}
+	}
+	tokenString := headerParts[1]
+
+	if strings.HasPrefix(tokenString, service.APIKeyPrefix) {
+		principal, err := s.serviceAccountService.AuthenticateAPIKey(r.Context(), tokenString)
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidCredentials) {
+				return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_api_key", Message: "Invalid, expired or revoked API key"}
 			}
-			return s.jwtSecret, nil
-		})
+			return nil, errorResponse(err, "Failed to validate API key")
+		}
+		return principal, nil
+	}
+	return s.authenticateJWT(r.Context(), tokenString)
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
+func (s *Server) authenticateJWT(ctx context.Context, tokenString string) (*domain.Principal, *apiError) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
+		return s.jwtSecret, nil
+	})
 
-		// Extract user ID from claims and add it to the request context.
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if userIDFloat, ok := claims["sub"].(float64); ok {
-				userID := int64(userIDFloat)
-				// Creating new context with the user ID
-				ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
+	if err != nil || !token.Valid {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid or expired token"}
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid token claims"}
+	}
+	subFloat, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid token claims"}
+	}
+	subject := int64(subFloat)
+
+	// Tokens from the client_credentials grant belong to a service account and carry their scopes.
+	if typ, _ := claims["typ"].(string); typ == string(domain.PrincipalService) {
+		if _, err := s.serviceAccountService.GetByID(ctx, subject); err != nil {
+			if errors.Is(err, domain.ErrServiceAccountNotFound) {
+				return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Service account no longer exists"}
 			}
+			return nil, errorResponse(err, "Failed to validate token")
+		}
+		scope, _ := claims["scope"].(string)
+		scopes := []domain.Permission{}
+		for _, part := range strings.Fields(scope) {
+			scopes = append(scopes, domain.Permission(part))
+		}
+		return &domain.Principal{Type: domain.PrincipalService, ID: subject, Scopes: scopes}, nil
+	}
+
+	// User tokens are only valid as long as their session has not been revoked.
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid token claims"}
+	}
+	session, err := s.sessionService.Validate(ctx, sessionID, subject)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) || errors.Is(err, domain.ErrSessionInactive) {
+			return nil, &apiError{Status: http.StatusUnauthorized, Code: "session_inactive", Message: "Session has been revoked or has expired"}
 		}
+		return nil, errorResponse(err, "Failed to validate token")
+	}
+
+	principal := &domain.Principal{Type: domain.PrincipalUser, ID: subject, SessionID: sessionID}
+
+	// Impersonation tokens carry the admin in an RFC 8693 style "act" claim,
+	// which has to match the actor recorded on the session.
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		actorFloat, ok := act["sub"].(float64)
+		if !ok || session.ImpersonatorID == nil || *session.ImpersonatorID != int64(actorFloat) {
+			return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid token claims"}
+		}
+		principal.ImpersonatorID = int64(actorFloat)
+		principal.ReadOnly = claims["mode"] != impersonationReadWrite
+	} else if session.ImpersonatorID != nil {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Invalid token claims"}
+	}
+
+	return principal, nil
+}
+
+// withPrincipal stores the principal and its lazily loaded permissions in the context.
+// UserIDContextKey is only set for user principals.
+func (s *Server) withPrincipal(ctx context.Context, principal *domain.Principal) context.Context {
+	ctx = context.WithValue(ctx, PrincipalContextKey, principal)
+
+	if principal.Type == domain.PrincipalService {
+		return context.WithValue(ctx, PermissionsContextKey, &requestPermissions{
+			load: func() ([]domain.Permission, error) {
+				return principal.Scopes, nil
+			},
+		})
+	}
 
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	ctx = context.WithValue(ctx, UserIDContextKey, principal.ID)
+	return context.WithValue(ctx, PermissionsContextKey, &requestPermissions{
+		load: func() ([]domain.Permission, error) {
+			return s.roleService.GetUserPermissions(ctx, principal.ID)
+		},
 	})
 }
 
-// AdminOnlyMiddleware is a guard that only allows users with the 'admin' role to proceed.
-func (s *Server) AdminOnlyMiddleware(next http.Handler) http.Handler {
+// RequireUser rejects service principals from endpoints that act on the caller's own account.
+func (s *Server) RequireUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//Get the UserID from the context that was set by the AuthMiddleware.
-		userID, ok := r.Context().Value(UserIDContextKey).(int64)
-		if !ok {
-			http.Error(w, "User ID not found in context", http.StatusInternalServerError)
+		principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+		if !ok || principal.Type != domain.PrincipalUser {
+			writeAPIError(w, r, &apiError{Status: http.StatusForbidden, Code: "user_account_required", Message: "This endpoint is only available to user accounts"})
 			return
 		}
 
-		user, err := s.userService.GetByID(r.Context(), userID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve user information", http.StatusInternalServerError)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ImpersonationMiddleware marks responses to impersonated requests, blocks writes in read-only
+// mode and records every impersonated request in the audit log with both the admin and user IDs.
+func (s *Server) ImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+		if !ok || !principal.IsImpersonated() {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		if user.Role != "admin" {
-			http.Error(w, "Forbidden: This action requires admin privileges", http.StatusForbidden)
+		w.Header().Set("X-Impersonated-By", strconv.FormatInt(principal.ImpersonatorID, 10))
+
+		rw := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		readOnlyViolation := principal.ReadOnly && !isSafeMethod(r.Method)
+		if readOnlyViolation {
+			writeAPIError(rw, r, &apiError{Status: http.StatusForbidden, Code: "impersonation_read_only", Message: "This impersonation session is read-only"})
+		} else {
+			next.ServeHTTP(rw, r)
+		}
+
+		details := fmt.Sprintf("User %d impersonating user %d: %s %s responded %d", principal.ImpersonatorID, principal.ID, r.Method, r.URL.Path, rw.Status())
+		if _, err := s.auditService.Log(r.Context(), "user", principal.ID, "impersonated_request", details); err != nil {
+			s.logger.Error("failed to audit impersonated request", "error", err, "actor_id", principal.ImpersonatorID, "subject_id", principal.ID)
+		}
+	})
+}
+
+// DenyImpersonation guards endpoints that must never be used while impersonating,
+// such as changing credentials or starting another impersonation.
+func (s *Server) DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+		if ok && principal.IsImpersonated() {
+			writeAPIError(w, r, &apiError{Status: http.StatusForbidden, Code: "impersonation_not_allowed", Message: "This action is not available while impersonating"})
 			return
 		}
 
@@ -152,6 +292,71 @@ func (s *Server) AdminOnlyMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// requestPermissions lazily loads the permissions of the authenticated user,
+// so they are fetched at most once per request no matter how many checks run.
+type requestPermissions struct {
+	once  sync.Once
+	load  func() ([]domain.Permission, error)
+	perms map[domain.Permission]bool
+	err   error
+}
+
+func (p *requestPermissions) has(perm domain.Permission) (bool, error) {
+	p.once.Do(func() {
+		perms, err := p.load()
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.perms = make(map[domain.Permission]bool, len(perms))
+		for _, granted := range perms {
+			p.perms[granted] = true
+		}
+	})
+	if p.err != nil {
+		return false, p.err
+	}
+	return p.perms[perm], nil
+}
+
+// hasPermission reports whether the authenticated user of the request holds the permission.
+func hasPermission(ctx context.Context, perm domain.Permission) (bool, error) {
+	p, ok := ctx.Value(PermissionsContextKey).(*requestPermissions)
+	if !ok {
+		return false, errors.New("permissions not found in context")
+	}
+	return p.has(perm)
+}
+
+// RequirePermission only allows users holding all the given permissions to proceed.
+func (s *Server) RequirePermission(perms ...domain.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, perm := range perms {
+				allowed, err := hasPermission(r.Context(), perm)
+				if err != nil {
+					writeAPIError(w, r, errorResponse(err, "Failed to retrieve user permissions"))
+					return
+				}
+				if !allowed {
+					writeAPIError(w, r, &apiError{
+						Status:  http.StatusForbidden,
+						Code:    "permission_denied",
+						Message: fmt.Sprintf("This action requires the %s permission", perm),
+					})
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 var (
 	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
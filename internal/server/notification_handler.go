@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+type NotificationHandler struct {
+	service service.NotificationService
+}
+
+func NewNotificationHandler(s service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{service: s}
+}
+
+// List returns the user's notifications newest first, only the unread ones with unread=true.
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	q := r.URL.Query()
+	filter := domain.NotificationFilter{UserID: userID}
+	if v := q.Get("unread"); v != "" {
+		unread, err := strconv.ParseBool(v)
+		if err != nil {
+			return &apiError{Status: http.StatusBadRequest, Message: "Invalid unread, must be true or false"}
+		}
+		filter.UnreadOnly = unread
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return &apiError{Status: http.StatusBadRequest, Message: "Invalid limit"}
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := domain.DecodeNotificationCursor(v)
+		if err != nil {
+			return &apiError{Status: http.StatusBadRequest, Message: "Invalid cursor"}
+		}
+		filter.Cursor = cursor
+	}
+
+	page, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve notifications")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+	return nil
+}
+
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	count, err := h.service.CountUnread(r.Context(), userID)
+	if err != nil {
+		return errorResponse(err, "Failed to count notifications")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"unread": count})
+	return nil
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid notification ID format"}
+	}
+
+	if err := h.service.MarkRead(r.Context(), userID, id); err != nil {
+		return errorResponse(err, "Failed to mark notification as read")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	updated, err := h.service.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		return errorResponse(err, "Failed to mark notifications as read")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int64{"updated": updated})
+	return nil
+}
+
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	prefs, err := h.service.GetPreferences(r.Context(), userID)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve notification preferences")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(prefs)
+	return nil
+}
+
+// UpdatePreferences changes the types in the request, the others keep their setting.
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	var req domain.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	prefs, err := h.service.UpdatePreferences(r.Context(), userID, req.Email)
+	if err != nil {
+		return errorResponse(err, "Failed to update notification preferences")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(prefs)
+	return nil
+}
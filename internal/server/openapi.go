@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/yusuf4ktas/backend-project/api"
+)
+
+// apiSpec is the parsed api.OpenAPISpec together with the router finding its operations.
+type apiSpec struct {
+	doc    *openapi3.T
+	router routers.Router
+}
+
+// loadAPISpec parses and validates the embedded OpenAPI document. It is part of the binary, so
+// an invalid document is a programming error.
+func loadAPISpec() *apiSpec {
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPISpec)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse the OpenAPI document: %v", err))
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		panic(fmt.Sprintf("failed to route the OpenAPI document: %v", err))
+	}
+	return &apiSpec{doc: doc, router: router}
+}
+
+func (s *Server) ServeOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(api.OpenAPISpec)
+}
+
+// ValidateRequest rejects requests whose parameters or JSON body do not match the OpenAPI
+// document, listing every mismatch in the problem's errors. Other bodies, the XML payment files
+// and the OAuth token form, are left to their handlers.
+// Credentials are checked by AuthMiddleware, not here.
+//
+// In development the responses are checked as well, mismatches are logged.
+func (s *Server) ValidateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := s.apiSpec.router.FindRoute(r)
+		if err != nil {
+			// Unknown routes and methods are answered by chi.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:          true,
+				SkipSettingDefaults: true,
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+				ExcludeRequestBody:  !hasJSONBody(route.Operation),
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeAPIError(w, r, &apiError{
+				Status:  http.StatusBadRequest,
+				Code:    "validation_failed",
+				Message: "Request does not match the API specification",
+				Details: validationErrors(err),
+			})
+			return
+		}
+
+		if s.config.Env != "development" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &jsonResponseBody{header: w.Header()}
+		rw := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		rw.Tee(body)
+		next.ServeHTTP(rw, r)
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rw.Status(),
+			Header:                 w.Header(),
+			Options: &openapi3filter.Options{
+				MultiError:            true,
+				IncludeResponseStatus: true,
+				ExcludeResponseBody:   body.skip,
+			},
+		}
+		responseInput.SetBodyBytes(body.buf.Bytes())
+		if err := openapi3filter.ValidateResponse(r.Context(), responseInput); err != nil {
+			s.logger.Warn("response does not match the API specification",
+				"method", r.Method,
+				"path", route.Path,
+				"status", rw.Status(),
+				"errors", validationErrors(err),
+			)
+		}
+	})
+}
+
+func hasJSONBody(op *openapi3.Operation) bool {
+	return op.RequestBody != nil && op.RequestBody.Value.Content.Get("application/json") != nil
+}
+
+// jsonResponseBody keeps a copy of JSON responses. Anything else, such as statement downloads
+// and event streams, is only checked for its status.
+type jsonResponseBody struct {
+	header  http.Header
+	checked bool
+	skip    bool
+	buf     bytes.Buffer
+}
+
+func (b *jsonResponseBody) Write(p []byte) (int, error) {
+	if !b.checked {
+		b.checked = true
+		mediaType, _, _ := mime.ParseMediaType(b.header.Get("Content-Type"))
+		b.skip = mediaType != "application/json" && mediaType != "application/problem+json"
+	}
+	if !b.skip {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// validationErrors lists the mismatches of a validation error, one per parameter or body field.
+func validationErrors(err error) []string {
+	if multi, ok := err.(openapi3.MultiError); ok {
+		var list []string
+		for _, e := range multi {
+			list = append(list, validationErrors(e)...)
+		}
+		return list
+	}
+
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		var where string
+		switch {
+		case requestErr.Parameter != nil:
+			where = fmt.Sprintf("%s parameter %q", requestErr.Parameter.In, requestErr.Parameter.Name)
+		case requestErr.RequestBody != nil:
+			where = "request body"
+		}
+		if requestErr.Err == nil {
+			return []string{strings.TrimPrefix(where+": "+requestErr.Reason, ": ")}
+		}
+		var list []string
+		for _, reason := range validationErrors(requestErr.Err) {
+			list = append(list, strings.TrimPrefix(where+": "+reason, ": "))
+		}
+		return list
+	}
+
+	var responseErr *openapi3filter.ResponseError
+	if errors.As(err, &responseErr) {
+		if responseErr.Err == nil {
+			return []string{responseErr.Reason}
+		}
+		var list []string
+		for _, reason := range validationErrors(responseErr.Err) {
+			list = append(list, responseErr.Reason+": "+reason)
+		}
+		return list
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if field := strings.Join(schemaErr.JSONPointer(), "."); field != "" {
+			return []string{fmt.Sprintf("%s: %s", field, schemaErr.Reason)}
+		}
+		return []string{schemaErr.Reason}
+	}
+	return []string{err.Error()}
+}
+
+// CheckRoutes compares the registered routes with the operations of the OpenAPI document, so
+// that neither can change without the other.
+func (s *Server) CheckRoutes() error {
+	routes, ok := s.router.(chi.Routes)
+	if !ok {
+		return errors.New("router does not expose its routes")
+	}
+
+	registered := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range s.apiSpec.doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	var problems []string
+	for route := range registered {
+		if !documented[route] {
+			problems = append(problems, route+" is not documented")
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			problems = append(problems, route+" is documented but not registered")
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
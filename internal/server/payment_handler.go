@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/iso20022"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+	"github.com/yusuf4ktas/backend-project/internal/worker"
+)
+
+// Largest payment file accepted for import.
+const maxPaymentFileSize = 10 << 20
+
+type PaymentHandler struct {
+	dispatcher *worker.Dispatcher
+	service    service.PaymentImportService
+}
+
+func NewPaymentHandler(d *worker.Dispatcher, s service.PaymentImportService) *PaymentHandler {
+	return &PaymentHandler{
+		dispatcher: d,
+		service:    s,
+	}
+}
+
+// ImportPain001 queues the credit transfers of an uploaded pain.001 file and answers with a pain.002
+// status report. Users may pay from their own account, payments:import allows any debtor account.
+func (h *PaymentHandler) ImportPain001(w http.ResponseWriter, r *http.Request) *apiError {
+	principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Principal not found in context"}
+	}
+
+	anyDebtor, err := hasPermission(r.Context(), domain.PermPaymentsImport)
+	if err != nil {
+		return errorResponse(err, "Could not retrieve requesting user's permissions")
+	}
+	if !anyDebtor && principal.Type != domain.PrincipalUser {
+		return &apiError{Status: http.StatusForbidden, Code: "permission_denied", Message: "Importing payments for other accounts requires the " + string(domain.PermPaymentsImport) + " permission"}
+	}
+
+	doc, err := iso20022.ParsePain001(http.MaxBytesReader(w, r.Body, maxPaymentFileSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return &apiError{Status: http.StatusRequestEntityTooLarge, Message: "Payment file is too large"}
+		}
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_payment_file", Message: err.Error()}
+	}
+
+	report, instructions, err := h.service.ImportPain001(r.Context(), principal, anyDebtor, doc)
+	if err != nil {
+		return errorResponse(err, "Failed to import payment file")
+	}
+
+	// Accepted transfers are booked by the worker pool like any other transfer, their outcome
+	// shows up in the transaction history.
+	for _, instruction := range instructions {
+		h.dispatcher.AddJob(r.Context(), worker.Job{
+			FromUserID:      instruction.FromUserID,
+			ToUserID:        instruction.ToUserID,
+			Amount:          instruction.Amount,
+			TransactionType: "transfer",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	if err := report.Encode(w); err != nil {
+		loggerFrom(r.Context()).Error("failed to write pain.002 report", "error", err)
+	}
+	return nil
+}
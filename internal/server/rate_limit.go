@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yusuf4ktas/backend-project/internal/config"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/ratelimit"
+)
+
+const (
+	ratePolicyLogin    = "login"
+	ratePolicyTransfer = "transfer"
+	ratePolicyRead     = "read"
+	ratePolicyWrite    = "write"
+)
+
+// routeRatePolicies assigns routes to a policy. Other GET routes use the read policy, the rest
+// the write policy.
+var routeRatePolicies = map[string]string{
+	"POST /api/v1/auth/register":               ratePolicyLogin,
+	"POST /api/v1/auth/login":                  ratePolicyLogin,
+	"POST /api/v1/auth/verify-email":           ratePolicyLogin,
+	"POST /api/v1/auth/password-reset":         ratePolicyLogin,
+	"POST /api/v1/auth/password-reset/confirm": ratePolicyLogin,
+	"POST /api/v1/oauth/token":                 ratePolicyLogin,
+	"POST /api/v1/transactions/transfer":       ratePolicyTransfer,
+	"POST /api/v1/transactions/credit":         ratePolicyTransfer,
+	"POST /api/v1/transactions/debit":          ratePolicyTransfer,
+	"POST /api/v1/payments/pain001":            ratePolicyTransfer,
+}
+
+var rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limited_requests_total",
+	Help: "Total number of requests refused by the rate limiter.",
+}, []string{"policy"})
+
+func ratePolicies(cfg *config.Config) map[string]ratelimit.Policy {
+	policy := func(name string, p config.RateLimitPolicy) ratelimit.Policy {
+		return ratelimit.Policy{Name: name, Limit: p.PerMinute, Period: time.Minute, Burst: p.Burst}
+	}
+	return map[string]ratelimit.Policy{
+		ratePolicyLogin:    policy(ratePolicyLogin, cfg.RateLimit.Login),
+		ratePolicyTransfer: policy(ratePolicyTransfer, cfg.RateLimit.Transfer),
+		ratePolicyRead:     policy(ratePolicyRead, cfg.RateLimit.Read),
+		ratePolicyWrite:    policy(ratePolicyWrite, cfg.RateLimit.Write),
+	}
+}
+
+// rateLimitKey identifies the client: the principal once authenticated, whichever address it
+// calls from, and the IP address otherwise. Impersonated requests count against the user.
+func rateLimitKey(ctx context.Context, ip string) string {
+	if principal, ok := domain.PrincipalFromContext(ctx); ok {
+		return fmt.Sprintf("%s:%d", principal.Type, principal.ID)
+	}
+	return "ip:" + ip
+}
+
+// RateLimit counts the request against the policy of its route. It looks the route up, so it
+// has to be used in a route group rather than on the router itself.
+func (s *Server) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := routeRatePolicies[r.Method+" "+chi.RouteContext(r.Context()).RoutePattern()]
+		if !ok {
+			name = ratePolicyWrite
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				name = ratePolicyRead
+			}
+		}
+		if s.allowRequest(w, r, s.ratePolicies[name], rateLimitKey(r.Context(), clientIP(r))) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowRequest sets the RateLimit headers of the IETF draft, and answers with a 429 and
+// Retry-After when the request is refused.
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, policy ratelimit.Policy, key string) bool {
+	result := s.rateLimiter.Allow(r.Context(), policy, key)
+
+	header := w.Header()
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d;policy=%q", policy.Limit, int(policy.Period.Seconds()), policy.Burst, policy.Name))
+	header.Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+	if result.Allowed {
+		return true
+	}
+
+	rateLimitedTotal.WithLabelValues(policy.Name).Inc()
+	header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+	writeAPIError(w, r, &apiError{Status: http.StatusTooManyRequests, Message: "Too many requests, slow down"})
+	return false
+}
+
+// ceilSeconds rounds up, so that a client waiting as long as told is not refused again.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+type RoleHandler struct {
+	roleService service.RoleService
+}
+
+func NewRoleHandler(roleService service.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
+
+type assignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) *apiError {
+	roles, err := h.roleService.ListRoles(r.Context())
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve roles")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(roles)
+	return nil
+}
+
+func (h *RoleHandler) AssignRole(w http.ResponseWriter, r *http.Request) *apiError {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid user ID format"}
+	}
+
+	var req assignRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	user, err := h.roleService.AssignRole(r.Context(), userID, req.Role)
+	if err != nil {
+		return errorResponse(err, "Failed to assign role")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+	return nil
+}
@@ -5,35 +5,70 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/yusuf4ktas/backend-project/internal/config"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/ratelimit"
 	"github.com/yusuf4ktas/backend-project/internal/service"
 )
 
 type Server struct {
-	config             *config.Config
-	logger             *slog.Logger
-	jwtSecret          []byte
-	router             http.Handler
-	userService        service.UserService
-	userHandler        *UserHandler
-	transactionHandler *TransactionHandler
-	authHandler        *AuthHandler
-	balanceHandler     *BalanceHandler
+	config                *config.Config
+	logger                *slog.Logger
+	jwtSecret             []byte
+	router                http.Handler
+	apiSpec               *apiSpec
+	userService           service.UserService
+	roleService           service.RoleService
+	serviceAccountService service.ServiceAccountService
+	sessionService        service.SessionService
+	auditService          service.AuditLogService
+	userHandler           *UserHandler
+	transactionHandler    *TransactionHandler
+	authHandler           *AuthHandler
+	balanceHandler        *BalanceHandler
+	roleHandler           *RoleHandler
+	serviceAccountHandler *ServiceAccountHandler
+	sessionHandler        *SessionHandler
+	statementHandler      *StatementHandler
+	paymentHandler        *PaymentHandler
+	auditHandler          *AuditHandler
+	webhookHandler        *WebhookHandler
+	streamHandler         *StreamHandler
+	notificationHandler   *NotificationHandler
+	healthHandler         *HealthHandler
+	rateLimiter           ratelimit.Limiter
+	ratePolicies          map[string]ratelimit.Policy
 }
 
-func NewServer(config *config.Config, logger *slog.Logger, userService service.UserService, userHandler *UserHandler, txHandler *TransactionHandler, authHandler *AuthHandler, balanceHandler *BalanceHandler) *Server { // MODIFIED
+func NewServer(config *config.Config, logger *slog.Logger, userService service.UserService, roleService service.RoleService, serviceAccountService service.ServiceAccountService, sessionService service.SessionService, auditService service.AuditLogService, userHandler *UserHandler, txHandler *TransactionHandler, authHandler *AuthHandler, balanceHandler *BalanceHandler, roleHandler *RoleHandler, serviceAccountHandler *ServiceAccountHandler, sessionHandler *SessionHandler, statementHandler *StatementHandler, paymentHandler *PaymentHandler, auditHandler *AuditHandler, webhookHandler *WebhookHandler, streamHandler *StreamHandler, notificationHandler *NotificationHandler, healthHandler *HealthHandler, rateLimiter ratelimit.Limiter) *Server {
 	s := &Server{
-		config:             config,
-		logger:             logger,
-		userService:        userService,
-		userHandler:        userHandler,
-		transactionHandler: txHandler,
-		authHandler:        authHandler,
-		balanceHandler:     balanceHandler,
-		jwtSecret:          []byte(config.JWTSecret),
+		config:                config,
+		logger:                logger,
+		userService:           userService,
+		roleService:           roleService,
+		serviceAccountService: serviceAccountService,
+		sessionService:        sessionService,
+		auditService:          auditService,
+		userHandler:           userHandler,
+		transactionHandler:    txHandler,
+		authHandler:           authHandler,
+		balanceHandler:        balanceHandler,
+		roleHandler:           roleHandler,
+		serviceAccountHandler: serviceAccountHandler,
+		sessionHandler:        sessionHandler,
+		statementHandler:      statementHandler,
+		paymentHandler:        paymentHandler,
+		auditHandler:          auditHandler,
+		webhookHandler:        webhookHandler,
+		streamHandler:         streamHandler,
+		notificationHandler:   notificationHandler,
+		healthHandler:         healthHandler,
+		rateLimiter:           rateLimiter,
+		ratePolicies:          ratePolicies(config),
+		jwtSecret:             []byte(config.JWTSecret),
+		apiSpec:               loadAPISpec(),
 	}
 	s.router = s.setupRoutes()
 	return s
@@ -45,42 +80,121 @@ func (s *Server) setupRoutes() http.Handler {
 	//CORS header setup
 	router.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // Any path like frontend etc. can be added to AllowedOrigins.
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Impersonated-By", "Content-Disposition", "Location", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		AllowCredentials: true,
 	}).Handler)
 
 	router.Use(s.RequestLogger)
 	router.Use(s.PrometheusMiddleware)
-	router.Use(RateLimiter)
-	router.Use(middleware.Recoverer)
+	router.Use(s.Recoverer)
+
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, r, &apiError{Status: http.StatusNotFound, Message: "No route matches the request path"})
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, r, &apiError{Status: http.StatusMethodNotAllowed, Message: "The route does not support the request method"})
+	})
 
 	// --- Public Routes ---
+	// Probes and scrapes are not rate limited, they come from the infrastructure.
 	router.Get("/metrics", promhttp.Handler().ServeHTTP)
-	router.Post("/api/v1/auth/register", appHandler(s.userHandler.Register).ServeHTTP)
-	router.Post("/api/v1/auth/login", appHandler(s.authHandler.Login).ServeHTTP)
+	router.Get("/healthz", appHandler(s.healthHandler.Liveness).ServeHTTP)
+	router.Get("/readyz", appHandler(s.healthHandler.Readiness).ServeHTTP)
+	router.With(s.RateLimit).Get("/api/v1/openapi.json", s.ServeOpenAPISpec)
+	router.Group(func(r chi.Router) {
+		r.Use(s.RateLimit)
+		r.Use(s.ValidateRequest)
+
+		r.Post("/api/v1/auth/register", appHandler(s.userHandler.Register).ServeHTTP)
+		r.Post("/api/v1/auth/login", appHandler(s.authHandler.Login).ServeHTTP)
+		r.Post("/api/v1/auth/verify-email", appHandler(s.authHandler.VerifyEmail).ServeHTTP)
+		r.Post("/api/v1/auth/password-reset", appHandler(s.authHandler.RequestPasswordReset).ServeHTTP)
+		r.Post("/api/v1/auth/password-reset/confirm", appHandler(s.authHandler.ConfirmPasswordReset).ServeHTTP)
+		r.Post("/api/v1/oauth/token", appHandler(s.authHandler.Token).ServeHTTP)
+	})
 
 	// --- Protected Routes ---
 	// All routes in this group require a valid token (AuthMiddleware).
+	// Requests are rate limited per principal and validated against the OpenAPI document once
+	// they are authenticated.
 	router.Group(func(r chi.Router) {
 		r.Use(s.AuthMiddleware)
+		r.Use(s.RateLimit)
+		r.Use(s.ImpersonationMiddleware)
+		r.Use(s.ValidateRequest)
+
+		// Routes for users acting on their own account
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequireUser)
+
+			r.With(s.DenyImpersonation).Patch("/api/v1/users/me", appHandler(s.userHandler.UpdateMe).ServeHTTP)
+			r.With(s.DenyImpersonation).Post("/api/v1/users/me/password", appHandler(s.authHandler.ChangePassword).ServeHTTP)
+			r.Get("/api/v1/users/me/sessions", appHandler(s.sessionHandler.ListSessions).ServeHTTP)
+			r.With(s.DenyImpersonation).Delete("/api/v1/users/me/sessions/{id}", appHandler(s.sessionHandler.RevokeSession).ServeHTTP)
+			r.Post("/api/v1/transactions/transfer", appHandler(s.transactionHandler.Transfer).ServeHTTP)
+			r.Get("/api/v1/transactions/history", appHandler(s.transactionHandler.GetTransactionHistory).ServeHTTP)
+			r.Get("/api/v1/balances/current", appHandler(s.balanceHandler.GetCurrentBalance).ServeHTTP)
+			r.Get("/api/v1/statements", appHandler(s.statementHandler.GetStatement).ServeHTTP)
+			r.Get("/api/v1/statements/jobs/{id}", appHandler(s.statementHandler.GetJob).ServeHTTP)
+			r.Get("/api/v1/statements/jobs/{id}/download", appHandler(s.statementHandler.DownloadJob).ServeHTTP)
+			r.With(s.DenyImpersonation).Post("/api/v1/webhooks", appHandler(s.webhookHandler.Create).ServeHTTP)
+			r.Get("/api/v1/webhooks", appHandler(s.webhookHandler.List).ServeHTTP)
+			r.Get("/api/v1/webhooks/{id}", appHandler(s.webhookHandler.Get).ServeHTTP)
+			r.With(s.DenyImpersonation).Delete("/api/v1/webhooks/{id}", appHandler(s.webhookHandler.Delete).ServeHTTP)
+			r.Get("/api/v1/webhooks/{id}/deliveries", appHandler(s.webhookHandler.ListDeliveries).ServeHTTP)
+			r.With(s.DenyImpersonation).Post("/api/v1/webhooks/{id}/deliveries/{deliveryID}/redeliver", appHandler(s.webhookHandler.Redeliver).ServeHTTP)
+			r.Get("/api/v1/stream", appHandler(s.streamHandler.Stream).ServeHTTP)
+			r.Get("/api/v1/notifications", appHandler(s.notificationHandler.List).ServeHTTP)
+			r.Get("/api/v1/notifications/unread-count", appHandler(s.notificationHandler.UnreadCount).ServeHTTP)
+			r.Post("/api/v1/notifications/read", appHandler(s.notificationHandler.MarkAllRead).ServeHTTP)
+			r.Post("/api/v1/notifications/{id}/read", appHandler(s.notificationHandler.MarkRead).ServeHTTP)
+			r.Get("/api/v1/notifications/preferences", appHandler(s.notificationHandler.GetPreferences).ServeHTTP)
+			r.With(s.DenyImpersonation).Put("/api/v1/notifications/preferences", appHandler(s.notificationHandler.UpdatePreferences).ServeHTTP)
+		})
 
-		// Routes for any authenticated user
+		// Routes for any principal, access to other accounts is checked by the handler
 		r.Get("/api/v1/users/{id}", appHandler(s.userHandler.GetUserByID).ServeHTTP)
-		r.Delete("/api/v1/users/{id}", appHandler(s.userHandler.DeleteUser).ServeHTTP)
-		r.Post("/api/v1/transactions/transfer", appHandler(s.transactionHandler.Transfer).ServeHTTP)
-		r.Get("/api/v1/transactions/history", appHandler(s.transactionHandler.GetTransactionHistory).ServeHTTP)
+		r.With(s.DenyImpersonation).Delete("/api/v1/users/{id}", appHandler(s.userHandler.DeleteUser).ServeHTTP)
 		r.Get("/api/v1/transactions/{id}", appHandler(s.transactionHandler.GetByTransactionID).ServeHTTP)
-		r.Get("/api/v1/balances/current", appHandler(s.balanceHandler.GetCurrentBalance).ServeHTTP)
+		r.With(s.DenyImpersonation).Post("/api/v1/payments/pain001", appHandler(s.paymentHandler.ImportPain001).ServeHTTP)
+
+		// --- Permission-Protected Routes ---
+		// Require both a valid token and the listed permission.
+		r.With(s.RequirePermission(domain.PermUsersRead)).Get("/api/v1/users", appHandler(s.userHandler.ListUsers).ServeHTTP)
+		r.With(s.RequirePermission(domain.PermRolesAssign)).Put("/api/v1/users/{id}/role", appHandler(s.roleHandler.AssignRole).ServeHTTP)
+		r.With(s.RequirePermission(domain.PermRolesRead)).Get("/api/v1/roles", appHandler(s.roleHandler.ListRoles).ServeHTTP)
+		r.With(s.RequirePermission(domain.PermTransactionsCredit)).Post("/api/v1/transactions/credit", appHandler(s.transactionHandler.Credit).ServeHTTP)
+		r.With(s.RequirePermission(domain.PermTransactionsDebit)).Post("/api/v1/transactions/debit", appHandler(s.transactionHandler.Debit).ServeHTTP)
+		r.With(s.RequirePermission(domain.PermDiagnostics)).Get("/api/v1/admin/diagnostics", appHandler(s.healthHandler.Diagnostics).ServeHTTP)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequirePermission(domain.PermAuditRead))
+
+			r.Get("/api/v1/audit-logs", appHandler(s.auditHandler.ListLogs).ServeHTTP)
+			r.Get("/api/v1/audit-logs/export", appHandler(s.auditHandler.ExportLogs).ServeHTTP)
+			r.Get("/api/v1/audit-logs/verify", appHandler(s.auditHandler.VerifyChain).ServeHTTP)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequirePermission(domain.PermServiceAccounts))
+
+			r.Post("/api/v1/service-accounts", appHandler(s.serviceAccountHandler.Create).ServeHTTP)
+			r.Get("/api/v1/service-accounts", appHandler(s.serviceAccountHandler.List).ServeHTTP)
+			r.Post("/api/v1/service-accounts/{id}/keys", appHandler(s.serviceAccountHandler.CreateAPIKey).ServeHTTP)
+			r.Get("/api/v1/service-accounts/{id}/keys", appHandler(s.serviceAccountHandler.ListAPIKeys).ServeHTTP)
+			r.Delete("/api/v1/service-accounts/{id}/keys/{keyID}", appHandler(s.serviceAccountHandler.RevokeAPIKey).ServeHTTP)
+		})
 
-		// --- Admin-Only Routes ---
-		// Require both a valid token and admin privileges.
 		r.Group(func(r chi.Router) {
-			r.Use(s.AdminOnlyMiddleware)
+			r.Use(s.RequireUser)
+			r.Use(s.DenyImpersonation)
+			r.Use(s.RequirePermission(domain.PermUsersImpersonate))
 
-			r.Get("/api/v1/users", appHandler(s.userHandler.GetAllUsers).ServeHTTP)
-			r.Post("/api/v1/transactions/credit", appHandler(s.transactionHandler.Credit).ServeHTTP)
-			r.Post("/api/v1/transactions/debit", appHandler(s.transactionHandler.Debit).ServeHTTP)
+			r.Post("/api/v1/admin/impersonations", appHandler(s.authHandler.Impersonate).ServeHTTP)
+			r.Get("/api/v1/admin/impersonations", appHandler(s.sessionHandler.ListImpersonations).ServeHTTP)
+			r.Delete("/api/v1/admin/impersonations/{id}", appHandler(s.sessionHandler.RevokeImpersonation).ServeHTTP)
 		})
 	})
 
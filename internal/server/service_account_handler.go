@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+type ServiceAccountHandler struct {
+	service service.ServiceAccountService
+}
+
+func NewServiceAccountHandler(s service.ServiceAccountService) *ServiceAccountHandler {
+	return &ServiceAccountHandler{service: s}
+}
+
+type createServiceAccountRequest struct {
+	Name   string              `json:"name"`
+	Scopes []domain.Permission `json:"scopes"`
+}
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes default to all scopes of the service account when empty.
+	Scopes []domain.Permission `json:"scopes"`
+	// ExpiresInHours of zero creates a key that does not expire.
+	ExpiresInHours int `json:"expires_in_hours"`
+}
+
+func (h *ServiceAccountHandler) Create(w http.ResponseWriter, r *http.Request) *apiError {
+	var req createServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	account, secret, err := h.service.Create(r.Context(), req.Name, req.Scopes)
+	if err != nil {
+		return errorResponse(err, "Failed to create service account")
+	}
+
+	// The client secret is only shown once.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service_account": account,
+		"client_secret":   secret,
+	})
+	return nil
+}
+
+func (h *ServiceAccountHandler) List(w http.ResponseWriter, r *http.Request) *apiError {
+	accounts, err := h.service.List(r.Context())
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve service accounts")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(accounts)
+	return nil
+}
+
+func (h *ServiceAccountHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) *apiError {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid service account ID format"}
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+	if req.ExpiresInHours < 0 {
+		return &apiError{Status: http.StatusBadRequest, Message: "expires_in_hours cannot be negative"}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	key, rawKey, err := h.service.CreateAPIKey(r.Context(), accountID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		return errorResponse(err, "Failed to create API key")
+	}
+
+	// The raw key is only shown once.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_key": key,
+		"key":     rawKey,
+	})
+	return nil
+}
+
+func (h *ServiceAccountHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) *apiError {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid service account ID format"}
+	}
+
+	keys, err := h.service.ListAPIKeys(r.Context(), accountID)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve API keys")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+	return nil
+}
+
+func (h *ServiceAccountHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) *apiError {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid service account ID format"}
+	}
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid API key ID format"}
+	}
+
+	if err := h.service.RevokeAPIKey(r.Context(), accountID, keyID); err != nil {
+		return errorResponse(err, "Failed to revoke API key")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
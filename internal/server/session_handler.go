@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+type SessionHandler struct {
+	sessionService service.SessionService
+}
+
+func NewSessionHandler(s service.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: s}
+}
+
+type sessionResponse struct {
+	domain.Session
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) *apiError {
+	principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Principal not found in context"}
+	}
+
+	sessions, err := h.sessionService.ListActive(r.Context(), principal.ID)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve sessions")
+	}
+
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{Session: session, Current: session.ID == principal.SessionID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+	return nil
+}
+
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) *apiError {
+	principal, ok := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "Principal not found in context"}
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	if err := h.sessionService.Revoke(r.Context(), principal.ID, sessionID); err != nil {
+		return errorResponse(err, "Failed to revoke session")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *SessionHandler) ListImpersonations(w http.ResponseWriter, r *http.Request) *apiError {
+	sessions, err := h.sessionService.ListImpersonations(r.Context())
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve impersonation sessions")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+	return nil
+}
+
+func (h *SessionHandler) RevokeImpersonation(w http.ResponseWriter, r *http.Request) *apiError {
+	actorID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	if err := h.sessionService.RevokeImpersonation(r.Context(), actorID, chi.URLParam(r, "id")); err != nil {
+		return errorResponse(err, "Failed to revoke impersonation session")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
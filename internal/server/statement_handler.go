@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+	"github.com/yusuf4ktas/backend-project/internal/statement"
+)
+
+type StatementHandler struct {
+	service service.StatementService
+}
+
+func NewStatementHandler(s service.StatementService) *StatementHandler {
+	return &StatementHandler{service: s}
+}
+
+type statementJobResponse struct {
+	*domain.StatementJob
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func newStatementJobResponse(job *domain.StatementJob) statementJobResponse {
+	resp := statementJobResponse{StatementJob: job}
+	if job.Status == domain.StatementJobCompleted {
+		resp.DownloadURL = fmt.Sprintf("/api/v1/statements/jobs/%s/download", job.ID)
+	}
+	return resp
+}
+
+// GetStatement streams short statements directly. Longer periods, or any period when async=true,
+// are queued as a job and answered with 202 and the job's location.
+func (h *StatementHandler) GetStatement(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	q := r.URL.Query()
+	req := domain.StatementRequest{UserID: userID, Format: domain.StatementFormat(q.Get("format"))}
+	if req.Format == "" {
+		req.Format = domain.StatementCSV
+	}
+
+	from, _, err := parseDate(q.Get("from"))
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid or missing from date, use RFC 3339 or YYYY-MM-DD"}
+	}
+	to, dateOnly, err := parseDate(q.Get("to"))
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid or missing to date, use RFC 3339 or YYYY-MM-DD"}
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	req.From, req.To = from, to
+
+	async, _ := strconv.ParseBool(q.Get("async"))
+	if async || req.To.Sub(req.From) > service.MaxSyncStatementPeriod {
+		job, err := h.service.StartJob(r.Context(), req)
+		if err != nil {
+			return errorResponse(err, "Failed to start statement job")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/v1/statements/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newStatementJobResponse(job))
+		return nil
+	}
+
+	sw := &downloadResponseWriter{w: w, setHeaders: func(h http.Header) { setStatementHeaders(h, req) }}
+	if err := h.service.Generate(r.Context(), req, sw); err != nil {
+		if sw.started {
+			// The status line is already sent, all that is left is to cut the download short.
+			loggerFrom(r.Context()).Error("statement failed mid-stream", "user_id", userID, "error", err)
+			return nil
+		}
+		return errorResponse(err, "Failed to generate statement")
+	}
+	return nil
+}
+
+func (h *StatementHandler) GetJob(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	job, err := h.service.GetJob(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve statement job")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newStatementJobResponse(job))
+	return nil
+}
+
+func (h *StatementHandler) DownloadJob(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	job, file, err := h.service.GetJobFile(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve statement")
+	}
+	if file == nil {
+		return &apiError{Status: http.StatusConflict, Code: "statement_not_ready", Message: fmt.Sprintf("Statement is not ready, job is %s", job.Status)}
+	}
+	defer file.Close()
+
+	// ServeContent streams the file with its length and answers range requests of resumed downloads.
+	setStatementHeaders(w.Header(), job.StatementRequest)
+	http.ServeContent(w, r, "", *job.CompletedAt, file)
+	return nil
+}
+
+func setStatementHeaders(h http.Header, req domain.StatementRequest) {
+	h.Set("Content-Type", statement.ContentType(req.Format))
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", statement.FileName(req)))
+}
+
+// downloadResponseWriter sends the download headers with the first write, so that a download
+// failing before any output can still be answered with a JSON error.
+type downloadResponseWriter struct {
+	w          http.ResponseWriter
+	setHeaders func(http.Header)
+	started    bool
+}
+
+func (dw *downloadResponseWriter) Write(p []byte) (int, error) {
+	if !dw.started {
+		dw.started = true
+		dw.setHeaders(dw.w.Header())
+		dw.w.WriteHeader(http.StatusOK)
+	}
+	return dw.w.Write(p)
+}
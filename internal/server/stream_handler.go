@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+const (
+	// A comment is written this often so that proxies keep idle streams open and clients notice
+	// a dead connection. The session is checked again at every heartbeat.
+	streamHeartbeatInterval = 15 * time.Second
+	// How long a client waits before reconnecting, sent to EventSource as the retry field.
+	streamRetry = 3 * time.Second
+)
+
+var streamConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "live_update_streams",
+	Help: "Number of open live update streams.",
+})
+
+type StreamHandler struct {
+	service        service.LiveUpdateService
+	sessionService service.SessionService
+	heartbeat      time.Duration
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewStreamHandler(s service.LiveUpdateService, sessionService service.SessionService) *StreamHandler {
+	return &StreamHandler{
+		service:        s,
+		sessionService: sessionService,
+		heartbeat:      streamHeartbeatInterval,
+		closed:         make(chan struct{}),
+	}
+}
+
+// Close ends every open stream, clients reconnect to another instance. Streams never finish on
+// their own, so it is registered with http.Server.RegisterOnShutdown to let Shutdown complete.
+func (h *StreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// Stream pushes the user's balance and transfer updates as Server-Sent Events. A client that
+// reconnects sends the ID of the last event it received in the Last-Event-ID header, or the
+// last_event_id query parameter, and receives what it missed first.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	principal, _ := r.Context().Value(PrincipalContextKey).(*domain.Principal)
+
+	// Cancelled when the stream ends for any reason, which unsubscribes from the updates.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	updates, err := h.service.Subscribe(ctx, userID, lastEventID)
+	if err != nil {
+		return errorResponse(err, "Failed to open update stream")
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disables response buffering in nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		return nil
+	}
+
+	streamConnections.Inc()
+	defer streamConnections.Dec()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				// The client fell behind or the request ended, it reconnects with Last-Event-ID.
+				return nil
+			}
+			data, err := json.Marshal(update.Event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", update.ID, update.Event.Type, data)
+		case <-heartbeat.C:
+			// A revoked or expired session stops receiving updates, the client's reconnect is
+			// then refused by AuthMiddleware.
+			if principal != nil && principal.SessionID != "" {
+				if _, err := h.sessionService.Validate(ctx, principal.SessionID, userID); err != nil {
+					return nil
+				}
+			}
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-h.closed:
+			return nil
+		}
+		if err := rc.Flush(); err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+// idleLiveUpdates never sends an update, its channel closes when the subscription ends.
+type idleLiveUpdates struct {
+	service.LiveUpdateService
+}
+
+func (idleLiveUpdates) Subscribe(ctx context.Context, _ int64, _ string) (<-chan domain.LiveUpdate, error) {
+	updates := make(chan domain.LiveUpdate)
+	go func() {
+		<-ctx.Done()
+		close(updates)
+	}()
+	return updates, nil
+}
+
+// streamSessions fails validation with err and counts the calls.
+type streamSessions struct {
+	service.SessionService
+	err   error
+	calls *atomic.Int32
+}
+
+func (s streamSessions) Validate(context.Context, string, int64) (*domain.Session, error) {
+	s.calls.Add(1)
+	return nil, s.err
+}
+
+func TestStreamEnds(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionErr error
+		// end ends the stream from outside, nil when it has to end on its own.
+		end func(h *StreamHandler, cancel context.CancelFunc)
+		// heartbeats reports whether heartbeats are written before the stream ends.
+		heartbeats bool
+	}{
+		{
+			name:       "on shutdown",
+			end:        func(h *StreamHandler, _ context.CancelFunc) { h.Close() },
+			heartbeats: true,
+		},
+		{
+			name:       "when the client disconnects",
+			end:        func(_ *StreamHandler, cancel context.CancelFunc) { cancel() },
+			heartbeats: true,
+		},
+		{
+			name:       "when the session is revoked",
+			sessionErr: domain.ErrSessionInactive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := &atomic.Int32{}
+			h := NewStreamHandler(idleLiveUpdates{}, streamSessions{err: tt.sessionErr, calls: calls})
+			h.heartbeat = 5 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ctx = context.WithValue(ctx, UserIDContextKey, int64(1))
+			ctx = context.WithValue(ctx, PrincipalContextKey, &domain.Principal{Type: domain.PrincipalUser, ID: 1, SessionID: "session-1"})
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			done := make(chan *apiError)
+			go func() { done <- h.Stream(rec, req) }()
+
+			if tt.end != nil {
+				// Long enough for a few heartbeats, which have to check the session.
+				time.Sleep(50 * time.Millisecond)
+				tt.end(h, cancel)
+			}
+
+			select {
+			case apiErr := <-done:
+				if apiErr != nil {
+					t.Fatalf("unexpected error: %+v", apiErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("stream did not end")
+			}
+
+			if calls.Load() == 0 {
+				t.Error("session was never validated again")
+			}
+			if got := strings.Contains(rec.Body.String(), ": heartbeat"); got != tt.heartbeats {
+				t.Errorf("heartbeats written = %v, want %v", got, tt.heartbeats)
+			}
+		})
+	}
+}
@@ -1,13 +1,13 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
 	"github.com/yusuf4ktas/backend-project/internal/service"
 	"github.com/yusuf4ktas/backend-project/internal/worker"
 )
@@ -52,6 +52,12 @@ func (h *TransactionHandler) Transfer(w http.ResponseWriter, r *http.Request) *a
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
 	}
 
+	// Unknown receivers and insufficient funds are answered right away rather than only failing
+	// in the worker.
+	if err := h.service.CheckTransfer(r.Context(), fromUserID, req.ToUserID, req.Amount); err != nil {
+		return errorResponse(err, "Failed to check the transfer")
+	}
+
 	// Creation of job from the request
 	job := worker.Job{
 		FromUserID:      fromUserID,
@@ -61,7 +67,7 @@ func (h *TransactionHandler) Transfer(w http.ResponseWriter, r *http.Request) *a
 	}
 
 	// Adding job to the dispatcher queue
-	h.dispatcher.AddJob(job)
+	h.dispatcher.AddJob(r.Context(), job)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted) // 202 Accepted
@@ -75,6 +81,9 @@ func (h *TransactionHandler) Credit(w http.ResponseWriter, r *http.Request) *api
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
 	}
+	if err := h.service.CheckCredit(r.Context(), req.UserID, req.Amount); err != nil {
+		return errorResponse(err, "Failed to check the credit")
+	}
 
 	job := worker.Job{
 		FromUserID:      0,
@@ -82,7 +91,7 @@ func (h *TransactionHandler) Credit(w http.ResponseWriter, r *http.Request) *api
 		Amount:          req.Amount,
 		TransactionType: "credit",
 	}
-	h.dispatcher.AddJob(job)
+	h.dispatcher.AddJob(r.Context(), job)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -95,6 +104,9 @@ func (h *TransactionHandler) Debit(w http.ResponseWriter, r *http.Request) *apiE
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
 	}
+	if err := h.service.CheckDebit(r.Context(), req.UserID, req.Amount); err != nil {
+		return errorResponse(err, "Failed to check the debit")
+	}
 
 	job := worker.Job{
 		FromUserID:      req.UserID,
@@ -102,7 +114,7 @@ func (h *TransactionHandler) Debit(w http.ResponseWriter, r *http.Request) *apiE
 		Amount:          req.Amount,
 		TransactionType: "debit",
 	}
-	h.dispatcher.AddJob(job)
+	h.dispatcher.AddJob(r.Context(), job)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -116,17 +128,99 @@ func (h *TransactionHandler) GetTransactionHistory(w http.ResponseWriter, r *htt
 		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
 	}
 
-	transactions, err := h.service.GetTransactionHistory(r.Context(), userID) // Assume GetHistory exists on service
+	filter, apiErr := parseTransactionFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	filter.UserID = userID
+
+	page, err := h.service.GetTransactionHistory(r.Context(), filter)
 	if err != nil {
-		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to retrieve transaction history"}
+		return errorResponse(err, "Failed to retrieve transaction history")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(transactions)
+	json.NewEncoder(w).Encode(page)
 	return nil
 }
 
+// parseTransactionFilter reads the history filters from the query string. Dates accept either
+// RFC 3339 timestamps or YYYY-MM-DD, in which case "to" includes the whole day.
+func parseTransactionFilter(r *http.Request) (domain.TransactionFilter, *apiError) {
+	q := r.URL.Query()
+	var filter domain.TransactionFilter
+
+	if v := q.Get("from"); v != "" {
+		t, _, err := parseDate(v)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid from date, use RFC 3339 or YYYY-MM-DD"}
+		}
+		filter.From = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, dateOnly, err := parseDate(v)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid to date, use RFC 3339 or YYYY-MM-DD"}
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = &t
+	}
+
+	filter.Type = q.Get("type")
+	filter.Status = domain.TransactionStatus(q.Get("status"))
+	filter.Direction = domain.TransactionDirection(q.Get("direction"))
+
+	if v := q.Get("counterparty"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid counterparty user ID"}
+		}
+		filter.CounterpartyID = &id
+	}
+	if v := q.Get("min_amount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid min_amount"}
+		}
+		filter.MinAmount = &amount
+	}
+	if v := q.Get("max_amount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid max_amount"}
+		}
+		filter.MaxAmount = &amount
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid limit"}
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := domain.DecodeTransactionCursor(v)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid cursor"}
+		}
+		filter.Cursor = cursor
+	}
+
+	return filter, nil
+}
+
+// parseDate also reports whether the value was a plain date without a time.
+func parseDate(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, true, err
+}
+
 func (h *TransactionHandler) GetByTransactionID(w http.ResponseWriter, r *http.Request) *apiError {
 	idStr := chi.URLParam(r, "id")
 	transactionID, err := strconv.ParseInt(idStr, 10, 64)
@@ -136,10 +230,19 @@ func (h *TransactionHandler) GetByTransactionID(w http.ResponseWriter, r *http.R
 
 	transaction, err := h.service.GetByTransactionID(r.Context(), transactionID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &apiError{Status: http.StatusNotFound, Message: "Transaction not found"}
+		return errorResponse(err, "Failed to retrieve transaction")
+	}
+
+	// Participants can always see the transaction, anyone else (including service accounts) needs transactions:read.
+	userID, isUser := r.Context().Value(UserIDContextKey).(int64)
+	if !isUser || (transaction.FromUserID != userID && transaction.ToUserID != userID) {
+		allowed, err := hasPermission(r.Context(), domain.PermTransactionsRead)
+		if err != nil {
+			return errorResponse(err, "Could not retrieve requesting user's permissions")
+		}
+		if !allowed {
+			return &apiError{Status: http.StatusNotFound, Code: "transaction_not_found", Message: domain.ErrTransactionNotFound.Error()}
 		}
-		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to retrieve transaction"}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1,14 +1,13 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
 	"github.com/yusuf4ktas/backend-project/internal/service"
 )
 
@@ -28,19 +27,23 @@ type registerRequest struct {
 	Password string `json:"password"`
 }
 
+// Fields are pointers so that omitted fields are left unchanged.
+type updateProfileRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+}
+
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) *apiError {
 	var req registerRequest
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
 	}
 
 	createdUser, err := h.userService.Register(r.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return &apiError{Status: http.StatusInternalServerError, Message: err.Error()}
+		return errorResponse(err, "Failed to register user")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -59,12 +62,21 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) *apiEr
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid user ID format"}
 	}
 
+	// Users can always see their own account, anyone else (including service accounts) needs users:read.
+	requestingUserID, isUser := r.Context().Value(UserIDContextKey).(int64)
+	if !isUser || requestingUserID != id {
+		allowed, err := hasPermission(r.Context(), domain.PermUsersRead)
+		if err != nil {
+			return errorResponse(err, "Could not retrieve requesting user's permissions")
+		}
+		if !allowed {
+			return &apiError{Status: http.StatusForbidden, Code: "permission_denied", Message: "You do not have permission to view this user"}
+		}
+	}
+
 	user, err := h.userService.GetByID(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &apiError{Status: http.StatusNotFound, Message: "User not found"}
-		}
-		return &apiError{Status: http.StatusInternalServerError, Message: err.Error()}
+		return errorResponse(err, "Failed to retrieve user")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -74,18 +86,71 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) *apiEr
 	return nil
 }
 
-func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) *apiError {
-	users, err := h.userService.GetAllUsers(r.Context())
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) *apiError {
+	filter, apiErr := parseUserFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	page, err := h.userService.ListUsers(r.Context(), filter)
 	if err != nil {
-		return &apiError{Status: http.StatusInternalServerError, Message: err.Error()}
+		return errorResponse(err, "Failed to list users")
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		log.Printf("ERROR: failed to write GetAll users response: %v", err)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		loggerFrom(r.Context()).Error("failed to write list users response", "error", err)
 	}
 	return nil
 }
+
+// parseUserFilter reads the listing filters from the query string. A leading "-" on sort orders descending.
+func parseUserFilter(r *http.Request) (domain.UserFilter, *apiError) {
+	q := r.URL.Query()
+	filter := domain.UserFilter{
+		Search: strings.TrimSpace(q.Get("search")),
+		Role:   q.Get("role"),
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		filter.Sort = strings.TrimPrefix(sort, "-")
+		filter.SortDesc = strings.HasPrefix(sort, "-")
+	}
+	if v := q.Get("created_from"); v != "" {
+		t, _, err := parseDate(v)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid created_from date, use RFC 3339 or YYYY-MM-DD"}
+		}
+		filter.CreatedFrom = &t
+	}
+	if v := q.Get("created_to"); v != "" {
+		t, dateOnly, err := parseDate(v)
+		if err != nil {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid created_to date, use RFC 3339 or YYYY-MM-DD"}
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.CreatedTo = &t
+	}
+	if v := q.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page <= 0 {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid page"}
+		}
+		filter.Page = page
+	}
+	if v := q.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return filter, &apiError{Status: http.StatusBadRequest, Message: "Invalid page_size"}
+		}
+		filter.PageSize = size
+	}
+
+	return filter, nil
+}
+
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) *apiError {
 	idStr := chi.URLParam(r, "id")
 	userIDToDelete, err := strconv.ParseInt(idStr, 10, 64)
@@ -93,28 +158,65 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) *apiErr
 		return &apiError{Status: http.StatusBadRequest, Message: "Invalid user ID specified"}
 	}
 
-	// Get the ID and details of the user making the request from the context.
-	requestingUserID, ok := r.Context().Value(UserIDContextKey).(int64)
+	// Get the ID of the user making the request from the context, service accounts have none.
+	requestingUserID, isUser := r.Context().Value(UserIDContextKey).(int64)
+
+	// Allow if the user is deleting their own account OR holds the users:delete permission.
+	if !isUser || requestingUserID != userIDToDelete {
+		allowed, err := hasPermission(r.Context(), domain.PermUsersDelete)
+		if err != nil {
+			return errorResponse(err, "Could not retrieve requesting user's permissions")
+		}
+		if !allowed {
+			return &apiError{Status: http.StatusForbidden, Code: "permission_denied", Message: "You do not have permission to delete this user"}
+		}
+	}
+
+	if err := h.userService.Delete(r.Context(), userIDToDelete); err != nil {
+		return errorResponse(err, "Failed to delete user")
+	}
+
+	w.WriteHeader(http.StatusNoContent) //successful deletion
+	return nil
+}
+
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
 	if !ok {
 		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
 	}
-	requestingUser, err := h.userService.GetByID(r.Context(), requestingUserID)
+
+	var req updateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	user, err := h.userService.GetByID(r.Context(), userID)
 	if err != nil {
-		return &apiError{Status: http.StatusInternalServerError, Message: "Could not retrieve requesting user's details"}
+		return errorResponse(err, "Could not retrieve user details")
 	}
 
-	// Allow if the user is an admin OR if the user is deleting their own account.
-	if requestingUser.Role != "admin" && requestingUserID != userIDToDelete {
-		return &apiError{Status: http.StatusForbidden, Message: "You do not have permission to delete this user"}
+	if req.Username != nil && *req.Username != user.Username {
+		user, err = h.userService.UpdateProfile(r.Context(), userID, *req.Username)
+		if err != nil {
+			return errorResponse(err, "Failed to update profile")
+		}
 	}
 
-	if err := h.userService.Delete(r.Context(), userIDToDelete); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &apiError{Status: http.StatusNotFound, Message: "User to delete not found"}
+	// Email changes only take effect after the new address is verified.
+	emailPending := false
+	if req.Email != nil && *req.Email != user.Email {
+		if err := h.userService.RequestEmailChange(r.Context(), userID, *req.Email); err != nil {
+			return errorResponse(err, "Failed to request the email change")
 		}
-		return &apiError{Status: http.StatusInternalServerError, Message: "Failed to delete user"}
+		emailPending = true
 	}
 
-	w.WriteHeader(http.StatusNoContent) //successful deletion
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":                       user,
+		"email_verification_pending": emailPending,
+	})
 	return nil
 }
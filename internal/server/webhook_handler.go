@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/service"
+)
+
+type WebhookHandler struct {
+	service service.WebhookService
+}
+
+func NewWebhookHandler(s service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: s}
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Secret is generated when empty.
+	Secret string `json:"secret"`
+}
+
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	sub, secret, err := h.service.CreateSubscription(r.Context(), userID, req.URL, req.EventTypes, req.Secret)
+	if err != nil {
+		return errorResponse(err, "Failed to create webhook")
+	}
+
+	// The secret is only shown once.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook": sub,
+		"secret":  secret,
+	})
+	return nil
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+
+	subs, err := h.service.ListSubscriptions(r.Context(), userID)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve webhooks")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subs)
+	return nil
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid webhook ID format"}
+	}
+
+	sub, err := h.service.GetSubscription(r.Context(), userID, id)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve webhook")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sub)
+	return nil
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid webhook ID format"}
+	}
+
+	if err := h.service.DeleteSubscription(r.Context(), userID, id); err != nil {
+		return errorResponse(err, "Failed to delete webhook")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid webhook ID format"}
+	}
+
+	q := r.URL.Query()
+	filter := domain.WebhookDeliveryFilter{
+		SubscriptionID: id,
+		Status:         domain.WebhookDeliveryStatus(q.Get("status")),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return &apiError{Status: http.StatusBadRequest, Message: "Invalid limit"}
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := domain.DecodeWebhookDeliveryCursor(v)
+		if err != nil {
+			return &apiError{Status: http.StatusBadRequest, Message: "Invalid cursor"}
+		}
+		filter.Cursor = cursor
+	}
+
+	page, err := h.service.ListDeliveries(r.Context(), userID, filter)
+	if err != nil {
+		return errorResponse(err, "Failed to retrieve webhook deliveries")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+	return nil
+}
+
+// Redeliver queues a delivery again, for example after the receiving endpoint was fixed.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) *apiError {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		return &apiError{Status: http.StatusInternalServerError, Message: "User ID not found in context"}
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid webhook ID format"}
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		return &apiError{Status: http.StatusBadRequest, Message: "Invalid delivery ID format"}
+	}
+
+	delivery, err := h.service.Redeliver(r.Context(), userID, id, deliveryID)
+	if err != nil {
+		return errorResponse(err, "Failed to redeliver")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+	return nil
+}
@@ -1,33 +1,445 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
 )
 
+// Longest free text search accepted, longer queries are not meaningful against the details column.
+const maxAuditQueryLength = 200
+
+// errChainBroken stops the walk over the audit log at the first broken link.
+var errChainBroken = errors.New("audit chain is broken")
+
 type auditLogService struct {
+	db           *sql.DB
 	auditLogRepo domain.AuditLogRepository
+	signingKey   ed25519.PrivateKey
+	logger       *slog.Logger
 }
 
-func NewAuditLogService(repo domain.AuditLogRepository) AuditLogService {
+// NewAuditLogService creates the audit log service. signingKey signs the chain checkpoints,
+// its public half is all that is needed to verify them.
+func NewAuditLogService(db *sql.DB, repo domain.AuditLogRepository, signingKey ed25519.PrivateKey, logger *slog.Logger) AuditLogService {
 	return &auditLogService{
+		db:           db,
 		auditLogRepo: repo,
+		signingKey:   signingKey,
+		logger:       logger,
 	}
 }
 
+// Log records an action. The actor and request are taken from ctx, an impersonated request
+// is attributed to the admin doing the impersonation.
 func (s *auditLogService) Log(ctx context.Context, entityType string, entityID int64, action string, details string) (*domain.AuditLog, error) {
+	return s.LogChange(ctx, entityType, entityID, action, details, nil, nil)
+}
+
+// LogChange records an action that modified a record, together with the fields that differ
+// between before and after. Either may be nil when the record was created or deleted.
+func (s *auditLogService) LogChange(ctx context.Context, entityType string, entityID int64, action string, details string, before, after interface{}) (*domain.AuditLog, error) {
+	log, err := newAuditLog(ctx, entityType, entityID, action, details, before, after)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.appendToChain(ctx, log); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// Enqueue is LogChange for changes made in a transaction: the entry is written to outbox, which
+// should belong to that transaction, and reaches the audit log through the outbox relay. It is
+// logged exactly when the change is committed.
+func (s *auditLogService) Enqueue(ctx context.Context, outbox domain.OutboxRepository, entityType string, entityID int64, action string, details string, before, after interface{}) error {
+	log, err := newAuditLog(ctx, entityType, entityID, action, details, before, after)
+	if err != nil {
+		return err
+	}
+	msg, err := domain.NewOutboxMessage(domain.TopicAuditLog, log)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log: %w", err)
+	}
+	if err := outbox.Create(ctx, msg); err != nil {
+		return fmt.Errorf("failed to write audit log to the outbox: %w", err)
+	}
+	return nil
+}
+
+// Deliver appends an entry written by Enqueue to the chain. Messages are delivered at least
+// once, one that was already logged is skipped.
+func (s *auditLogService) Deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	var log domain.AuditLog
+	if err := json.Unmarshal(msg.Payload, &log); err != nil {
+		return fmt.Errorf("failed to decode audit log: %w", err)
+	}
+	log.OutboxID = &msg.ID
+	return s.appendToChain(ctx, &log)
+}
+
+// newAuditLog builds an entry. The actor and request are taken from ctx, an impersonated request
+// is attributed to the admin doing the impersonation.
+func newAuditLog(ctx context.Context, entityType string, entityID int64, action string, details string, before, after interface{}) (*domain.AuditLog, error) {
 	log := &domain.AuditLog{
 		EntityType: entityType,
 		EntityID:   entityID,
 		Action:     action,
 		Details:    details,
-		CreatedAt:  time.Now(),
+		// Stored with second precision, the hash has to match what is read back.
+		CreatedAt: time.Now().Truncate(time.Second),
 	}
-	err := s.auditLogRepo.Create(ctx, log)
+	if principal, ok := domain.PrincipalFromContext(ctx); ok {
+		actorID := principal.ID
+		if principal.IsImpersonated() {
+			actorID = principal.ImpersonatorID
+		}
+		log.ActorType = principal.Type
+		log.ActorID = &actorID
+	}
+	if request, ok := domain.RequestInfoFromContext(ctx); ok {
+		log.RequestID = request.RequestID
+		log.IP = request.IP
+		log.UserAgent = truncate(request.UserAgent, 512)
+	}
+	if before != nil || after != nil {
+		changes, err := auditChanges(before, after)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute audit changes: %w", err)
+		}
+		log.Changes = changes
+	}
+	return log, nil
+}
+
+// auditChanges compares the JSON forms of before and after field by field, fields hidden from
+// JSON such as password hashes are never recorded. The result maps field names to AuditChange.
+func auditChanges(before, after interface{}) (json.RawMessage, error) {
+	beforeFields, err := jsonFields(before)
 	if err != nil {
 		return nil, err
 	}
-	return log, nil
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]domain.AuditChange)
+	for name, value := range beforeFields {
+		if afterValue, ok := afterFields[name]; !ok || !bytes.Equal(value, afterValue) {
+			changes[name] = domain.AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = domain.AuditChange{After: value}
+		}
+	}
+	// Maps are marshalled with sorted keys, the result is the same for the same change.
+	return json.Marshal(changes)
+}
+
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// appendToChain links log to the newest entry and writes it. The chain head stays locked until
+// the transaction ends, so concurrent writers, also on other instances, append one at a time.
+func (s *auditLogService) appendToChain(ctx context.Context, log *domain.AuditLog) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	auditLogRepoTx := repository.NewAuditLogRepository(tx)
+
+	head, err := auditLogRepoTx.LockChainHead(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+	if log.OutboxID != nil {
+		// Checked under the lock, a message delivered twice at the same time is still logged once.
+		logged, err := auditLogRepoTx.ExistsForOutbox(ctx, *log.OutboxID)
+		if err != nil {
+			return fmt.Errorf("failed to check for outbox message: %w", err)
+		}
+		if logged {
+			return nil
+		}
+	}
+	log.PrevHash = head.LastHash
+	log.Hash = log.ChainHash()
+
+	if err := auditLogRepoTx.Create(ctx, log); err != nil {
+		return err
+	}
+	if err := auditLogRepoTx.UpdateChainHead(ctx, &domain.AuditChainHead{LastEntryID: log.ID, LastHash: log.Hash}); err != nil {
+		return fmt.Errorf("failed to advance audit chain: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Checkpoint signs the current end of the chain. It returns nil when nothing was logged since
+// the latest checkpoint.
+func (s *auditLogService) Checkpoint(ctx context.Context) (*domain.AuditCheckpoint, error) {
+	head, err := s.auditLogRepo.GetChainHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain: %w", err)
+	}
+	if head.LastEntryID == 0 {
+		return nil, nil
+	}
+	latest, err := s.auditLogRepo.LatestCheckpoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latest checkpoint: %w", err)
+	}
+	if latest != nil && latest.EntryID >= head.LastEntryID {
+		return nil, nil
+	}
+
+	checkpoint := &domain.AuditCheckpoint{
+		EntryID:   head.LastEntryID,
+		Hash:      head.LastHash,
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, checkpoint.SignedMessage()))
+	if err := s.auditLogRepo.CreateCheckpoint(ctx, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// RunCheckpoints makes a checkpoint every interval until ctx is cancelled. Instances running it
+// at the same time are harmless, an entry gets at most one checkpoint.
+func (s *auditLogService) RunCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Checkpoint(ctx); err != nil {
+				s.logger.ErrorContext(ctx, "audit checkpoint failed", "error", err)
+			}
+		}
+	}
+}
+
+// Verify walks the whole chain and reports the first entry whose link does not hold: an edited
+// entry no longer matches its hash, a removed one leaves the next entry pointing at a missing hash,
+// and entries removed from the end are caught by the chain head and the signed checkpoints.
+func (s *auditLogService) Verify(ctx context.Context) (*domain.AuditChainReport, error) {
+	publicKey := s.signingKey.Public().(ed25519.PublicKey)
+	report := &domain.AuditChainReport{Valid: true, PublicKey: base64.StdEncoding.EncodeToString(publicKey)}
+	fail := func(entryID int64, reason string) {
+		report.Valid = false
+		report.Broken = &domain.AuditChainBreak{EntryID: entryID, Reason: reason}
+	}
+
+	// A read-only transaction sees the entries, checkpoints and head as of the same moment.
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	auditLogRepoTx := repository.NewAuditLogRepository(tx)
+
+	checkpoints, err := auditLogRepoTx.ListCheckpoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	pending := make(map[int64]domain.AuditCheckpoint, len(checkpoints))
+	for _, c := range checkpoints {
+		signature, err := base64.StdEncoding.DecodeString(c.Signature)
+		if err != nil || !ed25519.Verify(publicKey, c.SignedMessage(), signature) {
+			fail(c.EntryID, fmt.Sprintf("checkpoint %d has an invalid signature", c.ID))
+			return report, nil
+		}
+		pending[c.EntryID] = c
+	}
+
+	err = auditLogRepoTx.ForEach(ctx, domain.AuditLogFilter{}, func(l *domain.AuditLog) error {
+		if l.Hash == "" {
+			if report.Verified > 0 {
+				fail(l.ID, "entry has no hash")
+				return errChainBroken
+			}
+			// Written before the chain was introduced.
+			report.Unchained++
+			return nil
+		}
+		if l.PrevHash != report.LastHash {
+			fail(l.ID, "previous hash does not match the preceding entry, an entry was removed or reordered")
+			return errChainBroken
+		}
+		if l.ChainHash() != l.Hash {
+			fail(l.ID, "content does not match its hash, the entry was modified")
+			return errChainBroken
+		}
+		if c, ok := pending[l.ID]; ok {
+			if c.Hash != l.Hash {
+				fail(l.ID, fmt.Sprintf("hash does not match checkpoint %d", c.ID))
+				return errChainBroken
+			}
+			delete(pending, l.ID)
+			report.CheckpointsVerified++
+		}
+		report.Verified++
+		report.LastEntryID, report.LastHash = l.ID, l.Hash
+		return nil
+	})
+	if errors.Is(err, errChainBroken) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit logs: %w", err)
+	}
+
+	for _, c := range checkpoints {
+		if _, missing := pending[c.EntryID]; missing {
+			fail(c.EntryID, fmt.Sprintf("entry signed by checkpoint %d is missing", c.ID))
+			return report, nil
+		}
+	}
+
+	head, err := auditLogRepoTx.GetChainHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain: %w", err)
+	}
+	if head.LastEntryID != report.LastEntryID || head.LastHash != report.LastHash {
+		fail(head.LastEntryID, fmt.Sprintf("chain head points at entry %d but the chain ends at entry %d, entries were removed from the end", head.LastEntryID, report.LastEntryID))
+	}
+	return report, nil
+}
+
+func validateAuditLogFilter(filter domain.AuditLogFilter) error {
+	if filter.ActorType != "" && filter.ActorType != domain.PrincipalUser && filter.ActorType != domain.PrincipalService {
+		return fmt.Errorf("%w: actor_type must be user or service", domain.ErrInvalidFilter)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return fmt.Errorf("%w: from must be before to", domain.ErrInvalidFilter)
+	}
+	if len(filter.Query) > maxAuditQueryLength {
+		return fmt.Errorf("%w: q can be at most %d characters", domain.ErrInvalidFilter, maxAuditQueryLength)
+	}
+	return nil
+}
+
+func (s *auditLogService) ListLogs(ctx context.Context, filter domain.AuditLogFilter) (*domain.AuditLogPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = domain.DefaultPageSize
+	}
+	if filter.Limit > domain.MaxPageSize {
+		filter.Limit = domain.MaxPageSize
+	}
+	if err := validateAuditLogFilter(filter); err != nil {
+		return nil, err
+	}
+
+	logs, err := s.auditLogRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.AuditLogPage{Entries: logs}
+	if len(logs) > filter.Limit {
+		page.Entries = logs[:filter.Limit]
+		page.NextCursor = domain.AuditLogCursor{ID: page.Entries[filter.Limit-1].ID}.Encode()
+	}
+	return page, nil
+}
+
+// spreadsheetSafe prefixes the cells a spreadsheet would evaluate as a formula with a quote. Details
+// and user agents come from users, and an admin opening the export must not run what they wrote.
+func spreadsheetSafe(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+// Export streams every entry matching filter to w, oldest first. Nothing is written when the
+// filter or format is invalid.
+func (s *auditLogService) Export(ctx context.Context, filter domain.AuditLogFilter, format domain.ExportFormat, w io.Writer) error {
+	if err := validateAuditLogFilter(filter); err != nil {
+		return err
+	}
+
+	switch format {
+	case domain.ExportCSV:
+		// csv.Writer buffers, a query that fails right away still leaves w untouched.
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "created_at", "entity_type", "entity_id", "action", "actor_type", "actor_id", "request_id", "ip", "user_agent", "details", "changes", "prev_hash", "hash"}); err != nil {
+			return err
+		}
+		err := s.auditLogRepo.ForEach(ctx, filter, func(log *domain.AuditLog) error {
+			actorID := ""
+			if log.ActorID != nil {
+				actorID = strconv.FormatInt(*log.ActorID, 10)
+			}
+			return cw.Write(spreadsheetSafe(
+				strconv.FormatInt(log.ID, 10),
+				log.CreatedAt.Format(time.RFC3339),
+				log.EntityType,
+				strconv.FormatInt(log.EntityID, 10),
+				log.Action,
+				string(log.ActorType),
+				actorID,
+				log.RequestID,
+				log.IP,
+				log.UserAgent,
+				log.Details,
+				string(log.Changes),
+				log.PrevHash,
+				log.Hash,
+			))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read audit logs: %w", err)
+		}
+		cw.Flush()
+		return cw.Error()
+	case domain.ExportJSONL:
+		enc := json.NewEncoder(w)
+		err := s.auditLogRepo.ForEach(ctx, filter, func(log *domain.AuditLog) error {
+			return enc.Encode(log)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read audit logs: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: format must be csv or jsonl", domain.ErrInvalidFilter)
+	}
 }
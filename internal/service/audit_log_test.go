@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+func TestAuditLogExportCSVIsSpreadsheetSafe(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		details   string
+		want      string
+	}{
+		{name: "plain text", details: "User 1 logged in", want: "User 1 logged in"},
+		{name: "formula", details: `=HYPERLINK("https://evil.example","x")`, want: `'=HYPERLINK("https://evil.example","x")`},
+		{name: "plus", details: "+1+2", want: "'+1+2"},
+		{name: "minus", details: "-2+3", want: "'-2+3"},
+		{name: "at", details: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", details: "\t=1", want: "'\t=1"},
+		{name: "carriage return", details: "\r=1", want: "'\r=1"},
+		{name: "formula later in the text", details: "renamed to =1", want: "renamed to =1"},
+		{name: "user agent", userAgent: "=cmd|'/c calc'!A1", details: "User 1 logged in", want: "User 1 logged in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery("FROM audit_logs").WillReturnRows(sqlmock.NewRows([]string{
+				"id", "entity_type", "entity_id", "action", "actor_type", "actor_id", "request_id", "ip", "user_agent", "details", "changes", "created_at", "prev_hash", "hash",
+			}).AddRow(1, "user", 1, "login", "user", 7, "req-1", "192.0.2.1", tt.userAgent, tt.details, nil, time.Now(), nil, "abc"))
+
+			s := NewAuditLogService(db, repository.NewAuditLogRepository(db), nil, discardLogger)
+			var buf bytes.Buffer
+			if err := s.Export(context.Background(), domain.AuditLogFilter{}, domain.ExportCSV, &buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			row := records[1]
+			if got := row[10]; got != tt.want {
+				t.Errorf("details = %q, want %q", got, tt.want)
+			}
+			if tt.userAgent != "" && row[9] != "'"+tt.userAgent {
+				t.Errorf("user_agent = %q, want it quoted", row[9])
+			}
+			if got := row[6]; got != "7" {
+				t.Errorf("actor_id = %q, want 7", got)
+			}
+		})
+	}
+}
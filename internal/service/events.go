@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/events"
+)
+
+// newEvent wraps data in an envelope correlated with the request in ctx.
+func newEvent(ctx context.Context, data domain.EventData) (*domain.Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	event := &domain.Event{
+		ID:         uuid.New().String(),
+		Type:       data.EventType(),
+		Version:    data.EventVersion(),
+		OccurredAt: time.Now().UTC(),
+		Data:       payload,
+	}
+	event.CorrelationID = event.ID
+	if request, ok := domain.RequestInfoFromContext(ctx); ok && request.RequestID != "" {
+		event.CorrelationID = request.RequestID
+	}
+	return event, nil
+}
+
+// enqueueEvents writes an event for each of data to outbox, which should belong to the transaction
+// making the change. The events are published by the outbox relay once the change is committed.
+func enqueueEvents(ctx context.Context, outbox domain.OutboxRepository, data ...domain.EventData) error {
+	for _, d := range data {
+		event, err := newEvent(ctx, d)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", d.EventType(), err)
+		}
+		msg, err := domain.NewOutboxMessage(domain.TopicEvents, event)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", d.EventType(), err)
+		}
+		if err := outbox.Create(ctx, msg); err != nil {
+			return fmt.Errorf("failed to write %s event to the outbox: %w", d.EventType(), err)
+		}
+	}
+	return nil
+}
+
+// eventSink publishes the events of the outbox.
+type eventSink struct {
+	publisher events.Publisher
+}
+
+func NewEventSink(publisher events.Publisher) OutboxSink {
+	return &eventSink{publisher: publisher}
+}
+
+func (s *eventSink) Deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	var event domain.Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	return s.publisher.Publish(ctx, &event)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/events"
+)
+
+func TestEventSinkPublishesEventData(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		data        domain.EventData
+		wantVersion int
+		wantFields  []string
+	}{
+		{
+			name:        "user registered carries no personal data",
+			data:        domain.UserRegistered{UserID: 1, RegisteredAt: now},
+			wantVersion: 2,
+			wantFields:  []string{"registered_at", "user_id"},
+		},
+		{
+			name:        "transfer completed",
+			data:        domain.TransferCompleted{TransactionID: 3, FromUserID: 1, ToUserID: 2, Amount: 25, CompletedAt: now},
+			wantVersion: 1,
+			wantFields:  []string{"amount", "completed_at", "from_user_id", "to_user_id", "transaction_id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published *domain.Event
+			publisher := events.NewInProcessPublisher()
+			publisher.Subscribe("*", func(_ context.Context, event *domain.Event) error {
+				published = event
+				return nil
+			})
+
+			event, err := newEvent(context.Background(), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := domain.NewOutboxMessage(domain.TopicEvents, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := NewEventSink(publisher).Deliver(context.Background(), msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if published == nil {
+				t.Fatal("event was not published")
+			}
+			if published.ID != event.ID || published.Type != tt.data.EventType() || published.Version != tt.wantVersion {
+				t.Errorf("published %s %s v%d, want %s %s v%d", published.ID, published.Type, published.Version, event.ID, tt.data.EventType(), tt.wantVersion)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(published.Data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if got := slices.Sorted(maps.Keys(fields)); !slices.Equal(got, tt.wantFields) {
+				t.Errorf("data has fields %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
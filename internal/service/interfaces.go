@@ -2,29 +2,131 @@ package service
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/iso20022"
 )
 
 type UserService interface {
 	Register(ctx context.Context, username, email, password string) (*domain.User, error)
 	Login(ctx context.Context, email, password string) (*domain.User, error)
 	GetByID(ctx context.Context, userID int64) (*domain.User, error)
-	GetAllUsers(ctx context.Context) ([]domain.User, error)
+	ListUsers(ctx context.Context, filter domain.UserFilter) (*domain.UserPage, error)
 	Delete(ctx context.Context, userID int64) error
+	UpdateProfile(ctx context.Context, userID int64, username string) (*domain.User, error)
+	RequestEmailChange(ctx context.Context, userID int64, email string) error
+	ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error)
+	ChangePassword(ctx context.Context, userID int64, sessionID string, currentPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type SessionService interface {
+	Create(ctx context.Context, userID int64, device, userAgent, ipAddress string) (*domain.Session, error)
+	Validate(ctx context.Context, sessionID string, userID int64) (*domain.Session, error)
+	ListActive(ctx context.Context, userID int64) ([]domain.Session, error)
+	Revoke(ctx context.Context, userID int64, sessionID string) error
+	StartImpersonation(ctx context.Context, actorID, subjectID int64, reason string, readOnly bool, userAgent, ipAddress string) (*domain.Session, error)
+	ListImpersonations(ctx context.Context) ([]domain.Session, error)
+	RevokeImpersonation(ctx context.Context, actorID int64, sessionID string) error
 }
 type TransactionService interface {
+	// CheckTransfer, CheckCredit and CheckDebit report the errors a queued transfer, credit or debit
+	// would fail with.
+	CheckTransfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) error
+	CheckCredit(ctx context.Context, userID int64, amount float64) error
+	CheckDebit(ctx context.Context, userID int64, amount float64) error
 	Transfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) (*domain.Transaction, error)
 	Credit(ctx context.Context, userID int64, amount float64) (*domain.Transaction, error)
 	Debit(ctx context.Context, userID int64, amount float64) (*domain.Transaction, error)
-	GetTransactionHistory(ctx context.Context, userID int64) ([]domain.Transaction, error)
+	GetTransactionHistory(ctx context.Context, filter domain.TransactionFilter) (*domain.TransactionPage, error)
 	GetByTransactionID(ctx context.Context, id int64) (*domain.Transaction, error)
 }
 
+type StatementService interface {
+	Generate(ctx context.Context, req domain.StatementRequest, w io.Writer) error
+	StartJob(ctx context.Context, req domain.StatementRequest) (*domain.StatementJob, error)
+	GetJob(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, error)
+	// GetJobFile returns a nil file while the job has not completed. The caller closes the file.
+	GetJobFile(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, io.ReadSeekCloser, error)
+	// RunJobs generates the statement jobs until ctx is done.
+	RunJobs(ctx context.Context, interval time.Duration)
+}
+
+type PaymentImportService interface {
+	ImportPain001(ctx context.Context, principal *domain.Principal, anyDebtor bool, doc *iso20022.Pain001) (*iso20022.Pain002, []domain.PaymentInstruction, error)
+}
+
 type BalanceService interface {
 	GetCurrent(ctx context.Context, userID int64) (*domain.Balance, error)
 }
 
+type RoleService interface {
+	GetUserPermissions(ctx context.Context, userID int64) ([]domain.Permission, error)
+	ListRoles(ctx context.Context) ([]domain.Role, error)
+	AssignRole(ctx context.Context, userID int64, roleName string) (*domain.User, error)
+}
+
+type ServiceAccountService interface {
+	Create(ctx context.Context, name string, scopes []domain.Permission) (*domain.ServiceAccount, string, error)
+	GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error)
+	List(ctx context.Context) ([]domain.ServiceAccount, error)
+	CreateAPIKey(ctx context.Context, accountID int64, name string, scopes []domain.Permission, expiresAt *time.Time) (*domain.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, accountID int64) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID, keyID int64) error
+	AuthenticateAPIKey(ctx context.Context, rawKey string) (*domain.Principal, error)
+	AuthenticateClient(ctx context.Context, clientID, clientSecret string, requested []domain.Permission) (*domain.ServiceAccount, []domain.Permission, error)
+}
+
 type AuditLogService interface {
 	Log(ctx context.Context, entityType string, entityID int64, action string, details string) (*domain.AuditLog, error)
+	LogChange(ctx context.Context, entityType string, entityID int64, action string, details string, before, after interface{}) (*domain.AuditLog, error)
+	Enqueue(ctx context.Context, outbox domain.OutboxRepository, entityType string, entityID int64, action string, details string, before, after interface{}) error
+	OutboxSink
+	ListLogs(ctx context.Context, filter domain.AuditLogFilter) (*domain.AuditLogPage, error)
+	Export(ctx context.Context, filter domain.AuditLogFilter, format domain.ExportFormat, w io.Writer) error
+	Checkpoint(ctx context.Context) (*domain.AuditCheckpoint, error)
+	RunCheckpoints(ctx context.Context, interval time.Duration)
+	Verify(ctx context.Context) (*domain.AuditChainReport, error)
+}
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, userID int64, url string, eventTypes []string, secret string) (*domain.WebhookSubscription, string, error)
+	ListSubscriptions(ctx context.Context, userID int64) ([]domain.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, userID, id int64) (*domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, userID, id int64) error
+	ListDeliveries(ctx context.Context, userID int64, filter domain.WebhookDeliveryFilter) (*domain.WebhookDeliveryPage, error)
+	Redeliver(ctx context.Context, userID, subscriptionID, deliveryID int64) (*domain.WebhookDelivery, error)
+	RunDeliveries(ctx context.Context, interval time.Duration)
+	OutboxSink
+}
+
+type NotificationService interface {
+	List(ctx context.Context, filter domain.NotificationFilter) (*domain.NotificationPage, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	MarkRead(ctx context.Context, userID, id int64) error
+	MarkAllRead(ctx context.Context, userID int64) (int64, error)
+	GetPreferences(ctx context.Context, userID int64) (*domain.NotificationPreferences, error)
+	UpdatePreferences(ctx context.Context, userID int64, email map[domain.NotificationType]bool) (*domain.NotificationPreferences, error)
+	OutboxSink
+}
+
+type LiveUpdateService interface {
+	Subscribe(ctx context.Context, userID int64, lastEventID string) (<-chan domain.LiveUpdate, error)
+	Run(ctx context.Context)
+	OutboxSink
+}
+
+// OutboxSink receives the outbox messages of the topics it is subscribed to. A message can be
+// delivered more than once, Deliver must then have no further effect.
+type OutboxSink interface {
+	Deliver(ctx context.Context, msg *domain.OutboxMessage) error
+}
+
+type OutboxRelay interface {
+	// Subscribe adds sink to topic. Sinks must be subscribed before Run.
+	Subscribe(topic string, sink OutboxSink)
+	Run(ctx context.Context, interval time.Duration)
 }
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+const (
+	// The stream and pub/sub channel of a user's updates are both named prefix + user ID.
+	liveUpdatePrefix = "updates:user:"
+	// Each user's recent updates are kept in a Redis stream for clients that reconnect.
+	liveUpdateRetention    = 1000
+	liveUpdateRetentionTTL = 24 * time.Hour
+	// Updates a slow client can fall behind by before its stream is closed. It then reconnects
+	// and catches up from the stream in Redis.
+	liveUpdateBuffer = 64
+)
+
+// liveUpdateTypes are the events pushed to users' streams.
+var liveUpdateTypes = []string{domain.EventBalanceChanged, domain.EventTransferCompleted, domain.EventTransferFailed}
+
+func liveUpdateKey(userID int64) string {
+	return liveUpdatePrefix + strconv.FormatInt(userID, 10)
+}
+
+type liveUpdateService struct {
+	rdb *redis.Client
+
+	mu          sync.Mutex
+	subscribers map[int64]map[chan domain.LiveUpdate]struct{}
+	logger      *slog.Logger
+}
+
+func NewLiveUpdateService(rdb *redis.Client, logger *slog.Logger) LiveUpdateService {
+	return &liveUpdateService{
+		rdb:         rdb,
+		subscribers: make(map[int64]map[chan domain.LiveUpdate]struct{}),
+		logger:      logger,
+	}
+}
+
+// Deliver stores the event in the stream of every user it concerns and announces it on the
+// users' pub/sub channels, which every instance listens to in Run.
+func (s *liveUpdateService) Deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	var event domain.Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	if !slices.Contains(liveUpdateTypes, event.Type) {
+		return nil
+	}
+	userIDs, err := event.UserIDs()
+	if err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+	}
+
+	for _, userID := range userIDs {
+		key := liveUpdateKey(userID)
+		// A redelivered event is stored again with a new ID, clients recognise it by the event ID.
+		id, err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: liveUpdateRetention,
+			Approx: true,
+			Values: map[string]interface{}{"event": string(msg.Payload)},
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to store live update: %w", err)
+		}
+		s.rdb.Expire(ctx, key, liveUpdateRetentionTTL)
+
+		data, err := json.Marshal(domain.LiveUpdate{ID: id, Event: &event})
+		if err != nil {
+			return err
+		}
+		if err := s.rdb.Publish(ctx, key, data).Err(); err != nil {
+			return fmt.Errorf("failed to publish live update: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run forwards the updates published by any instance to the streams open on this one, until
+// ctx is cancelled. A single pattern subscription serves every user.
+func (s *liveUpdateService) Run(ctx context.Context) {
+	pubsub := s.rdb.PSubscribe(ctx, liveUpdatePrefix+"*")
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			userID, err := strconv.ParseInt(strings.TrimPrefix(msg.Channel, liveUpdatePrefix), 10, 64)
+			if err != nil {
+				continue
+			}
+			var update domain.LiveUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				s.logger.ErrorContext(ctx, "invalid live update", "channel", msg.Channel, "error", err)
+				continue
+			}
+			s.broadcast(userID, update)
+		}
+	}
+}
+
+// broadcast hands update to every stream of the user without waiting. A stream that has fallen
+// too far behind is closed.
+func (s *liveUpdateService) broadcast(userID int64, update domain.LiveUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers[userID] {
+		select {
+		case ch <- update:
+		default:
+			delete(s.subscribers[userID], ch)
+			close(ch)
+		}
+	}
+}
+
+func (s *liveUpdateService) register(userID int64) chan domain.LiveUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan domain.LiveUpdate, liveUpdateBuffer)
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan domain.LiveUpdate]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+func (s *liveUpdateService) unregister(userID int64, ch chan domain.LiveUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[userID][ch]; ok {
+		delete(s.subscribers[userID], ch)
+		close(ch)
+	}
+	if len(s.subscribers[userID]) == 0 {
+		delete(s.subscribers, userID)
+	}
+}
+
+// Subscribe streams the user's updates until ctx is cancelled or the client falls behind, when
+// the returned channel is closed. With lastEventID the updates after it are replayed first.
+func (s *liveUpdateService) Subscribe(ctx context.Context, userID int64, lastEventID string) (<-chan domain.LiveUpdate, error) {
+	if lastEventID != "" {
+		if _, _, ok := parseStreamID(lastEventID); !ok {
+			return nil, fmt.Errorf("%w: Last-Event-ID is not a valid event ID", domain.ErrInvalidCursor)
+		}
+	}
+
+	// Registered before reading the backlog, an update arriving in between is not missed.
+	live := s.register(userID)
+
+	var backlog []domain.LiveUpdate
+	if lastEventID != "" {
+		messages, err := s.rdb.XRangeN(ctx, liveUpdateKey(userID), "("+lastEventID, "+", liveUpdateRetention).Result()
+		if err != nil {
+			s.unregister(userID, live)
+			return nil, fmt.Errorf("failed to read missed updates: %w", err)
+		}
+		for _, m := range messages {
+			var event domain.Event
+			data, _ := m.Values["event"].(string)
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+			backlog = append(backlog, domain.LiveUpdate{ID: m.ID, Event: &event})
+		}
+	}
+
+	out := make(chan domain.LiveUpdate)
+	go func() {
+		defer close(out)
+		defer s.unregister(userID, live)
+
+		last := lastEventID
+		send := func(update domain.LiveUpdate) bool {
+			select {
+			case out <- update:
+				last = update.ID
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, update := range backlog {
+			if !send(update) {
+				return
+			}
+		}
+		for {
+			select {
+			case update, ok := <-live:
+				if !ok {
+					return
+				}
+				// Skips what the backlog already contained.
+				if last != "" && !streamIDAfter(update.ID, last) {
+					continue
+				}
+				if !send(update) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// parseStreamID splits a Redis stream ID of the form <milliseconds>-<sequence>.
+func parseStreamID(id string) (int64, int64, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+func streamIDAfter(a, b string) bool {
+	aMS, aSeq, _ := parseStreamID(a)
+	bMS, bSeq, _ := parseStreamID(b)
+	return aMS > bMS || (aMS == bMS && aSeq > bSeq)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/mailer"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+type notificationService struct {
+	db               *sql.DB
+	notificationRepo domain.NotificationRepository
+	userRepo         domain.UserRepository
+	auditService     AuditLogService
+	sender           mailer.Sender
+	// A balance.changed event that takes a balance below this creates a low balance notification.
+	lowBalanceThreshold float64
+	logger              *slog.Logger
+}
+
+func NewNotificationService(db *sql.DB, repo domain.NotificationRepository, userRepo domain.UserRepository, auditService AuditLogService, sender mailer.Sender, lowBalanceThreshold float64, logger *slog.Logger) NotificationService {
+	return &notificationService{
+		db:                  db,
+		notificationRepo:    repo,
+		userRepo:            userRepo,
+		auditService:        auditService,
+		sender:              sender,
+		lowBalanceThreshold: lowBalanceThreshold,
+		logger:              logger,
+	}
+}
+
+func (s *notificationService) List(ctx context.Context, filter domain.NotificationFilter) (*domain.NotificationPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = domain.DefaultPageSize
+	}
+	if filter.Limit > domain.MaxPageSize {
+		filter.Limit = domain.MaxPageSize
+	}
+
+	notifications, err := s.notificationRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.NotificationPage{Notifications: notifications}
+	if len(notifications) > filter.Limit {
+		page.Notifications = notifications[:filter.Limit]
+		page.NextCursor = domain.NotificationCursor{ID: page.Notifications[filter.Limit-1].ID}.Encode()
+	}
+	return page, nil
+}
+
+func (s *notificationService) CountUnread(ctx context.Context, userID int64) (int, error) {
+	return s.notificationRepo.CountUnread(ctx, userID)
+}
+
+func (s *notificationService) MarkRead(ctx context.Context, userID, id int64) error {
+	return s.notificationRepo.MarkRead(ctx, userID, id, time.Now())
+}
+
+func (s *notificationService) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	return s.notificationRepo.MarkAllRead(ctx, userID, time.Now())
+}
+
+// GetPreferences returns the user's choice for every type, the default where they made none.
+func (s *notificationService) GetPreferences(ctx context.Context, userID int64) (*domain.NotificationPreferences, error) {
+	chosen, err := s.notificationRepo.GetEmailPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := &domain.NotificationPreferences{Email: make(map[domain.NotificationType]bool, len(domain.NotificationTypes))}
+	for _, t := range domain.NotificationTypes {
+		prefs.Email[t] = domain.DefaultEmailNotifications[t]
+		if email, ok := chosen[t]; ok {
+			prefs.Email[t] = email
+		}
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences changes the types in email and keeps the others.
+func (s *notificationService) UpdatePreferences(ctx context.Context, userID int64, email map[domain.NotificationType]bool) (*domain.NotificationPreferences, error) {
+	for t := range email {
+		if _, ok := domain.DefaultEmailNotifications[t]; !ok {
+			return nil, fmt.Errorf("%w: unknown notification type %q", domain.ErrInvalidPreferences, t)
+		}
+	}
+
+	before, err := s.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	after := &domain.NotificationPreferences{Email: maps.Clone(before.Email)}
+	maps.Copy(after.Email, email)
+
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewNotificationRepository(tx).SetEmailPreferences(ctx, userID, email); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d updated their notification preferences", userID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", userID, "update_notification_preferences", details, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// Deliver turns the events users should hear about into notifications, and emails those the
+// user asked for. A notification is only stored and emailed once, however often its event is
+// delivered. Emails are not retried, the notification stays in the app.
+func (s *notificationService) Deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	var event domain.Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	notifications, err := s.notificationsFor(&event)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+	}
+
+	for _, n := range notifications {
+		created, err := s.notificationRepo.Create(ctx, n)
+		if err != nil {
+			return fmt.Errorf("failed to store notification: %w", err)
+		}
+		if created {
+			s.email(ctx, n)
+		}
+	}
+	return nil
+}
+
+func (s *notificationService) notificationsFor(event *domain.Event) ([]*domain.Notification, error) {
+	newNotification := func(userID int64, t domain.NotificationType, title, body string) *domain.Notification {
+		return &domain.Notification{
+			UserID:    userID,
+			Type:      t,
+			Title:     title,
+			Body:      body,
+			EventID:   event.ID,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	switch event.Type {
+	case domain.EventTransferCompleted:
+		var data domain.TransferCompleted
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return nil, err
+		}
+		body := fmt.Sprintf("You received %.2f from user %d.", data.Amount, data.FromUserID)
+		return []*domain.Notification{newNotification(data.ToUserID, domain.NotificationTransferReceived, "You received a transfer", body)}, nil
+
+	case domain.EventTransferFailed:
+		var data domain.TransferFailed
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return nil, err
+		}
+		body := fmt.Sprintf("Your transfer of %.2f to user %d failed: %s. No money was moved.", data.Amount, data.ToUserID, data.Reason)
+		return []*domain.Notification{newNotification(data.FromUserID, domain.NotificationTransferFailed, "Your transfer failed", body)}, nil
+
+	case domain.EventBalanceChanged:
+		var data domain.BalanceChanged
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return nil, err
+		}
+		// Only the change that crosses the threshold notifies, not every payment below it.
+		if data.Delta >= 0 || data.Balance >= s.lowBalanceThreshold || data.Balance-data.Delta < s.lowBalanceThreshold {
+			return nil, nil
+		}
+		body := fmt.Sprintf("Your balance is %.2f, below %.2f.", data.Balance, s.lowBalanceThreshold)
+		return []*domain.Notification{newNotification(data.UserID, domain.NotificationLowBalance, "Your balance is low", body)}, nil
+
+	case domain.EventNewDeviceLogin:
+		var data domain.NewDeviceLogin
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return nil, err
+		}
+		body := fmt.Sprintf("Your account was logged into from %s (IP address %s) at %s. If this was not you, revoke the session and change your password.",
+			data.Device, data.IPAddress, data.LoggedInAt.UTC().Format(time.RFC1123))
+		return []*domain.Notification{newNotification(data.UserID, domain.NotificationNewDeviceLogin, "New login to your account", body)}, nil
+	}
+	return nil, nil
+}
+
+func (s *notificationService) email(ctx context.Context, n *domain.Notification) {
+	prefs, err := s.GetPreferences(ctx, n.UserID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to get notification preferences", "user_id", n.UserID, "error", err)
+		return
+	}
+	if !prefs.Email[n.Type] {
+		return
+	}
+	user, err := s.userRepo.GetByID(ctx, n.UserID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to get the user to email a notification", "user_id", n.UserID, "notification_id", n.ID, "error", err)
+		return
+	}
+	if err := s.sender.Send(ctx, user.Email, n.Title, n.Body); err != nil {
+		s.logger.ErrorContext(ctx, "failed to email notification", "user_id", n.UserID, "notification_id", n.ID, "error", err)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+const (
+	outboxBatchSize = 100
+	// A message is given up on after this many failed attempts, about ten hours with the backoff below.
+	maxOutboxAttempts = 20
+	maxOutboxBackoff  = time.Hour
+	// Claimed messages are left alone by other relays for this long. A relay that dies before
+	// recording the outcome leaves them to be delivered again once it runs out.
+	outboxLease = 5 * time.Minute
+)
+
+var (
+	outboxDeliveredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_delivered_total",
+		Help: "Total number of outbox messages delivered to their sinks.",
+	}, []string{"topic"})
+
+	outboxFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_delivery_failures_total",
+		Help: "Total number of failed outbox delivery attempts.",
+	}, []string{"topic"})
+
+	outboxDeadTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_dead_total",
+		Help: "Total number of outbox messages given up on after their last attempt.",
+	}, []string{"topic"})
+
+	outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_pending",
+		Help: "Number of outbox messages waiting to be delivered.",
+	})
+
+	outboxDeliveryLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "outbox_delivery_lag_seconds",
+		Help:    "Time from writing an outbox message to delivering it, in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+	}, []string{"topic"})
+)
+
+type outboxRelay struct {
+	db         *sql.DB
+	outboxRepo domain.OutboxRepository
+	sinks      map[string][]OutboxSink
+	logger     *slog.Logger
+}
+
+func NewOutboxRelay(db *sql.DB, repo domain.OutboxRepository, logger *slog.Logger) OutboxRelay {
+	return &outboxRelay{
+		db:         db,
+		outboxRepo: repo,
+		sinks:      make(map[string][]OutboxSink),
+		logger:     logger,
+	}
+}
+
+func (r *outboxRelay) Subscribe(topic string, sink OutboxSink) {
+	r.sinks[topic] = append(r.sinks[topic], sink)
+}
+
+// Run delivers the due messages every interval until ctx is cancelled. Relays on several
+// instances share the work, a message is claimed by one of them at a time.
+func (r *outboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayDue(ctx)
+		}
+	}
+}
+
+// relayDue delivers batches until no full batch is due, then updates the pending gauge.
+func (r *outboxRelay) relayDue(ctx context.Context) {
+	for {
+		claimed, err := r.relayBatch(ctx)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "outbox relay failed", "error", err)
+			break
+		}
+		if claimed < outboxBatchSize {
+			break
+		}
+	}
+
+	pending, err := r.outboxRepo.CountPending(ctx)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "failed to count pending outbox messages", "error", err)
+		return
+	}
+	outboxPending.Set(float64(pending))
+}
+
+// relayBatch claims a batch of due messages, delivers them and records the outcome of every
+// delivery. No transaction is open while the sinks are called, and it returns how many were claimed.
+func (r *outboxRelay) relayBatch(ctx context.Context) (int, error) {
+	messages, leasedUntil, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range messages {
+		// Past the lease the remaining messages may already be claimed by another relay.
+		if time.Now().After(leasedUntil) {
+			break
+		}
+		msg := &messages[i]
+		if err := r.deliver(ctx, msg); err != nil {
+			outboxFailuresTotal.WithLabelValues(msg.Topic).Inc()
+			msg.Attempts++
+			msg.LastError = truncate(err.Error(), 1000)
+			if msg.Attempts >= maxOutboxAttempts {
+				msg.Status = domain.OutboxDead
+				outboxDeadTotal.WithLabelValues(msg.Topic).Inc()
+				r.logger.ErrorContext(ctx, "giving up on outbox message", "message_id", msg.ID, "topic", msg.Topic, "attempts", msg.Attempts, "error", err)
+			} else {
+				msg.NextAttemptAt = time.Now().Add(outboxBackoff(msg.Attempts))
+				r.logger.WarnContext(ctx, "outbox message failed", "message_id", msg.ID, "topic", msg.Topic, "attempt", msg.Attempts, "error", err)
+			}
+			if err := r.outboxRepo.MarkFailed(ctx, msg); err != nil {
+				return 0, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			continue
+		}
+
+		deliveredAt := time.Now()
+		if err := r.outboxRepo.MarkDelivered(ctx, msg.ID, deliveredAt); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox message delivered: %w", err)
+		}
+		outboxDeliveredTotal.WithLabelValues(msg.Topic).Inc()
+		outboxDeliveryLag.WithLabelValues(msg.Topic).Observe(deliveredAt.Sub(msg.CreatedAt).Seconds())
+	}
+
+	return len(messages), nil
+}
+
+// claim locks a batch of due messages just long enough to lease them, and returns when the lease ends.
+func (r *outboxRelay) claim(ctx context.Context) ([]domain.OutboxMessage, time.Time, error) {
+	var messages []domain.OutboxMessage
+	var leasedUntil time.Time
+	err := withTx(ctx, r.db, func(tx *repository.Tx) error {
+		outboxRepoTx := repository.NewOutboxRepository(tx)
+
+		now := time.Now()
+		claimed, err := outboxRepoTx.ClaimDue(ctx, now, outboxBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to claim outbox messages: %w", err)
+		}
+		ids := make([]int64, len(claimed))
+		for i, msg := range claimed {
+			ids[i] = msg.ID
+		}
+		leasedUntil = now.Add(outboxLease)
+		if err := outboxRepoTx.Lease(ctx, ids, leasedUntil); err != nil {
+			return fmt.Errorf("failed to lease outbox messages: %w", err)
+		}
+		messages = claimed
+		return nil
+	})
+	return messages, leasedUntil, err
+}
+
+// deliver hands msg to every sink of its topic. When one fails the message is retried for all
+// of them, which is why sinks have to tolerate duplicates.
+func (r *outboxRelay) deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	sinks := r.sinks[msg.Topic]
+	if len(sinks) == 0 {
+		return fmt.Errorf("no sink is subscribed to topic %q", msg.Topic)
+	}
+	for _, sink := range sinks {
+		if err := sink.Deliver(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outboxBackoff doubles the wait after every failed attempt, starting at two seconds.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Second << attempts
+	if backoff <= 0 || backoff > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return backoff
+}
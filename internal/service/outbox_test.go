@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+// steps records the order in which the relay's statements and deliveries happen.
+type steps []string
+
+// match returns an argument matcher that records step when its statement runs.
+func (s *steps) match(step string) sqlmock.Argument {
+	return stepMatcher{steps: s, step: step}
+}
+
+type stepMatcher struct {
+	steps *steps
+	step  string
+}
+
+func (m stepMatcher) Match(driver.Value) bool {
+	*m.steps = append(*m.steps, m.step)
+	return true
+}
+
+type recordingSink struct {
+	steps *steps
+	fail  map[int64]bool
+}
+
+func (s recordingSink) Deliver(_ context.Context, msg *domain.OutboxMessage) error {
+	*s.steps = append(*s.steps, "deliver")
+	if s.fail[msg.ID] {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func TestOutboxRelayDeliversAfterLeaseIsCommitted(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail lists the messages whose delivery fails.
+		fail map[int64]bool
+		// outcome is the statement recording the outcome of each message.
+		outcome string
+		args    int
+	}{
+		{name: "delivered", outcome: "UPDATE outbox SET status = \\?, delivered_at", args: 3},
+		{name: "failed", fail: map[int64]bool{1: true}, outcome: "UPDATE outbox SET status = \\?, attempts", args: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var order steps
+			leasedUntil := &capture{}
+			now := time.Now()
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT id, topic, payload, status, attempts, next_attempt_at, last_error, created_at FROM outbox").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "payload", "status", "attempts", "next_attempt_at", "last_error", "created_at"}).
+					AddRow(1, domain.TopicEvents, "{}", domain.OutboxPending, 0, now, nil, now))
+			mock.ExpectExec("UPDATE outbox SET next_attempt_at").
+				WithArgs(leasedUntil, order.match("lease")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			outcomeArgs := []driver.Value{order.match("record")}
+			for len(outcomeArgs) < tt.args {
+				outcomeArgs = append(outcomeArgs, sqlmock.AnyArg())
+			}
+			mock.ExpectExec(tt.outcome).WithArgs(outcomeArgs...).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			relay := NewOutboxRelay(db, repository.NewOutboxRepository(db), discardLogger).(*outboxRelay)
+			relay.Subscribe(domain.TopicEvents, recordingSink{steps: &order, fail: tt.fail})
+
+			claimed, err := relay.relayBatch(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claimed != 1 {
+				t.Errorf("claimed %d messages, want 1", claimed)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The expectations are matched in order, so the lease was committed before the outcome
+			// was recorded; the sink has to run in between.
+			if want := (steps{"lease", "deliver", "record"}); !slices.Equal(order, want) {
+				t.Errorf("relay ran %v, want %v", order, want)
+			}
+			until := leasedUntil.values[0].(time.Time)
+			if lease := until.Sub(now); lease < outboxLease || lease > outboxLease+time.Minute {
+				t.Errorf("messages leased for %v, want %v", lease, outboxLease)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/iso20022"
+)
+
+// How long the message ID of an imported payment file is remembered to reject duplicate uploads.
+const paymentMessageIDTTL = 90 * 24 * time.Hour
+
+type paymentImportService struct {
+	userRepo     domain.UserRepository
+	importRepo   domain.PaymentImportRepository
+	outboxRepo   domain.OutboxRepository
+	auditService AuditLogService
+	currency     string
+}
+
+func NewPaymentImportService(userRepo domain.UserRepository, importRepo domain.PaymentImportRepository, outboxRepo domain.OutboxRepository, auditService AuditLogService, currency string) PaymentImportService {
+	return &paymentImportService{
+		userRepo:     userRepo,
+		importRepo:   importRepo,
+		outboxRepo:   outboxRepo,
+		auditService: auditService,
+		currency:     currency,
+	}
+}
+
+// ImportPain001 validates doc and returns its status report with the transfers that were accepted.
+// Without anyDebtor, the principal may only pay from its own account. Nothing is accepted when the
+// group header does not match the file or the message ID was already imported.
+func (s *paymentImportService) ImportPain001(ctx context.Context, principal *domain.Principal, anyDebtor bool, doc *iso20022.Pain001) (*iso20022.Pain002, []domain.PaymentInstruction, error) {
+	report := iso20022.NewPain002(doc, time.Now())
+
+	var count int
+	var sum int64
+	sumValid := true
+	for _, pmt := range doc.PmtInf {
+		for _, tx := range pmt.CdtTrfTxInf {
+			count++
+			cents, err := iso20022.ParseCents(tx.Amount.Value)
+			if err != nil {
+				sumValid = false
+			}
+			sum += cents
+		}
+	}
+	if doc.GrpHdr.NbOfTxs != strconv.Itoa(count) {
+		report.Reject(iso20022.ReasonInvalidNumberOfTxs, fmt.Sprintf("group header declares %s transactions, file contains %d", doc.GrpHdr.NbOfTxs, count))
+		return report, nil, nil
+	}
+	if doc.GrpHdr.CtrlSum != "" {
+		declared, err := iso20022.ParseCents(doc.GrpHdr.CtrlSum)
+		if err != nil || !sumValid || declared != sum {
+			report.Reject(iso20022.ReasonInvalidGroupControlSum, "control sum does not match the sum of the transactions")
+			return report, nil, nil
+		}
+	}
+
+	var instructions []domain.PaymentInstruction
+	for _, pmt := range doc.PmtInf {
+		status, accepted, err := s.validatePaymentInformation(ctx, principal, anyDebtor, pmt)
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Report.OrgnlPmts = append(report.Report.OrgnlPmts, status)
+		instructions = append(instructions, accepted...)
+	}
+
+	// Claimed only once the file is known to be valid, so a rejected file can be corrected and sent again.
+	owner := fmt.Sprintf("%s:%d", principal.Type, principal.ID)
+	claimed, err := s.importRepo.ClaimMessageID(ctx, owner, doc.GrpHdr.MsgId, paymentMessageIDTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record message ID: %w", err)
+	}
+	if !claimed {
+		report.Reject(iso20022.ReasonDuplicateMessageID, "a file with this message ID was already imported")
+		return report, nil, nil
+	}
+
+	report.Finish()
+
+	details := fmt.Sprintf("%s %d imported %s %q: %d transfers accepted, %d rejected", principal.Type, principal.ID, doc.MessageName(), doc.GrpHdr.MsgId, report.Accepted(), report.Rejected())
+	if err := s.auditService.Enqueue(ctx, s.outboxRepo, "payment_import", principal.ID, "import_pain001", details, nil, nil); err != nil {
+		// Nothing is booked without the audit entry, so the same file can be sent again.
+		if releaseErr := s.importRepo.ReleaseMessageID(ctx, owner, doc.GrpHdr.MsgId); releaseErr != nil {
+			return nil, nil, errors.Join(err, fmt.Errorf("failed to release message ID: %w", releaseErr))
+		}
+		return nil, nil, err
+	}
+
+	return report, instructions, nil
+}
+
+// validatePaymentInformation checks one debtor block. A block whose debtor or totals are invalid
+// is rejected with all of its transactions.
+func (s *paymentImportService) validatePaymentInformation(ctx context.Context, principal *domain.Principal, anyDebtor bool, pmt iso20022.PaymentInformation) (iso20022.OriginalPaymentStatus, []domain.PaymentInstruction, error) {
+	status := iso20022.OriginalPaymentStatus{OrgnlPmtInfId: pmt.PmtInfId}
+
+	reject := func(code, info string) (iso20022.OriginalPaymentStatus, []domain.PaymentInstruction, error) {
+		status.PmtInfSts = iso20022.StatusRejected
+		status.StsRsnInf = []iso20022.StatusReason{{Code: code, AddtlInf: info}}
+		for _, tx := range pmt.CdtTrfTxInf {
+			status.TxInfAndSts = append(status.TxInfAndSts, iso20022.TransactionStatus{
+				OrgnlInstrId:    tx.InstrId,
+				OrgnlEndToEndId: tx.EndToEndId,
+				TxSts:           iso20022.StatusRejected,
+			})
+		}
+		return status, nil, nil
+	}
+
+	if pmt.NbOfTxs != "" && pmt.NbOfTxs != strconv.Itoa(len(pmt.CdtTrfTxInf)) {
+		return reject(iso20022.ReasonInvalidNumberOfTxs, "number of transactions does not match the block")
+	}
+	if pmt.CtrlSum != "" {
+		var sum int64
+		for _, tx := range pmt.CdtTrfTxInf {
+			cents, _ := iso20022.ParseCents(tx.Amount.Value)
+			sum += cents
+		}
+		declared, err := iso20022.ParseCents(pmt.CtrlSum)
+		if err != nil || declared != sum {
+			return reject(iso20022.ReasonInvalidPmtInfControlSum, "control sum does not match the block")
+		}
+	}
+
+	debtorID, err := s.accountUserID(ctx, pmt.DbtrAcct)
+	if err != nil {
+		return status, nil, err
+	}
+	if debtorID == 0 {
+		return reject(iso20022.ReasonInvalidDebtorAccount, "debtor account must be an account ID issued by this bank")
+	}
+	if !anyDebtor && (principal.Type != domain.PrincipalUser || principal.ID != debtorID) {
+		return reject(iso20022.ReasonTransactionForbidden, "payments can only be made from your own account")
+	}
+
+	var instructions []domain.PaymentInstruction
+	seen := make(map[string]bool)
+	for _, tx := range pmt.CdtTrfTxInf {
+		txStatus := iso20022.TransactionStatus{OrgnlInstrId: tx.InstrId, OrgnlEndToEndId: tx.EndToEndId}
+		code, info, creditorID, cents, err := s.validateCreditTransfer(ctx, debtorID, tx, seen)
+		if err != nil {
+			return status, nil, err
+		}
+		if code != "" {
+			txStatus.TxSts = iso20022.StatusRejected
+			txStatus.StsRsnInf = []iso20022.StatusReason{{Code: code, AddtlInf: info}}
+		} else {
+			txStatus.TxSts = iso20022.StatusAccepted
+			instructions = append(instructions, domain.PaymentInstruction{
+				FromUserID: debtorID,
+				ToUserID:   creditorID,
+				Amount:     float64(cents) / 100,
+				EndToEndID: tx.EndToEndId,
+			})
+		}
+		status.TxInfAndSts = append(status.TxInfAndSts, txStatus)
+	}
+
+	switch {
+	case len(instructions) == len(pmt.CdtTrfTxInf):
+		status.PmtInfSts = iso20022.StatusAccepted
+	case len(instructions) == 0:
+		status.PmtInfSts = iso20022.StatusRejected
+	default:
+		status.PmtInfSts = iso20022.StatusPartiallyAccepted
+	}
+	return status, instructions, nil
+}
+
+// validateCreditTransfer returns a reason code when tx has to be rejected.
+func (s *paymentImportService) validateCreditTransfer(ctx context.Context, debtorID int64, tx iso20022.CreditTransfer, seen map[string]bool) (string, string, int64, int64, error) {
+	if tx.EndToEndId != "" && tx.EndToEndId != "NOTPROVIDED" {
+		if seen[tx.EndToEndId] {
+			return iso20022.ReasonDuplication, "end-to-end ID appears more than once in the block", 0, 0, nil
+		}
+		seen[tx.EndToEndId] = true
+	}
+
+	cents, err := iso20022.ParseCents(tx.Amount.Value)
+	if err != nil {
+		return iso20022.ReasonInvalidAmount, err.Error(), 0, 0, nil
+	}
+	if cents == 0 {
+		return iso20022.ReasonZeroAmount, "amount must be greater than zero", 0, 0, nil
+	}
+	if tx.Amount.Ccy != s.currency {
+		return iso20022.ReasonNotAllowedCurrency, fmt.Sprintf("only %s payments are supported", s.currency), 0, 0, nil
+	}
+
+	creditorID, err := s.accountUserID(ctx, tx.CdtrAcct)
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	if creditorID == 0 {
+		return iso20022.ReasonInvalidCreditorAccount, "creditor account is unknown", 0, 0, nil
+	}
+	if creditorID == debtorID {
+		return iso20022.ReasonTransactionForbidden, "creditor and debtor are the same account", 0, 0, nil
+	}
+
+	return "", "", creditorID, cents, nil
+}
+
+// accountUserID maps an account to the user owning it. Accounts are identified by user ID, given as
+// Othr/Id. It returns 0 for IBANs and for IDs that do not belong to a user.
+func (s *paymentImportService) accountUserID(ctx context.Context, account iso20022.Account) (int64, error) {
+	id, err := strconv.ParseInt(account.Other, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, nil
+	}
+	if _, err := s.userRepo.GetByID(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return id, nil
+}
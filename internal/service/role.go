@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+type roleService struct {
+	db           *sql.DB
+	rdb          *redis.Client
+	roleRepo     domain.RoleRepository
+	userRepo     domain.UserRepository
+	auditService AuditLogService
+}
+
+func NewRoleService(db *sql.DB, rdb *redis.Client, roleRepo domain.RoleRepository, userRepo domain.UserRepository, auditService AuditLogService) RoleService {
+	return &roleService{
+		db:           db,
+		rdb:          rdb,
+		roleRepo:     roleRepo,
+		userRepo:     userRepo,
+		auditService: auditService,
+	}
+}
+
+func (s *roleService) GetUserPermissions(ctx context.Context, userID int64) ([]domain.Permission, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.roleRepo.GetByName(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+func (s *roleService) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+func (s *roleService) AssignRole(ctx context.Context, userID int64, roleName string) (*domain.User, error) {
+	role, err := s.roleRepo.GetByName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+
+	user.Role = role.Name
+	user.UpdatedAt = time.Now()
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewUserRepository(tx, s.rdb).Update(ctx, user); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d role changed from %s to %s", user.ID, before.Role, user.Role)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", user.ID, "assign_role", details, before, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than JWTs.
+// A full key looks like "bk_<8 hex lookup prefix>_<64 hex secret>".
+const APIKeyPrefix = "bk_"
+
+// last_used_at is only written when the stored value is older than this,
+// so busy keys do not cause a write on every request.
+const apiKeyTouchInterval = time.Minute
+
+type serviceAccountService struct {
+	db           *sql.DB
+	rdb          *redis.Client
+	accountRepo  domain.ServiceAccountRepository
+	roleRepo     domain.RoleRepository
+	auditService AuditLogService
+}
+
+func NewServiceAccountService(db *sql.DB, rdb *redis.Client, accountRepo domain.ServiceAccountRepository, roleRepo domain.RoleRepository, auditService AuditLogService) ServiceAccountService {
+	return &serviceAccountService{
+		db:           db,
+		rdb:          rdb,
+		accountRepo:  accountRepo,
+		roleRepo:     roleRepo,
+		auditService: auditService,
+	}
+}
+
+// Keys and client secrets are random 256-bit values, so a plain SHA-256 is enough to store them.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func secretMatches(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hash)) == 1
+}
+
+func (s *serviceAccountService) validateScopes(ctx context.Context, scopes []domain.Permission) error {
+	known, err := s.roleRepo.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if !containsPermission(known, scope) {
+			return fmt.Errorf("%w: %s", domain.ErrUnknownScope, scope)
+		}
+	}
+	return nil
+}
+
+func containsPermission(perms []domain.Permission, perm domain.Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *serviceAccountService) Create(ctx context.Context, name string, scopes []domain.Permission) (*domain.ServiceAccount, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name cannot be empty", domain.ErrInvalidServiceAccount)
+	}
+	if err := s.validateScopes(ctx, scopes); err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := &domain.ServiceAccount{
+		Name:             name,
+		ClientID:         "sa_" + clientID[:24],
+		ClientSecretHash: hashSecret(secret),
+		Scopes:           scopes,
+		CreatedAt:        time.Now(),
+	}
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewServiceAccountRepository(tx, s.rdb).Create(ctx, account); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("Service account %s created with scopes %v", account.Name, account.Scopes)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "service_account", account.ID, "create", details, nil, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return account, secret, nil
+}
+
+func (s *serviceAccountService) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	return s.accountRepo.GetByID(ctx, id)
+}
+
+func (s *serviceAccountService) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	return s.accountRepo.List(ctx)
+}
+
+func (s *serviceAccountService) ListAPIKeys(ctx context.Context, accountID int64) ([]domain.APIKey, error) {
+	return s.accountRepo.ListAPIKeys(ctx, accountID)
+}
+
+// CreateAPIKey returns the stored key along with the raw key, which is never retrievable again.
+func (s *serviceAccountService) CreateAPIKey(ctx context.Context, accountID int64, name string, scopes []domain.Permission, expiresAt *time.Time) (*domain.APIKey, string, error) {
+	account, err := s.accountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A key can never hold more than its service account.
+	if len(scopes) == 0 {
+		scopes = account.Scopes
+	}
+	for _, scope := range scopes {
+		if !containsPermission(account.Scopes, scope) {
+			return nil, "", fmt.Errorf("%w: %s is not granted to the service account", domain.ErrUnknownScope, scope)
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expiry must be in the future", domain.ErrInvalidServiceAccount)
+	}
+
+	random, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := random[:8]
+	rawKey := APIKeyPrefix + prefix + "_" + random[8:]
+
+	key := &domain.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             name,
+		Prefix:           prefix,
+		KeyHash:          hashSecret(rawKey),
+		Scopes:           scopes,
+		ExpiresAt:        expiresAt,
+		CreatedAt:        time.Now(),
+	}
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewServiceAccountRepository(tx, s.rdb).CreateAPIKey(ctx, key); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("API key %s (%s) created for service account %d", key.Prefix, key.Name, account.ID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "service_account", account.ID, "create_api_key", details, nil, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, rawKey, nil
+}
+
+func (s *serviceAccountService) RevokeAPIKey(ctx context.Context, accountID, keyID int64) error {
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewServiceAccountRepository(tx, s.rdb).RevokeAPIKey(ctx, accountID, keyID, time.Now()); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("API key %d of service account %d revoked", keyID, accountID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "service_account", accountID, "revoke_api_key", details, nil, nil)
+	})
+}
+
+func (s *serviceAccountService) AuthenticateAPIKey(ctx context.Context, rawKey string) (*domain.Principal, error) {
+	rest, ok := strings.CutPrefix(rawKey, APIKeyPrefix)
+	if !ok {
+		return nil, domain.ErrInvalidCredentials
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	key, err := s.accountRepo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			return nil, domain.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !secretMatches(rawKey, key.KeyHash) {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && key.ExpiresAt.Before(now)) {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.accountRepo.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to record api key usage: %w", err)
+		}
+	}
+
+	return &domain.Principal{
+		Type:   domain.PrincipalService,
+		ID:     key.ServiceAccountID,
+		Scopes: key.Scopes,
+	}, nil
+}
+
+// AuthenticateClient implements the credential check of the OAuth2 client_credentials grant.
+// When no scopes are requested, all scopes of the service account are granted.
+func (s *serviceAccountService) AuthenticateClient(ctx context.Context, clientID, clientSecret string, requested []domain.Permission) (*domain.ServiceAccount, []domain.Permission, error) {
+	account, err := s.accountRepo.GetByClientID(ctx, clientID)
+	if errors.Is(err, domain.ErrServiceAccountNotFound) {
+		return nil, nil, domain.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !secretMatches(clientSecret, account.ClientSecretHash) {
+		return nil, nil, domain.ErrInvalidCredentials
+	}
+
+	if len(requested) == 0 {
+		return account, account.Scopes, nil
+	}
+	for _, scope := range requested {
+		if !containsPermission(account.Scopes, scope) {
+			return nil, nil, fmt.Errorf("%w: %s", domain.ErrUnknownScope, scope)
+		}
+	}
+	return account, requested, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+// SessionTTL is the lifetime of a login session and of the user token bound to it.
+const SessionTTL = 72 * time.Hour
+
+// ImpersonationTTL is deliberately short, support staff request a new token when it runs out.
+const ImpersonationTTL = 15 * time.Minute
+
+// last_seen_at is only written when the stored value is older than this,
+// so active sessions do not cause a write on every request.
+const sessionTouchInterval = time.Minute
+
+// adminPermissions act on other accounts. Users holding any of them cannot be impersonated, the
+// actor would gain privileges their own role does not grant.
+var adminPermissions = []domain.Permission{
+	domain.PermRolesAssign,
+	domain.PermUsersDelete,
+	domain.PermUsersImpersonate,
+	domain.PermServiceAccounts,
+	domain.PermTransactionsCredit,
+	domain.PermTransactionsDebit,
+}
+
+type sessionService struct {
+	db           *sql.DB
+	rdb          *redis.Client
+	sessionRepo  domain.SessionRepository
+	userRepo     domain.UserRepository
+	roleRepo     domain.RoleRepository
+	outboxRepo   domain.OutboxRepository
+	auditService AuditLogService
+	logger       *slog.Logger
+}
+
+func NewSessionService(db *sql.DB, rdb *redis.Client, repo domain.SessionRepository, userRepo domain.UserRepository, roleRepo domain.RoleRepository, outboxRepo domain.OutboxRepository, auditService AuditLogService, logger *slog.Logger) SessionService {
+	return &sessionService{
+		db:           db,
+		rdb:          rdb,
+		sessionRepo:  repo,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		outboxRepo:   outboxRepo,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+func (s *sessionService) Create(ctx context.Context, userID int64, device, userAgent, ipAddress string) (*domain.Session, error) {
+	now := time.Now()
+	if device == "" {
+		device = userAgent
+	}
+	session := &domain.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Device:     truncate(device, 255),
+		UserAgent:  truncate(userAgent, 512),
+		IPAddress:  ipAddress,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+
+	// Counted before the session is stored, a login is only from a new device when the user
+	// logged in before and never from this device.
+	total, onDevice, err := s.sessionRepo.CountDeviceSessions(ctx, userID, session.Device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up known devices: %w", err)
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if total > 0 && onDevice == 0 {
+		event := domain.NewDeviceLogin{
+			UserID:     userID,
+			SessionID:  session.ID,
+			Device:     session.Device,
+			IPAddress:  session.IPAddress,
+			LoggedInAt: now,
+		}
+		if err := enqueueEvents(ctx, s.outboxRepo, event); err != nil {
+			s.logger.ErrorContext(ctx, "failed to publish session.new_device event", "user_id", userID, "session_id", session.ID, "error", err)
+		}
+	}
+	return session, nil
+}
+
+// Validate checks that the session belongs to the user and is still active, and records its use.
+func (s *sessionService) Validate(ctx context.Context, sessionID string, userID int64) (*domain.Session, error) {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if session.UserID != userID {
+		return nil, domain.ErrSessionNotFound
+	}
+	if !session.IsActive(now) {
+		return nil, domain.ErrSessionInactive
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := s.sessionRepo.Touch(ctx, session.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to record session activity: %w", err)
+		}
+	}
+	return session, nil
+}
+
+func (s *sessionService) ListActive(ctx context.Context, userID int64) ([]domain.Session, error) {
+	return s.sessionRepo.ListActiveByUserID(ctx, userID, time.Now())
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userID int64, sessionID string) error {
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewSessionRepository(tx, s.rdb).Revoke(ctx, userID, sessionID, time.Now()); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d revoked session %s", userID, sessionID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", userID, "revoke_session", details, nil, nil)
+	})
+}
+
+// StartImpersonation creates a short-lived session in which the actor acts as the subject user.
+func (s *sessionService) StartImpersonation(ctx context.Context, actorID, subjectID int64, reason string, readOnly bool, userAgent, ipAddress string) (*domain.Session, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required to impersonate a user", domain.ErrInvalidImpersonation)
+	}
+	if actorID == subjectID {
+		return nil, fmt.Errorf("%w: cannot impersonate yourself", domain.ErrInvalidImpersonation)
+	}
+	subject, err := s.userRepo.GetByID(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.roleRepo.GetByName(ctx, subject.Role)
+	if err != nil {
+		return nil, err
+	}
+	for _, perm := range role.Permissions {
+		if slices.Contains(adminPermissions, perm) {
+			return nil, fmt.Errorf("%w: cannot impersonate a user with the %s permission", domain.ErrInvalidImpersonation, perm)
+		}
+	}
+
+	now := time.Now()
+	session := &domain.Session{
+		ID:             uuid.New().String(),
+		UserID:         subject.ID,
+		Device:         fmt.Sprintf("impersonation by user %d", actorID),
+		UserAgent:      truncate(userAgent, 512),
+		IPAddress:      ipAddress,
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(ImpersonationTTL),
+		ImpersonatorID: &actorID,
+	}
+	mode := "read-write"
+	if readOnly {
+		mode = "read-only"
+	}
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewSessionRepository(tx, s.rdb).Create(ctx, session); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d started %s impersonation of user %d in session %s: %s", actorID, mode, subject.ID, session.ID, reason)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", subject.ID, "start_impersonation", details, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *sessionService) ListImpersonations(ctx context.Context) ([]domain.Session, error) {
+	return s.sessionRepo.ListActiveImpersonations(ctx, time.Now())
+}
+
+func (s *sessionService) RevokeImpersonation(ctx context.Context, actorID int64, sessionID string) error {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.ImpersonatorID == nil {
+		return domain.ErrSessionNotFound
+	}
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewSessionRepository(tx, s.rdb).Revoke(ctx, session.UserID, session.ID, time.Now()); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d revoked impersonation session %s of user %d", actorID, session.ID, session.UserID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", session.UserID, "revoke_impersonation", details, nil, nil)
+	})
+}
+
+// truncate shortens s to at most max bytes, the size of the column it is stored in. It never
+// splits a UTF-8 sequence, MySQL rejects the string otherwise.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{name: "short enough", s: "Firefox", max: 10, want: "Firefox"},
+		{name: "exactly max", s: "Firefox", max: 7, want: "Firefox"},
+		{name: "ascii", s: "Mozilla/5.0", max: 7, want: "Mozilla"},
+		{name: "cut before a two byte rune", s: "Safari ü", max: 8, want: "Safari "},
+		{name: "cut inside a four byte rune", s: "ok 🙂 fine", max: 5, want: "ok "},
+		{name: "cut after a rune", s: "çğü", max: 4, want: "çğ"},
+		{name: "first rune does not fit", s: "🙂", max: 2, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q is not valid UTF-8", tt.s, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestStartImpersonationRefusesAdmins(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		permissions []domain.Permission
+		wantErr     error
+	}{
+		{name: "user", role: domain.RoleUser, permissions: []domain.Permission{domain.PermTransactionsRead}},
+		{name: "auditor", role: domain.RoleAuditor, permissions: []domain.Permission{domain.PermAuditRead, domain.PermUsersRead}},
+		{name: "admin", role: domain.RoleAdmin, permissions: []domain.Permission{domain.PermUsersRead, domain.PermRolesAssign}, wantErr: domain.ErrInvalidImpersonation},
+		{name: "support", role: domain.RoleSupport, permissions: []domain.Permission{domain.PermUsersImpersonate}, wantErr: domain.ErrInvalidImpersonation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+
+			mock.ExpectQuery("FROM users WHERE id").WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "role", "created_at", "updated_at"}).
+					AddRow(2, "bob", "bob@example.com", "", tt.role, time.Now(), time.Now()))
+			mock.ExpectQuery("SELECT name, description FROM roles").WithArgs(tt.role).
+				WillReturnRows(sqlmock.NewRows([]string{"name", "description"}).AddRow(tt.role, ""))
+			perms := sqlmock.NewRows([]string{"permission_name"})
+			for _, perm := range tt.permissions {
+				perms.AddRow(perm)
+			}
+			mock.ExpectQuery("SELECT permission_name FROM role_permissions").WithArgs(tt.role).WillReturnRows(perms)
+			if tt.wantErr == nil {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			s := NewSessionService(db, rdb, repository.NewSessionRepository(db, rdb), repository.NewUserRepository(db, rdb),
+				repository.NewRoleRepository(db, rdb, 1), nil, NewAuditLogService(db, nil, nil, discardLogger), discardLogger)
+			_, err = s.StartImpersonation(context.Background(), 1, 2, "Support ticket 123", false, "test", "192.0.2.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/statement"
+)
+
+// Statements covering more than this are generated as background jobs instead of in the request.
+const MaxSyncStatementPeriod = 92 * 24 * time.Hour
+
+// Longest period a single statement can cover.
+const maxStatementPeriod = 5 * 366 * 24 * time.Hour
+
+// How long a generated statement can be downloaded.
+const statementJobTTL = 24 * time.Hour
+
+// Upper bound for generating one statement in the background.
+const statementJobTimeout = 10 * time.Minute
+
+// Number of statement jobs an instance generates at the same time, further jobs wait in the table.
+const maxConcurrentStatementJobs = 2
+
+// A running job's lease is renewed while it is generated. A job whose lease ran out was abandoned
+// by an instance that stopped and is marked failed.
+const (
+	statementJobLease       = time.Minute
+	statementJobLeaseRenew  = statementJobLease / 3
+	statementJobSweepPeriod = time.Minute
+)
+
+const statementJobFailed = "statement generation failed"
+
+type statementService struct {
+	db      *sql.DB
+	rdb     *redis.Client
+	jobRepo domain.StatementJobRepository
+	files   domain.StatementFileStore
+	bank    statement.Institution
+	// wake lets a worker start a new job right away instead of on the next poll.
+	wake   chan struct{}
+	logger *slog.Logger
+}
+
+func NewStatementService(db *sql.DB, rdb *redis.Client, jobRepo domain.StatementJobRepository, files domain.StatementFileStore, bank statement.Institution, logger *slog.Logger) StatementService {
+	return &statementService{
+		db:      db,
+		rdb:     rdb,
+		jobRepo: jobRepo,
+		files:   files,
+		bank:    bank,
+		wake:    make(chan struct{}, 1),
+		logger:  logger,
+	}
+}
+
+func validateStatementRequest(req domain.StatementRequest) error {
+	switch req.Format {
+	case domain.StatementCSV, domain.StatementJSONL, domain.StatementPDF, domain.StatementOFX, domain.StatementCamt053:
+	default:
+		return fmt.Errorf("%w: format must be csv, jsonl, pdf, ofx or camt053", domain.ErrInvalidFilter)
+	}
+	if !req.From.Before(req.To) {
+		return fmt.Errorf("%w: from must be before to", domain.ErrInvalidFilter)
+	}
+	if req.To.Sub(req.From) > maxStatementPeriod {
+		return fmt.Errorf("%w: a statement can cover at most 5 years", domain.ErrInvalidFilter)
+	}
+	return nil
+}
+
+// Generate streams the statement to w. Nothing is written when the request is invalid.
+func (s *statementService) Generate(ctx context.Context, req domain.StatementRequest, w io.Writer) error {
+	if err := validateStatementRequest(req); err != nil {
+		return err
+	}
+
+	// Balances start at zero and only change through transactions, so the opening balance is the sum of
+	// everything before the period. A read-only transaction keeps it consistent with the streamed lines.
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	transactionRepoTx := repository.NewTransactionRepository(tx, s.rdb)
+
+	opening, err := transactionRepoTx.NetAmountBefore(ctx, req.UserID, req.From)
+	if err != nil {
+		return fmt.Errorf("failed to compute opening balance: %w", err)
+	}
+
+	writer, err := statement.NewWriter(req.Format, w)
+	if err != nil {
+		return err
+	}
+	header := statement.Header{
+		AccountID:      req.UserID,
+		Bank:           s.bank,
+		From:           req.From,
+		To:             req.To,
+		OpeningBalance: opening,
+		GeneratedAt:    time.Now(),
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	summary := statement.Summary{ClosingBalance: opening}
+	err = transactionRepoTx.ForEachInRange(ctx, req.UserID, req.From, req.To, func(t *domain.Transaction) error {
+		line := statement.NewLine(req.UserID, t, summary.ClosingBalance)
+		summary.Add(line)
+		return writer.WriteLine(line)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	return writer.Close(summary)
+}
+
+func (s *statementService) StartJob(ctx context.Context, req domain.StatementRequest) (*domain.StatementJob, error) {
+	if err := validateStatementRequest(req); err != nil {
+		return nil, err
+	}
+
+	// MySQL keeps whole seconds, so does the job returned here.
+	now := time.Now().Truncate(time.Second)
+	job := &domain.StatementJob{
+		ID:               uuid.New().String(),
+		StatementRequest: req,
+		Status:           domain.StatementJobPending,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(statementJobTTL),
+	}
+	if err := s.jobRepo.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to save statement job: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// RunJobs generates pending statement jobs with maxConcurrentStatementJobs workers until ctx is
+// done, and returns once the workers stopped. Jobs left running by an instance that stopped are
+// failed first, and then every sweep.
+func (s *statementService) RunJobs(ctx context.Context, interval time.Duration) {
+	s.sweep(ctx)
+
+	var workers sync.WaitGroup
+	for range maxConcurrentStatementJobs {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.work(ctx, interval)
+		}()
+	}
+
+	ticker := time.NewTicker(statementJobSweepPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			workers.Wait()
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *statementService) work(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			ran, err := s.runNext(ctx)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "statement jobs failed", "error", err)
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// sweep fails abandoned jobs and deletes expired ones. Files go first, a file whose job is already
+// gone would never be deleted.
+func (s *statementService) sweep(ctx context.Context) {
+	now := time.Now()
+	failed, err := s.jobRepo.FailAbandoned(ctx, now, statementJobFailed)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to fail abandoned statement jobs", "error", err)
+	} else if failed > 0 {
+		s.logger.WarnContext(ctx, "abandoned statement jobs failed", "count", failed)
+	}
+
+	ids, err := s.jobRepo.ListExpired(ctx, now)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list expired statement jobs", "error", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.files.Delete(ctx, id); err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete statement file", "job_id", id, "error", err)
+			return
+		}
+	}
+	if err := s.jobRepo.DeleteExpired(ctx, now); err != nil {
+		s.logger.ErrorContext(ctx, "failed to delete expired statement jobs", "error", err)
+	}
+}
+
+// runNext claims the oldest pending job and generates it. It returns false when no job was pending.
+func (s *statementService) runNext(ctx context.Context) (bool, error) {
+	var job *domain.StatementJob
+	err := withTx(ctx, s.db, func(tx *repository.Tx) error {
+		jobRepoTx := repository.NewStatementJobRepository(tx)
+		var err error
+		if job, err = jobRepoTx.ClaimPending(ctx); err != nil || job == nil {
+			return err
+		}
+		return jobRepoTx.MarkRunning(ctx, job.ID, time.Now().Add(statementJobLease))
+	})
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, statementJobTimeout)
+	defer cancel()
+	go s.renewLease(jobCtx, job.ID)
+
+	err = s.files.Write(jobCtx, job.ID, func(w io.Writer) error {
+		return s.Generate(jobCtx, job.StatementRequest, w)
+	})
+	cancel()
+
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	if err != nil {
+		s.logger.ErrorContext(ctx, "statement job failed", "job_id", job.ID, "user_id", job.UserID, "error", err)
+		job.Status = domain.StatementJobFailed
+		job.Error = statementJobFailed
+	} else {
+		job.Status = domain.StatementJobCompleted
+	}
+
+	// A job cut short by shutdown is still recorded, rather than left for the sweep.
+	if err := s.jobRepo.Finish(context.WithoutCancel(ctx), job); err != nil {
+		return true, fmt.Errorf("failed to update statement job %s: %w", job.ID, err)
+	}
+	return true, nil
+}
+
+// renewLease keeps the job leased until ctx is done.
+func (s *statementService) renewLease(ctx context.Context, jobID string) {
+	ticker := time.NewTicker(statementJobLeaseRenew)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.jobRepo.RenewLease(ctx, jobID, time.Now().Add(statementJobLease)); err != nil {
+				s.logger.ErrorContext(ctx, "failed to renew the lease of statement job", "job_id", jobID, "error", err)
+			}
+		}
+	}
+}
+
+// GetJob only returns jobs of the given user, other users' jobs are reported as not found.
+func (s *statementService) GetJob(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, error) {
+	job, err := s.jobRepo.Get(ctx, jobID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, domain.ErrStatementJobNotFound
+	}
+	return job, nil
+}
+
+func (s *statementService) GetJobFile(ctx context.Context, userID int64, jobID string) (*domain.StatementJob, io.ReadSeekCloser, error) {
+	job, err := s.GetJob(ctx, userID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != domain.StatementJobCompleted {
+		return job, nil, nil
+	}
+
+	file, err := s.files.Open(ctx, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, file, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/statement"
+)
+
+const testJobID = "0b5e6f3c-8f3a-4f43-9a52-3c7c1d1e2f10"
+
+var statementJobRows = []string{"id", "user_id", "period_from", "period_to", "format", "status", "error", "created_at", "completed_at", "expires_at"}
+
+func newTestStatementService(t *testing.T) (*statementService, sqlmock.Sqlmock, domain.StatementFileStore) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	files, err := repository.NewStatementFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStatementService(db, nil, repository.NewStatementJobRepository(db), files, statement.Institution{Currency: "EUR"}, discardLogger)
+	return s.(*statementService), mock, files
+}
+
+func TestStatementServiceRunsNextJob(t *testing.T) {
+	tests := []struct {
+		name string
+		// pending reports whether a job is waiting.
+		pending bool
+		// generateErr fails reading the transactions.
+		generateErr error
+		wantStatus  domain.StatementJobStatus
+		wantFile    string
+	}{
+		{name: "no pending job"},
+		{
+			name:       "completed",
+			pending:    true,
+			wantStatus: domain.StatementJobCompleted,
+			wantFile: "date,transaction_id,type,description,counterparty_id,amount,balance\n" +
+				"2026-01-01T00:00:00Z,,,Opening balance,,,0.00\n" +
+				"2026-01-02T00:00:00Z,7,credit,Credit from bank,0,25.00,25.00\n" +
+				",,,Closing balance,,,25.00\n",
+		},
+		{name: "generation fails", pending: true, generateErr: errors.New("connection reset"), wantStatus: domain.StatementJobFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock, files := newTestStatementService(t)
+			now := time.Now()
+			periodFrom := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			mock.ExpectBegin()
+			rows := sqlmock.NewRows(statementJobRows)
+			if tt.pending {
+				rows.AddRow(testJobID, 1, periodFrom, periodFrom.AddDate(0, 6, 0), domain.StatementCSV, domain.StatementJobPending, nil, now, nil, now.Add(statementJobTTL))
+			}
+			mock.ExpectQuery("FROM statement_jobs WHERE status = \\? ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED").
+				WithArgs(domain.StatementJobPending).WillReturnRows(rows)
+			if tt.pending {
+				mock.ExpectExec("UPDATE statement_jobs SET status = \\?, lease_until").
+					WithArgs(domain.StatementJobRunning, sqlmock.AnyArg(), testJobID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			if tt.pending {
+				mock.ExpectBegin()
+				opening := mock.ExpectQuery("SELECT")
+				if tt.generateErr != nil {
+					opening.WillReturnError(tt.generateErr)
+				} else {
+					opening.WillReturnRows(sqlmock.NewRows([]string{"net"}).AddRow(0))
+					mock.ExpectQuery("FROM transactions").WillReturnRows(sqlmock.NewRows([]string{"id", "from_user_id", "to_user_id", "amount", "transaction_type", "status", "created_at"}).
+						AddRow(7, 0, 1, 25, "credit", domain.StatusCompleted, periodFrom.AddDate(0, 0, 1)))
+				}
+				mock.ExpectRollback()
+				mock.ExpectExec("UPDATE statement_jobs SET status = \\?, error = \\?, completed_at").
+					WithArgs(tt.wantStatus, sqlmock.AnyArg(), sqlmock.AnyArg(), testJobID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			ran, err := s.runNext(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ran != tt.pending {
+				t.Errorf("ran = %v, want %v", ran, tt.pending)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := files.Open(context.Background(), testJobID)
+			if tt.wantFile == "" {
+				if !errors.Is(err, domain.ErrStatementJobNotFound) {
+					t.Errorf("file of the job: %v, want none", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			data, _ := io.ReadAll(file)
+			if string(data) != tt.wantFile {
+				t.Errorf("file holds %q, want %q", data, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestStatementServiceSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		abandoned int64
+		expired   []string
+	}{
+		{name: "nothing to do"},
+		{name: "abandoned jobs fail", abandoned: 2},
+		{name: "expired jobs are deleted with their files", expired: []string{testJobID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock, files := newTestStatementService(t)
+			ctx := context.Background()
+			for _, id := range tt.expired {
+				if err := files.Write(ctx, id, func(w io.Writer) error { return nil }); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mock.ExpectExec("UPDATE statement_jobs SET status = \\?, error = \\?, completed_at = \\?, lease_until = NULL WHERE status = \\? AND lease_until <= \\?").
+				WithArgs(domain.StatementJobFailed, statementJobFailed, sqlmock.AnyArg(), domain.StatementJobRunning, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, tt.abandoned))
+			rows := sqlmock.NewRows([]string{"id"})
+			for _, id := range tt.expired {
+				rows.AddRow(id)
+			}
+			mock.ExpectQuery("SELECT id FROM statement_jobs WHERE expires_at").WillReturnRows(rows)
+			mock.ExpectExec("DELETE FROM statement_jobs WHERE expires_at").WillReturnResult(sqlmock.NewResult(0, int64(len(tt.expired))))
+
+			s.sweep(ctx)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tt.expired {
+				if _, err := files.Open(ctx, id); !errors.Is(err, domain.ErrStatementJobNotFound) {
+					t.Errorf("file of expired job %s was kept: %v", id, err)
+				}
+			}
+		})
+	}
+}
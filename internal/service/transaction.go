@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -18,27 +19,117 @@ type transactionService struct {
 	transactionRepo domain.TransactionRepository
 	balanceRepo     domain.BalanceRepository
 	auditService    AuditLogService
+	logger          *slog.Logger
 }
 
-func NewTransactionService(db *sql.DB, rdb *redis.Client, txRepo domain.TransactionRepository, balanceRepo domain.BalanceRepository, auditService AuditLogService) TransactionService {
+func NewTransactionService(db *sql.DB, rdb *redis.Client, txRepo domain.TransactionRepository, balanceRepo domain.BalanceRepository, auditService AuditLogService, logger *slog.Logger) TransactionService {
 	return &transactionService{
 		db:              db,
 		rdb:             rdb,
 		transactionRepo: txRepo,
 		balanceRepo:     balanceRepo,
 		auditService:    auditService,
+		logger:          logger,
 	}
 }
 
+// Transfer moves amount between two users. Transfers are queued, so a failure is also published
+// as a transfer.failed event for the sender, who is no longer waiting for the response.
 func (s *transactionService) Transfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) (*domain.Transaction, error) {
+	transaction, err := s.transfer(ctx, fromUserID, toUserID, amount)
+	if err != nil {
+		reason := "the transfer could not be processed"
+		switch {
+		case errors.Is(err, domain.ErrInsufficientFunds):
+			reason = domain.ErrInsufficientFunds.Error()
+		case errors.Is(err, domain.ErrUserNotFound):
+			reason = "the receiver does not exist"
+		}
+		failed := domain.TransferFailed{
+			FromUserID: fromUserID,
+			ToUserID:   toUserID,
+			Amount:     amount,
+			Reason:     reason,
+			FailedAt:   time.Now(),
+		}
+		if enqueueErr := enqueueEvents(ctx, repository.NewOutboxRepository(s.db), failed); enqueueErr != nil {
+			s.logger.ErrorContext(ctx, "failed to publish transfer.failed event", "from_user_id", fromUserID, "to_user_id", toUserID, "error", enqueueErr)
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// CheckTransfer makes the checks of a transfer that can fail before it is queued, so that the
+// sender is told right away. The queued transfer checks the balances again when it runs.
+func (s *transactionService) CheckTransfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) error {
+	if err := checkTransferParties(fromUserID, toUserID, amount); err != nil {
+		return err
+	}
+	if _, err := s.balanceRepo.GetByUserID(ctx, toUserID); err != nil {
+		return receiverError(toUserID, err)
+	}
+	fromBalance, err := s.balanceRepo.GetByUserID(ctx, fromUserID)
+	if err != nil {
+		return err
+	}
+	if fromBalance.Amount < amount {
+		return domain.ErrInsufficientFunds
+	}
+	return nil
+}
+
+// CheckCredit is the CheckTransfer of credits.
+func (s *transactionService) CheckCredit(ctx context.Context, userID int64, amount float64) error {
+	if amount <= 0 {
+		return domain.ErrInvalidAmount
+	}
+	return nil
+}
+
+// CheckDebit is the CheckTransfer of debits.
+func (s *transactionService) CheckDebit(ctx context.Context, userID int64, amount float64) error {
+	if amount <= 0 {
+		return domain.ErrInvalidAmount
+	}
+	balance, err := s.balanceRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrBalanceNotFound) {
+			return fmt.Errorf("%w: user %d", domain.ErrUserNotFound, userID)
+		}
+		return err
+	}
+	if balance.Amount < amount {
+		return domain.ErrInsufficientFunds
+	}
+	return nil
+}
+
+func checkTransferParties(fromUserID int64, toUserID int64, amount float64) error {
 	if fromUserID == toUserID {
-		return nil, fmt.Errorf("sender and receiver cannot be the same user")
+		return fmt.Errorf("%w: sender and receiver cannot be the same user", domain.ErrInvalidTransfer)
 	}
 	if amount <= 0 {
-		return nil, fmt.Errorf("transfer amount must be a positive number")
+		return fmt.Errorf("%w: transfer amount must be a positive number", domain.ErrInvalidTransfer)
+	}
+	return nil
+}
+
+// receiverError reports a missing receiver balance as an unknown user, every user gets a balance
+// when registering.
+func receiverError(toUserID int64, err error) error {
+	if errors.Is(err, domain.ErrBalanceNotFound) {
+		return fmt.Errorf("%w: receiver %d", domain.ErrUserNotFound, toUserID)
+	}
+	return fmt.Errorf("could not get receiver's balance: %w", err)
+}
+
+func (s *transactionService) transfer(ctx context.Context, fromUserID int64, toUserID int64, amount float64) (*domain.Transaction, error) {
+	if err := checkTransferParties(fromUserID, toUserID, amount); err != nil {
+		return nil, err
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := repository.BeginTx(ctx, s.db, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -47,6 +138,7 @@ func (s *transactionService) Transfer(ctx context.Context, fromUserID int64, toU
 	// Repositories using the transaction
 	balanceRepoTx := repository.NewBalanceRepository(tx, s.rdb)
 	transactionRepoTx := repository.NewTransactionRepository(tx, s.rdb)
+	outboxRepoTx := repository.NewOutboxRepository(tx)
 
 	// Debit Sender
 	fromBalance, err := balanceRepoTx.GetByUserID(ctx, fromUserID)
@@ -54,7 +146,7 @@ func (s *transactionService) Transfer(ctx context.Context, fromUserID int64, toU
 		return nil, fmt.Errorf("could not get sender's balance: %w", err)
 	}
 	if fromBalance.Amount < amount {
-		return nil, errors.New("insufficient funds")
+		return nil, domain.ErrInsufficientFunds
 	}
 	fromBalance.Subtract(amount)
 	fromBalance.LastUpdatedAt = time.Now()
@@ -66,7 +158,7 @@ func (s *transactionService) Transfer(ctx context.Context, fromUserID int64, toU
 	// Credit Receiver
 	toBalance, err := balanceRepoTx.GetByUserID(ctx, toUserID)
 	if err != nil {
-		return nil, fmt.Errorf("could not get receiver's balance: %w", err)
+		return nil, receiverError(toUserID, err)
 	}
 	toBalance.Add(amount)
 	toBalance.LastUpdatedAt = time.Now()
@@ -92,23 +184,39 @@ func (s *transactionService) Transfer(ctx context.Context, fromUserID int64, toU
 		return nil, fmt.Errorf("failed to create transaction record: %w", err)
 	}
 
+	// Written in the same transaction, the audit entry exists exactly when the transaction does.
+	details := fmt.Sprintf("User %d transferred %.2f to user %d", transaction.FromUserID, transaction.Amount, transaction.ToUserID)
+	if err := s.auditService.Enqueue(ctx, outboxRepoTx, "transaction", transaction.ID, "transfer", details, nil, transaction); err != nil {
+		return nil, err
+	}
+	err = enqueueEvents(ctx, outboxRepoTx,
+		domain.TransferCompleted{
+			TransactionID: transaction.ID,
+			FromUserID:    fromUserID,
+			ToUserID:      toUserID,
+			Amount:        amount,
+			CompletedAt:   transaction.CreatedAt,
+		},
+		domain.BalanceChanged{UserID: fromUserID, TransactionID: transaction.ID, Delta: -amount, Balance: fromBalance.Amount},
+		domain.BalanceChanged{UserID: toUserID, TransactionID: transaction.ID, Delta: amount, Balance: toBalance.Amount},
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Log the action
-	details := fmt.Sprintf("User %d transferred %.2f to user %d", transaction.FromUserID, transaction.Amount, transaction.ToUserID)
-	_, _ = s.auditService.Log(ctx, "transaction", transaction.ID, "transfer", details)
-
 	return transaction, nil
 }
 
 func (s *transactionService) Credit(ctx context.Context, userID int64, amount float64) (*domain.Transaction, error) {
 	if amount <= 0 {
-		return nil, fmt.Errorf("credit amount must be a positive number")
+		return nil, domain.ErrInvalidAmount
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := repository.BeginTx(ctx, s.db, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -116,11 +224,12 @@ func (s *transactionService) Credit(ctx context.Context, userID int64, amount fl
 
 	balanceRepoTx := repository.NewBalanceRepository(tx, s.rdb)
 	transactionRepoTx := repository.NewTransactionRepository(tx, s.rdb)
+	outboxRepoTx := repository.NewOutboxRepository(tx)
 
 	balance, err := balanceRepoTx.GetByUserID(ctx, userID)
 	if err != nil {
 		// User has no balance yet, create one
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, domain.ErrBalanceNotFound) {
 			balance = &domain.Balance{
 				UserID:        userID,
 				Amount:        amount,
@@ -157,20 +266,25 @@ func (s *transactionService) Credit(ctx context.Context, userID int64, amount fl
 		return nil, fmt.Errorf("failed to create transaction record: %w", err)
 	}
 
+	details := fmt.Sprintf("User %d credited with %.2f from the bank", transaction.ToUserID, transaction.Amount)
+	if err := s.auditService.Enqueue(ctx, outboxRepoTx, "transaction", transaction.ID, "credit", details, nil, transaction); err != nil {
+		return nil, err
+	}
+	if err := enqueueEvents(ctx, outboxRepoTx, domain.BalanceChanged{UserID: userID, TransactionID: transaction.ID, Delta: amount, Balance: balance.Amount}); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	details := fmt.Sprintf("User %d credited with %.2f from the bank", transaction.ToUserID, transaction.Amount)
-	_, _ = s.auditService.Log(ctx, "transaction", transaction.ID, "credit", details)
-
 	return transaction, nil
 }
 func (s *transactionService) Debit(ctx context.Context, userID int64, amount float64) (*domain.Transaction, error) {
 	if amount <= 0 {
-		return nil, fmt.Errorf("debit amount must be a positive number")
+		return nil, domain.ErrInvalidAmount
 	}
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := repository.BeginTx(ctx, s.db, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -178,13 +292,14 @@ func (s *transactionService) Debit(ctx context.Context, userID int64, amount flo
 
 	balanceRepoTx := repository.NewBalanceRepository(tx, s.rdb)
 	transactionRepoTx := repository.NewTransactionRepository(tx, s.rdb)
+	outboxRepoTx := repository.NewOutboxRepository(tx)
 
 	balance, err := balanceRepoTx.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get balance: %w", err)
 	}
 	if balance.Amount < amount {
-		return nil, fmt.Errorf("insufficient funds")
+		return nil, domain.ErrInsufficientFunds
 	}
 	balance.Subtract(amount)
 	balance.LastUpdatedAt = time.Now()
@@ -207,18 +322,50 @@ func (s *transactionService) Debit(ctx context.Context, userID int64, amount flo
 		return nil, fmt.Errorf("failed to create transaction record: %w", err)
 	}
 
+	details := fmt.Sprintf("User %d debited with %.2f to the bank", transaction.FromUserID, transaction.Amount)
+	if err := s.auditService.Enqueue(ctx, outboxRepoTx, "transaction", transaction.ID, "debit", details, nil, transaction); err != nil {
+		return nil, err
+	}
+	if err := enqueueEvents(ctx, outboxRepoTx, domain.BalanceChanged{UserID: userID, TransactionID: transaction.ID, Delta: -amount, Balance: balance.Amount}); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	details := fmt.Sprintf("User %d debited with %.2f to the bank", transaction.FromUserID, transaction.Amount)
-	_, _ = s.auditService.Log(ctx, "transaction", transaction.ID, "debit", details)
-
 	return transaction, nil
 }
 
-func (s *transactionService) GetTransactionHistory(ctx context.Context, userID int64) ([]domain.Transaction, error) {
-	return s.transactionRepo.GetByUserID(ctx, userID)
+func (s *transactionService) GetTransactionHistory(ctx context.Context, filter domain.TransactionFilter) (*domain.TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = domain.DefaultPageSize
+	}
+	if filter.Limit > domain.MaxPageSize {
+		filter.Limit = domain.MaxPageSize
+	}
+	if filter.Direction != domain.DirectionAny && filter.Direction != domain.DirectionIncoming && filter.Direction != domain.DirectionOutgoing {
+		return nil, fmt.Errorf("%w: direction must be incoming or outgoing", domain.ErrInvalidFilter)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", domain.ErrInvalidFilter)
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return nil, fmt.Errorf("%w: min_amount cannot be greater than max_amount", domain.ErrInvalidFilter)
+	}
+
+	transactions, err := s.transactionRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.TransactionPage{Transactions: transactions}
+	if len(transactions) > filter.Limit {
+		page.Transactions = transactions[:filter.Limit]
+		last := page.Transactions[filter.Limit-1]
+		page.NextCursor = domain.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return page, nil
 }
 
 func (s *transactionService) GetByTransactionID(ctx context.Context, transactionID int64) (*domain.Transaction, error) {
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// capture matches any argument and remembers it.
+type capture struct {
+	values []driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.values = append(c.values, v)
+	return true
+}
+
+// discardLogger is given to the services whose logs a test does not check.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func expectBalance(mock sqlmock.Sqlmock, userID int64, amount float64) {
+	mock.ExpectQuery("SELECT user_id, amount, last_updated_at FROM balances").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "amount", "last_updated_at"}).AddRow(userID, amount, time.Now()))
+}
+
+func TestTransactionServiceEventsCarryTransactionID(t *testing.T) {
+	const transactionID = 42
+
+	tests := []struct {
+		name string
+		// expect sets up the queries made before the transaction is inserted.
+		expect func(mock sqlmock.Sqlmock)
+		run    func(s TransactionService) (*domain.Transaction, error)
+		// events is the number of events written to the outbox besides the audit entry.
+		events int
+	}{
+		{
+			name: "transfer",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectBalance(mock, 1, 100)
+				mock.ExpectExec("UPDATE balances").WillReturnResult(sqlmock.NewResult(0, 1))
+				expectBalance(mock, 2, 0)
+				mock.ExpectExec("UPDATE balances").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(s TransactionService) (*domain.Transaction, error) {
+				return s.Transfer(context.Background(), 1, 2, 25)
+			},
+			events: 3,
+		},
+		{
+			name: "credit",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectBalance(mock, 2, 0)
+				mock.ExpectExec("UPDATE balances").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(s TransactionService) (*domain.Transaction, error) {
+				return s.Credit(context.Background(), 2, 25)
+			},
+			events: 1,
+		},
+		{
+			name: "debit",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectBalance(mock, 1, 100)
+				mock.ExpectExec("UPDATE balances").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(s TransactionService) (*domain.Transaction, error) {
+				return s.Debit(context.Background(), 1, 25)
+			},
+			events: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+
+			createdAt := &capture{}
+			payloads := &capture{}
+			mock.ExpectBegin()
+			tt.expect(mock)
+			mock.ExpectExec("INSERT INTO transactions").
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), createdAt).
+				WillReturnResult(sqlmock.NewResult(transactionID, 1))
+			for i := 0; i < tt.events+1; i++ {
+				mock.ExpectExec("INSERT INTO outbox").
+					WithArgs(sqlmock.AnyArg(), payloads, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+			}
+			mock.ExpectCommit()
+
+			s := NewTransactionService(db, rdb, nil, nil, NewAuditLogService(db, nil, nil, discardLogger), discardLogger)
+			transaction, err := tt.run(s)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			if transaction.ID != transactionID {
+				t.Errorf("transaction ID = %d, want %d", transaction.ID, transactionID)
+			}
+			if got := createdAt.values[0]; got != transaction.CreatedAt {
+				t.Errorf("stored created_at = %v, want the transaction's %v", got, transaction.CreatedAt)
+			}
+
+			var audit domain.AuditLog
+			if err := json.Unmarshal([]byte(payloads.values[0].(string)), &audit); err != nil {
+				t.Fatal(err)
+			}
+			if audit.EntityType != "transaction" || audit.EntityID != transactionID {
+				t.Errorf("audit entry is for %s %d, want transaction %d", audit.EntityType, audit.EntityID, transactionID)
+			}
+
+			for _, payload := range payloads.values[1:] {
+				var event domain.Event
+				if err := json.Unmarshal([]byte(payload.(string)), &event); err != nil {
+					t.Fatal(err)
+				}
+				var data struct {
+					TransactionID int64 `json:"transaction_id"`
+				}
+				if err := json.Unmarshal(event.Data, &data); err != nil {
+					t.Fatal(err)
+				}
+				if data.TransactionID != transactionID {
+					t.Errorf("%s event has transaction_id %d, want %d", event.Type, data.TransactionID, transactionID)
+				}
+			}
+		})
+	}
+}
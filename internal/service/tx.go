@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+// withTx runs fn in a transaction and commits it when fn succeeds. A change and the outbox
+// messages describing it are written through the same tx, so either both are stored or neither.
+// Cache entries the change invalidates are deleted once it has committed.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *repository.Tx) error) error {
+	tx, err := repository.BeginTx(ctx, db, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/redis/go-redis/v9"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+func TestAuditedWritesCommitWithTheirAuditEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		// read sets up the queries made before the transaction begins, if any.
+		read func(mock sqlmock.Sqlmock)
+		// write sets up the statements of the change itself, made inside the transaction.
+		write func(mock sqlmock.Sqlmock)
+		run   func(db *sql.DB, rdb *redis.Client, audit AuditLogService) error
+	}{
+		{
+			name: "revoke session",
+			write: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE sessions SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(db *sql.DB, rdb *redis.Client, audit AuditLogService) error {
+				s := NewSessionService(db, rdb, repository.NewSessionRepository(db, rdb), nil, nil, nil, audit, discardLogger)
+				return s.Revoke(context.Background(), 1, "session-1")
+			},
+		},
+		{
+			name: "revoke api key",
+			write: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE api_keys SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(db *sql.DB, rdb *redis.Client, audit AuditLogService) error {
+				s := NewServiceAccountService(db, rdb, repository.NewServiceAccountRepository(db, rdb), nil, audit)
+				return s.RevokeAPIKey(context.Background(), 1, 2)
+			},
+		},
+		{
+			name: "delete webhook",
+			write: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE FROM webhook_subscriptions").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(db *sql.DB, rdb *redis.Client, audit AuditLogService) error {
+				s := NewWebhookService(db, repository.NewWebhookRepository(db), audit, nil, discardLogger)
+				return s.DeleteSubscription(context.Background(), 1, 2)
+			},
+		},
+		{
+			name: "update notification preferences",
+			read: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT type, email FROM notification_preferences").
+					WillReturnRows(sqlmock.NewRows([]string{"type", "email"}))
+			},
+			write: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO notification_preferences").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run: func(db *sql.DB, rdb *redis.Client, audit AuditLogService) error {
+				s := NewNotificationService(db, repository.NewNotificationRepository(db), nil, audit, nil, 0, discardLogger)
+				_, err := s.UpdatePreferences(context.Background(), 1, map[domain.NotificationType]bool{domain.NotificationLowBalance: true})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, outboxFails := range []bool{false, true} {
+			name := tt.name
+			if outboxFails {
+				name += " without outbox"
+			}
+			t.Run(name, func(t *testing.T) {
+				db, mock, err := sqlmock.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+				rdb := newTestRedis(t)
+
+				if tt.read != nil {
+					tt.read(mock)
+				}
+				mock.ExpectBegin()
+				tt.write(mock)
+				outbox := mock.ExpectExec("INSERT INTO outbox")
+				if outboxFails {
+					outbox.WillReturnError(errors.New("outbox unavailable"))
+					mock.ExpectRollback()
+				} else {
+					outbox.WillReturnResult(sqlmock.NewResult(1, 1))
+					mock.ExpectCommit()
+				}
+
+				err = tt.run(db, rdb, NewAuditLogService(db, nil, nil, discardLogger))
+				if outboxFails && err == nil {
+					t.Error("expected the write to fail without its audit entry")
+				}
+				if !outboxFails && err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestWithTxInvalidatesCacheAfterCommit(t *testing.T) {
+	errAudit := errors.New("outbox is full")
+
+	tests := []struct {
+		name string
+		// key is the cache entry the write invalidates.
+		key   string
+		write func(ctx context.Context, tx *repository.Tx, rdb *redis.Client) error
+		// fnErr fails the transaction after the write.
+		fnErr     error
+		commitErr error
+		wantKept  bool
+	}{
+		{
+			name: "revoked session",
+			key:  "session:laptop",
+			write: func(ctx context.Context, tx *repository.Tx, rdb *redis.Client) error {
+				return repository.NewSessionRepository(tx, rdb).Revoke(ctx, 1, "laptop", time.Now())
+			},
+		},
+		{
+			name: "changed password",
+			key:  "user:1",
+			write: func(ctx context.Context, tx *repository.Tx, rdb *redis.Client) error {
+				return repository.NewUserRepository(tx, rdb).UpdatePassword(ctx, 1, "hash", time.Now())
+			},
+		},
+		{
+			name: "rolled back",
+			key:  "session:laptop",
+			write: func(ctx context.Context, tx *repository.Tx, rdb *redis.Client) error {
+				return repository.NewSessionRepository(tx, rdb).Revoke(ctx, 1, "laptop", time.Now())
+			},
+			fnErr:    errAudit,
+			wantKept: true,
+		},
+		{
+			name: "commit fails",
+			key:  "user:1",
+			write: func(ctx context.Context, tx *repository.Tx, rdb *redis.Client) error {
+				return repository.NewUserRepository(tx, rdb).UpdatePassword(ctx, 1, "hash", time.Now())
+			},
+			commitErr: errors.New("deadlock"),
+			wantKept:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+			ctx := context.Background()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE").WillReturnResult(sqlmock.NewResult(0, 1))
+			switch {
+			case tt.fnErr != nil:
+				mock.ExpectRollback()
+			case tt.commitErr != nil:
+				mock.ExpectCommit().WillReturnError(tt.commitErr)
+			default:
+				mock.ExpectCommit()
+			}
+
+			err = withTx(ctx, db, func(tx *repository.Tx) error {
+				if err := tt.write(ctx, tx, rdb); err != nil {
+					return err
+				}
+				// A concurrent reader still sees the committed row and caches it again.
+				rdb.Set(ctx, tt.key, "stale", time.Hour)
+				return tt.fnErr
+			})
+			if (err != nil) != (tt.fnErr != nil || tt.commitErr != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			n, _ := rdb.Exists(ctx, tt.key).Result()
+			if kept := n == 1; kept != tt.wantKept {
+				t.Errorf("%s cached = %v, want %v", tt.key, kept, tt.wantKept)
+			}
+		})
+	}
+}
@@ -2,24 +2,56 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/yusuf4ktas/backend-project/internal/domain"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/yusuf4ktas/backend-project/internal/mailer"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/security"
 )
 
+// How long an email change stays pending before the token expires.
+const emailVerificationTTL = 24 * time.Hour
+
+// How long a password reset token can be used.
+const passwordResetTTL = time.Hour
+
 type userService struct {
-	userRepo     domain.UserRepository
-	auditService AuditLogService
-	balanceRepo  domain.BalanceRepository
+	db               *sql.DB
+	rdb              *redis.Client
+	userRepo         domain.UserRepository
+	auditService     AuditLogService
+	verificationRepo domain.EmailVerificationRepository
+	resetRepo        domain.PasswordResetRepository
+	sessionRepo      domain.SessionRepository
+	mailer           mailer.Sender
+	passwordPolicy   *security.PasswordPolicy
+	hasher           security.PasswordHasher
+	logger           *slog.Logger
 }
 
-func NewUserService(repo domain.UserRepository, auditService AuditLogService, balanceRepo domain.BalanceRepository) UserService {
+func NewUserService(db *sql.DB, rdb *redis.Client, repo domain.UserRepository, auditService AuditLogService, verificationRepo domain.EmailVerificationRepository, resetRepo domain.PasswordResetRepository, sessionRepo domain.SessionRepository, sender mailer.Sender, passwordPolicy *security.PasswordPolicy, hasher security.PasswordHasher, logger *slog.Logger) UserService {
 	return &userService{
-		userRepo:     repo,
-		auditService: auditService,
-		balanceRepo:  balanceRepo,
+		db:               db,
+		rdb:              rdb,
+		userRepo:         repo,
+		auditService:     auditService,
+		verificationRepo: verificationRepo,
+		resetRepo:        resetRepo,
+		sessionRepo:      sessionRepo,
+		mailer:           sender,
+		passwordPolicy:   passwordPolicy,
+		hasher:           hasher,
+		logger:           logger,
 	}
 }
 
@@ -27,21 +59,34 @@ func (s *userService) Register(ctx context.Context, username, email, password st
 	user := &domain.User{
 		Username:  username,
 		Email:     email,
-		Role:      "user",
+		Role:      domain.RoleUser,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	err := user.Validate(password)
+	err := user.ValidateProfile()
 	if err != nil {
 		return nil, err
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := s.passwordPolicy.Check(password, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 
-	err = s.userRepo.Create(ctx, user)
+	// The user, their balance, the audit entry and the event are created together or not at all.
+	tx, err := repository.BeginTx(ctx, s.db, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userRepoTx := repository.NewUserRepository(tx, s.rdb)
+	balanceRepoTx := repository.NewBalanceRepository(tx, s.rdb)
+
+	err = userRepoTx.Create(ctx, user)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +97,27 @@ func (s *userService) Register(ctx context.Context, username, email, password st
 		LastUpdatedAt: time.Now(),
 	}
 
-	err = s.balanceRepo.Create(ctx, initialBalance)
+	err = balanceRepoTx.Create(ctx, initialBalance)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create initial balance for user: %w", err)
 	}
 
+	outboxRepoTx := repository.NewOutboxRepository(tx)
 	details := fmt.Sprintf("User %s registered with email %s", user.Username, user.Email)
-	_, _ = s.auditService.Log(ctx, "user", user.ID, "register", details)
+	if err := s.auditService.Enqueue(ctx, outboxRepoTx, "user", user.ID, "register", details, nil, nil); err != nil {
+		return nil, err
+	}
+	err = enqueueEvents(ctx, outboxRepoTx, domain.UserRegistered{
+		UserID:       user.ID,
+		RegisteredAt: user.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 
 	return user, nil
 }
@@ -68,13 +127,30 @@ func (s *userService) Login(ctx context.Context, email, password string) (*domai
 	if err != nil {
 		return nil, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	match, err := s.hasher.Verify(password, user.PasswordHash)
 	if err != nil {
 		return nil, err
 	}
+	if !match {
+		return nil, domain.ErrIncorrectPassword
+	}
 
-	details := fmt.Sprintf("User %s registered with email %s", user.Username, user.Email)
-	_, _ = s.auditService.Log(ctx, "user", user.ID, "login", details)
+	// Hashes made with an older algorithm or cost are transparently upgraded, which is only
+	// possible here while the plain password is known. A failed upgrade does not block the login.
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		upgraded, err := s.hasher.Hash(password)
+		if err == nil {
+			err = s.userRepo.UpdatePassword(ctx, user.ID, upgraded, time.Now())
+		}
+		if err != nil {
+			s.logger.WarnContext(ctx, "failed to upgrade the password hash", "user_id", user.ID, "error", err)
+		}
+	}
+
+	details := fmt.Sprintf("User %d logged in", user.ID)
+	if err := s.auditService.Enqueue(ctx, repository.NewOutboxRepository(s.db), "user", user.ID, "login", details, nil, nil); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -87,12 +163,31 @@ func (s *userService) GetByID(ctx context.Context, userID int64) (*domain.User,
 	return user, nil
 }
 
-func (s *userService) GetAllUsers(ctx context.Context) ([]domain.User, error) {
-	users, err := s.userRepo.GetAllUsers(ctx)
+func (s *userService) ListUsers(ctx context.Context, filter domain.UserFilter) (*domain.UserPage, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = domain.DefaultPageSize
+	}
+	if filter.PageSize > domain.MaxPageSize {
+		filter.PageSize = domain.MaxPageSize
+	}
+	if filter.Sort == "" {
+		filter.Sort = "id"
+	}
+	if !slices.Contains(domain.UserSortFields, filter.Sort) {
+		return nil, fmt.Errorf("%w: sort must be one of %s", domain.ErrInvalidFilter, strings.Join(domain.UserSortFields, ", "))
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, fmt.Errorf("%w: created_from must be before created_to", domain.ErrInvalidFilter)
+	}
+
+	users, total, err := s.userRepo.List(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	return users, nil
+	return &domain.UserPage{Users: users, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
 }
 
 func (s *userService) Delete(ctx context.Context, userID int64) error {
@@ -102,3 +197,239 @@ func (s *userService) Delete(ctx context.Context, userID int64) error {
 	}
 	return s.userRepo.Delete(ctx, user.ID)
 }
+
+func (s *userService) UpdateProfile(ctx context.Context, userID int64, username string) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+
+	user.Username = username
+	user.UpdatedAt = time.Now()
+	if err := user.ValidateProfile(); err != nil {
+		return nil, err
+	}
+
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		// Update also invalidates the user:%d cache entry.
+		if err := repository.NewUserRepository(tx, s.rdb).Update(ctx, user); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d changed username from %s to %s", user.ID, before.Username, user.Username)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", user.ID, "update_profile", details, before, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RequestEmailChange sends a verification token to the new address.
+// The email is only changed once the token is confirmed.
+func (s *userService) RequestEmailChange(ctx context.Context, userID int64, email string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	candidate := *user
+	candidate.Email = email
+	if err := candidate.ValidateProfile(); err != nil {
+		return err
+	}
+
+	if _, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		return domain.ErrDuplicateEmail
+	} else if !errors.Is(err, domain.ErrUserNotFound) {
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	verification := &domain.EmailVerification{
+		Token:     token,
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	if err := s.verificationRepo.Create(ctx, verification); err != nil {
+		return fmt.Errorf("failed to store email verification: %w", err)
+	}
+
+	// The verification lives in Redis, so the audit entry is the only database write.
+	details := fmt.Sprintf("User %d requested an email change to %s", user.ID, email)
+	if err := s.auditService.Enqueue(ctx, repository.NewOutboxRepository(s.db), "user", user.ID, "request_email_change", details, nil, nil); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Use the following token to confirm your new email address: %s", token)
+	if err := s.mailer.Send(ctx, email, "Confirm your email address", body); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	return nil
+}
+
+func (s *userService) ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error) {
+	verification, err := s.verificationRepo.Get(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, verification.UserID)
+	if err != nil {
+		return nil, err
+	}
+	before := *user
+
+	user.Email = verification.Email
+	user.UpdatedAt = time.Now()
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewUserRepository(tx, s.rdb).Update(ctx, user); err != nil {
+			return err
+		}
+		// The token is only consumed once the update passed the unique email check, so an address
+		// taken in the meantime does not force the user to start over. Consuming it before the
+		// commit rolls back a second confirmation that raced this one.
+		if _, err := s.verificationRepo.Consume(ctx, token); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("User %d changed email from %s to %s", user.ID, before.Email, user.Email)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", user.ID, "change_email", details, before, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword verifies the current password, stores the new hash and
+// revokes every other session of the user.
+func (s *userService) ChangePassword(ctx context.Context, userID int64, sessionID string, currentPassword, newPassword string) error {
+	cached, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// The cached user does not carry the password hash, so read it from the database.
+	user, err := s.userRepo.GetByEmail(ctx, cached.Email)
+	if err != nil {
+		return err
+	}
+
+	match, err := s.hasher.Verify(currentPassword, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return domain.ErrIncorrectPassword
+	}
+	if err := s.passwordPolicy.Check(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewUserRepository(tx, s.rdb).UpdatePassword(ctx, user.ID, hashedPassword, now); err != nil {
+			return err
+		}
+		if err := repository.NewSessionRepository(tx, s.rdb).RevokeAllExcept(ctx, user.ID, sessionID, now); err != nil {
+			return fmt.Errorf("failed to revoke other sessions: %w", err)
+		}
+		details := fmt.Sprintf("User %d changed their password", user.ID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", user.ID, "change_password", details, nil, nil)
+	})
+}
+
+// RequestPasswordReset emails a reset token to the user. Unknown addresses are silently
+// ignored so that the endpoint cannot be used to find out which emails are registered.
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	reset := &domain.PasswordReset{
+		Token:     token,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := s.resetRepo.Create(ctx, reset); err != nil {
+		return fmt.Errorf("failed to store password reset: %w", err)
+	}
+
+	// The reset lives in Redis, so the audit entry is the only database write.
+	details := fmt.Sprintf("User %d requested a password reset", user.ID)
+	if err := s.auditService.Enqueue(ctx, repository.NewOutboxRepository(s.db), "user", user.ID, "request_password_reset", details, nil, nil); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Use the following token to reset your password: %s", token)
+	if err := s.mailer.Send(ctx, user.Email, "Reset your password", body); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and revokes every session of the user.
+func (s *userService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// The token is only consumed once the new password passes the policy,
+	// so a rejected password does not force the user to request a new token.
+	reset, err := s.resetRepo.Get(ctx, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.passwordPolicy.Check(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	if _, err := s.resetRepo.Consume(ctx, token); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewUserRepository(tx, s.rdb).UpdatePassword(ctx, user.ID, hashedPassword, now); err != nil {
+			return err
+		}
+		// An empty ID keeps no session, the user has to log in again everywhere.
+		if err := repository.NewSessionRepository(tx, s.rdb).RevokeAllExcept(ctx, user.ID, "", now); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		details := fmt.Sprintf("User %d reset their password", user.ID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "user", user.ID, "reset_password", details, nil, nil)
+	})
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+	"github.com/yusuf4ktas/backend-project/internal/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery staple"
+
+func bcryptHash(t *testing.T, cost int) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), cost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func expectUserByEmail(mock sqlmock.Sqlmock, userID int64, passwordHash string) {
+	mock.ExpectQuery("SELECT id, username, email, password_hash, role, created_at, updated_at FROM users WHERE email").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "role", "created_at", "updated_at"}).
+			AddRow(userID, "alice", "alice@example.com", passwordHash, "user", time.Now(), time.Now()))
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	argon2id := security.NewArgon2idHasher(1024, 1, 1)
+
+	tests := []struct {
+		name   string
+		hasher security.PasswordHasher
+		stored string
+		// updateErr fails storing the upgraded hash.
+		updateErr error
+		// upgraded checks the hash written on login, nil when the stored one has to be kept.
+		upgraded func(hash string) bool
+	}{
+		{
+			name:   "bcrypt hash below the cost",
+			hasher: security.NewPasswordHasher(security.NewBcryptHasher(bcrypt.MinCost + 1)),
+			stored: bcryptHash(t, bcrypt.MinCost),
+			upgraded: func(hash string) bool {
+				cost, err := bcrypt.Cost([]byte(hash))
+				return err == nil && cost == bcrypt.MinCost+1
+			},
+		},
+		{
+			name:     "bcrypt hash once argon2id is selected",
+			hasher:   security.NewPasswordHasher(argon2id, security.NewBcryptHasher(bcrypt.MinCost)),
+			stored:   bcryptHash(t, bcrypt.MinCost),
+			upgraded: func(hash string) bool { return argon2id.Supports(hash) && !argon2id.NeedsRehash(hash) },
+		},
+		{
+			name:   "current hash is kept",
+			hasher: security.NewPasswordHasher(security.NewBcryptHasher(bcrypt.MinCost)),
+			stored: bcryptHash(t, bcrypt.MinCost),
+		},
+		{
+			name:      "failed upgrade does not block the login",
+			hasher:    security.NewPasswordHasher(security.NewBcryptHasher(bcrypt.MinCost + 1)),
+			stored:    bcryptHash(t, bcrypt.MinCost),
+			updateErr: errors.New("connection refused"),
+			upgraded:  func(string) bool { return true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+
+			expectUserByEmail(mock, 1, tt.stored)
+			newHash := &capture{}
+			if tt.upgraded != nil {
+				update := mock.ExpectExec("UPDATE users SET password_hash").WithArgs(newHash, sqlmock.AnyArg(), 1)
+				if tt.updateErr != nil {
+					update.WillReturnError(tt.updateErr)
+				} else {
+					update.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+			mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+
+			s := NewUserService(db, rdb, repository.NewUserRepository(db, rdb), NewAuditLogService(db, nil, nil, discardLogger), nil, nil, nil, nil, nil, tt.hasher, slog.New(slog.NewTextHandler(&logs, nil)))
+			if _, err := s.Login(context.Background(), "alice@example.com", testPassword); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.upgraded != nil && !tt.upgraded(newHash.values[0].(string)) {
+				t.Errorf("stored hash %s is not an upgrade", newHash.values[0])
+			}
+			if logged := strings.Contains(logs.String(), `msg="failed to upgrade the password hash" user_id=1 error="connection refused"`); logged != (tt.updateErr != nil) {
+				t.Errorf("logged %q", logs.String())
+			}
+		})
+	}
+}
+
+func expectUserByID(mock sqlmock.Sqlmock, userID int64, passwordHash string) {
+	mock.ExpectQuery("SELECT id, username, email, password_hash, role, created_at, updated_at FROM users WHERE id").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "role", "created_at", "updated_at"}).
+			AddRow(userID, "alice", "alice@example.com", passwordHash, "user", time.Now(), time.Now()))
+}
+
+func TestChangePassword(t *testing.T) {
+	const sessionID = "current-session"
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		// otherSessions are the sessions of the user besides the current one.
+		otherSessions []string
+		wantErr       error
+		wantPolicyErr bool
+	}{
+		{
+			name:            "other sessions are revoked",
+			currentPassword: testPassword,
+			newPassword:     "a much longer passphrase",
+			otherSessions:   []string{"laptop", "phone"},
+		},
+		{
+			name:            "no other sessions",
+			currentPassword: testPassword,
+			newPassword:     "a much longer passphrase",
+		},
+		{
+			name:            "wrong current password",
+			currentPassword: "not the password",
+			newPassword:     "a much longer passphrase",
+			wantErr:         domain.ErrIncorrectPassword,
+		},
+		{
+			name:            "too short",
+			currentPassword: testPassword,
+			newPassword:     "short",
+			wantPolicyErr:   true,
+		},
+		{
+			name:            "contains the username",
+			currentPassword: testPassword,
+			newPassword:     "alice in wonderland",
+			wantPolicyErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+			ctx := context.Background()
+			for _, id := range append(tt.otherSessions, sessionID) {
+				rdb.Set(ctx, "session:"+id, "{}", time.Hour)
+			}
+
+			stored := bcryptHash(t, bcrypt.MinCost)
+			expectUserByID(mock, 1, stored)
+			expectUserByEmail(mock, 1, stored)
+			newHash := &capture{}
+			succeeds := tt.wantErr == nil && !tt.wantPolicyErr
+			if succeeds {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE users SET password_hash").WithArgs(newHash, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				rows := sqlmock.NewRows([]string{"id"})
+				for _, id := range tt.otherSessions {
+					rows.AddRow(id)
+				}
+				mock.ExpectQuery("SELECT id FROM sessions WHERE user_id = \\? AND id <> \\?").WithArgs(1, sessionID).WillReturnRows(rows)
+				mock.ExpectExec("UPDATE sessions SET revoked_at").WithArgs(sqlmock.AnyArg(), 1, sessionID).
+					WillReturnResult(sqlmock.NewResult(0, int64(len(tt.otherSessions))))
+				mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			hasher := security.NewPasswordHasher(security.NewBcryptHasher(bcrypt.MinCost))
+			s := NewUserService(db, rdb, repository.NewUserRepository(db, rdb), NewAuditLogService(db, nil, nil, discardLogger), nil, nil,
+				repository.NewSessionRepository(db, rdb), nil, &security.PasswordPolicy{MinLength: 12, MaxLength: 72}, hasher, discardLogger)
+			err = s.ChangePassword(ctx, 1, sessionID, tt.currentPassword, tt.newPassword)
+
+			var policyErr *security.PolicyError
+			switch {
+			case tt.wantPolicyErr:
+				if !errors.As(err, &policyErr) {
+					t.Fatalf("err = %v, want a policy error", err)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			if !succeeds {
+				return
+			}
+
+			if match, err := hasher.Verify(tt.newPassword, newHash.values[0].(string)); err != nil || !match {
+				t.Errorf("stored hash does not match the new password: %v", err)
+			}
+			for _, id := range tt.otherSessions {
+				if n, _ := rdb.Exists(ctx, "session:"+id).Result(); n != 0 {
+					t.Errorf("session %s is still cached", id)
+				}
+			}
+			if n, _ := rdb.Exists(ctx, "session:"+sessionID).Result(); n != 1 {
+				t.Error("current session was revoked")
+			}
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	errReset := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		username string
+		// found reports whether the user exists.
+		found     bool
+		updateErr error
+		wantErr   error
+	}{
+		{name: "username is changed", username: "alice2", found: true},
+		{name: "empty username", username: "", found: true, wantErr: domain.ErrInvalidProfile},
+		{name: "user not found", username: "alice2", wantErr: domain.ErrUserNotFound},
+		{name: "update fails", username: "alice2", found: true, updateErr: errReset, wantErr: errReset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+
+			if tt.found {
+				expectUserByID(mock, 1, "")
+			} else {
+				mock.ExpectQuery("FROM users WHERE id").WithArgs(1).WillReturnError(sql.ErrNoRows)
+			}
+			if tt.found && tt.username != "" {
+				mock.ExpectBegin()
+				update := mock.ExpectExec("UPDATE users SET username = \\?").
+					WithArgs(tt.username, "alice@example.com", "user", sqlmock.AnyArg(), 1)
+				if tt.updateErr != nil {
+					update.WillReturnError(tt.updateErr)
+					mock.ExpectRollback()
+				} else {
+					update.WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+					mock.ExpectCommit()
+				}
+			}
+
+			s := NewUserService(db, rdb, repository.NewUserRepository(db, rdb), NewAuditLogService(db, nil, nil, discardLogger), nil, nil, nil, nil, nil, nil, discardLogger)
+			user, err := s.UpdateProfile(context.Background(), 1, tt.username)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr == nil && user.Username != tt.username {
+				t.Errorf("username = %q, want %q", user.Username, tt.username)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	const token = "verification-token"
+
+	tests := []struct {
+		name string
+		// stored reports whether the token is pending.
+		stored    bool
+		updateErr error
+		wantErr   error
+		// wantKept reports whether the token can still be used afterwards.
+		wantKept bool
+	}{
+		{name: "confirmed", stored: true},
+		{name: "email taken in the meantime", stored: true, updateErr: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, wantErr: domain.ErrDuplicateEmail, wantKept: true},
+		{name: "update fails", stored: true, updateErr: errors.New("connection reset"), wantKept: true},
+		{name: "unknown token", wantErr: domain.ErrInvalidVerificationToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rdb := newTestRedis(t)
+			ctx := context.Background()
+			verifications := repository.NewEmailVerificationRepository(rdb)
+			if tt.stored {
+				err := verifications.Create(ctx, &domain.EmailVerification{Token: token, UserID: 1, Email: "alice2@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectUserByID(mock, 1, "")
+				mock.ExpectBegin()
+				update := mock.ExpectExec("UPDATE users SET username = \\?").
+					WithArgs("alice", "alice2@example.com", "user", sqlmock.AnyArg(), 1)
+				if tt.updateErr != nil {
+					update.WillReturnError(tt.updateErr)
+					mock.ExpectRollback()
+				} else {
+					update.WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+					mock.ExpectCommit()
+				}
+			}
+
+			s := NewUserService(db, rdb, repository.NewUserRepository(db, rdb), NewAuditLogService(db, nil, nil, discardLogger), verifications, nil, nil, nil, nil, nil, discardLogger)
+			user, err := s.ConfirmEmailChange(ctx, token)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.updateErr != nil:
+				if err == nil {
+					t.Fatal("expected the update error")
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			default:
+				if user.Email != "alice2@example.com" {
+					t.Errorf("email = %q, want alice2@example.com", user.Email)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = verifications.Get(ctx, token)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("token kept = %v, want %v (%v)", kept, tt.wantKept, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+const (
+	webhookBatchSize = 20
+	// A delivery is given up on after this many failed attempts, about fifteen hours with the backoff below.
+	maxWebhookAttempts = 12
+	maxWebhookBackoff  = 6 * time.Hour
+	// Longer than any attempt can take, so a leased delivery is only retried by another
+	// dispatcher when the one sending it stopped.
+	webhookLease = 2 * time.Minute
+	// The circuit of an endpoint opens after this many failed deliveries in a row.
+	webhookCircuitThreshold = 5
+	webhookCircuitOpenFor   = 5 * time.Minute
+	minWebhookSecretLength  = 16
+)
+
+var (
+	webhookAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_delivery_attempts_total",
+		Help: "Total number of webhook delivery attempts.",
+	}, []string{"result"})
+
+	webhookAttemptDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "webhook_delivery_duration_seconds",
+		Help:    "Duration of webhook delivery attempts in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+type webhookService struct {
+	db           *sql.DB
+	webhookRepo  domain.WebhookRepository
+	auditService AuditLogService
+	client       *http.Client
+	logger       *slog.Logger
+}
+
+// NewWebhookService creates the webhook service, deliveries are sent with client.
+func NewWebhookService(db *sql.DB, repo domain.WebhookRepository, auditService AuditLogService, client *http.Client, logger *slog.Logger) WebhookService {
+	return &webhookService{
+		db:           db,
+		webhookRepo:  repo,
+		auditService: auditService,
+		client:       client,
+		logger:       logger,
+	}
+}
+
+// NewWebhookClient returns the HTTP client for deliveries. Unless allowPrivate is set it refuses
+// to connect to loopback, private and link-local addresses, so that a subscription cannot be
+// used to reach services inside the network. The check is made on the resolved address.
+func NewWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect would send the signed payload somewhere the user did not subscribe.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func validateWebhook(rawURL string, eventTypes []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", domain.ErrInvalidWebhook)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", domain.ErrInvalidWebhook)
+	}
+	if len(eventTypes) == 0 {
+		return fmt.Errorf("%w: event_types must not be empty", domain.ErrInvalidWebhook)
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(domain.EventTypes, t) {
+			return fmt.Errorf("%w: unknown event type %q", domain.ErrInvalidWebhook, t)
+		}
+	}
+	return nil
+}
+
+// CreateSubscription generates a secret when none is given. It is returned only here.
+func (s *webhookService) CreateSubscription(ctx context.Context, userID int64, rawURL string, eventTypes []string, secret string) (*domain.WebhookSubscription, string, error) {
+	if err := validateWebhook(rawURL, eventTypes); err != nil {
+		return nil, "", err
+	}
+	if secret == "" {
+		generated, err := generateToken()
+		if err != nil {
+			return nil, "", err
+		}
+		secret = generated
+	}
+	if len(secret) < minWebhookSecretLength {
+		return nil, "", fmt.Errorf("%w: secret must be at least %d characters", domain.ErrInvalidWebhook, minWebhookSecretLength)
+	}
+
+	sub := &domain.WebhookSubscription{
+		UserID:     userID,
+		URL:        rawURL,
+		EventTypes: slices.Compact(slices.Sorted(slices.Values(eventTypes))),
+		Secret:     secret,
+		CreatedAt:  time.Now(),
+	}
+	err := withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewWebhookRepository(tx).CreateSubscription(ctx, sub); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("Webhook %d created for %s", sub.ID, sub.URL)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "webhook", sub.ID, "create", details, nil, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sub, secret, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context, userID int64) ([]domain.WebhookSubscription, error) {
+	return s.webhookRepo.ListSubscriptions(ctx, userID)
+}
+
+func (s *webhookService) GetSubscription(ctx context.Context, userID, id int64) (*domain.WebhookSubscription, error) {
+	return s.webhookRepo.GetSubscription(ctx, userID, id)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, userID, id int64) error {
+	return withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewWebhookRepository(tx).DeleteSubscription(ctx, userID, id); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("Webhook %d deleted", id)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "webhook", id, "delete", details, nil, nil)
+	})
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, userID int64, filter domain.WebhookDeliveryFilter) (*domain.WebhookDeliveryPage, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, userID, filter.SubscriptionID); err != nil {
+		return nil, err
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = domain.DefaultPageSize
+	}
+	if filter.Limit > domain.MaxPageSize {
+		filter.Limit = domain.MaxPageSize
+	}
+	switch filter.Status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryFailed:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, succeeded or failed", domain.ErrInvalidFilter)
+	}
+
+	deliveries, err := s.webhookRepo.ListDeliveries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > filter.Limit {
+		page.Deliveries = deliveries[:filter.Limit]
+		page.NextCursor = domain.WebhookDeliveryCursor{ID: page.Deliveries[filter.Limit-1].ID}.Encode()
+	}
+	return page, nil
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, whatever its status.
+func (s *webhookService) Redeliver(ctx context.Context, userID, subscriptionID, deliveryID int64) (*domain.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, userID, subscriptionID); err != nil {
+		return nil, err
+	}
+	delivery, err := s.webhookRepo.GetDelivery(ctx, subscriptionID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Status = domain.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	err = withTx(ctx, s.db, func(tx *repository.Tx) error {
+		if err := repository.NewWebhookRepository(tx).UpdateDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("Delivery %d of event %s redelivered", delivery.ID, delivery.EventID)
+		return s.auditService.Enqueue(ctx, repository.NewOutboxRepository(tx), "webhook", subscriptionID, "redeliver", details, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Deliver queues a delivery of the event for every subscription of the users it concerns.
+// The deliveries are sent by RunDeliveries, so a slow endpoint never holds up the outbox.
+func (s *webhookService) Deliver(ctx context.Context, msg *domain.OutboxMessage) error {
+	var event domain.Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	userIDs, err := event.UserIDs()
+	if err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+	}
+
+	subs, err := s.webhookRepo.ListSubscriptionsForUsers(ctx, userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to find webhook subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		if !sub.Subscribes(event.Type) {
+			continue
+		}
+		now := time.Now()
+		delivery := &domain.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        msg.Payload,
+			Status:         domain.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+		if err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// RunDeliveries sends the due deliveries every interval until ctx is cancelled.
+func (s *webhookService) RunDeliveries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				sent, err := s.sendBatch(ctx)
+				if err != nil {
+					s.logger.ErrorContext(ctx, "webhook deliveries failed", "error", err)
+					break
+				}
+				if sent < webhookBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// sendBatch leases a batch of due deliveries and sends them concurrently. It returns how many
+// deliveries were due, which can be more than were sent.
+func (s *webhookService) sendBatch(ctx context.Context) (int, error) {
+	deliveries, subs, due, err := s.claimBatch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(d *domain.WebhookDelivery) {
+			defer wg.Done()
+			if err := s.attempt(ctx, subs[d.SubscriptionID], d); err != nil {
+				s.logger.ErrorContext(ctx, "failed to record webhook delivery", "delivery_id", d.ID, "subscription_id", d.SubscriptionID, "error", err)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return due, nil
+}
+
+// claimBatch leases the due deliveries. An endpoint whose circuit is half-open, no longer open but
+// not yet closed by a success, gets a single delivery as a probe. Its other deliveries are held
+// back, also by other dispatchers, until the probe shows whether the endpoint is back.
+func (s *webhookService) claimBatch(ctx context.Context) ([]domain.WebhookDelivery, map[int64]*domain.WebhookSubscription, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	webhookRepoTx := repository.NewWebhookRepository(tx)
+
+	now := time.Now()
+	due, err := webhookRepoTx.ClaimDueDeliveries(ctx, now, webhookBatchSize)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	subscriptionIDs := make([]int64, 0, len(due))
+	for _, d := range due {
+		subscriptionIDs = append(subscriptionIDs, d.SubscriptionID)
+	}
+	subs, err := webhookRepoTx.GetSubscriptionsByID(ctx, subscriptionIDs)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read webhook subscriptions: %w", err)
+	}
+
+	var claimed []domain.WebhookDelivery
+	var ids []int64
+	probed := make(map[int64]bool)
+	for _, d := range due {
+		sub := subs[d.SubscriptionID]
+		if sub.CircuitOpenUntil != nil {
+			if probed[sub.ID] {
+				continue
+			}
+			probed[sub.ID] = true
+			probing, err := webhookRepoTx.ClaimProbe(ctx, sub.ID, now, now.Add(webhookLease))
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to claim webhook probe: %w", err)
+			}
+			if !probing {
+				continue
+			}
+		}
+		claimed = append(claimed, d)
+		ids = append(ids, d.ID)
+	}
+	if err := webhookRepoTx.LeaseDeliveries(ctx, ids, now.Add(webhookLease)); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to lease webhook deliveries: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return claimed, subs, len(due), nil
+}
+
+// attempt sends d to the endpoint of sub and records the outcome on the delivery and on the
+// endpoint's circuit breaker.
+func (s *webhookService) attempt(ctx context.Context, sub *domain.WebhookSubscription, d *domain.WebhookDelivery) error {
+	start := time.Now()
+	statusCode, err := s.send(ctx, sub, d)
+	webhookAttemptDuration.Observe(time.Since(start).Seconds())
+
+	now := time.Now()
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	if err == nil {
+		webhookAttemptsTotal.WithLabelValues("success").Inc()
+		d.Status = domain.WebhookDeliverySucceeded
+		d.LastError = ""
+		d.DeliveredAt = &now
+		if err := s.webhookRepo.UpdateDelivery(ctx, d); err != nil {
+			return err
+		}
+		return s.webhookRepo.RecordEndpointSuccess(ctx, sub.ID)
+	}
+
+	webhookAttemptsTotal.WithLabelValues("failure").Inc()
+	d.LastError = truncate(err.Error(), 1000)
+	if d.Attempts >= maxWebhookAttempts {
+		d.Status = domain.WebhookDeliveryFailed
+	} else {
+		d.NextAttemptAt = now.Add(webhookBackoff(d.Attempts))
+	}
+	if err := s.webhookRepo.UpdateDelivery(ctx, d); err != nil {
+		return err
+	}
+	return s.webhookRepo.RecordEndpointFailure(ctx, sub.ID, webhookCircuitThreshold, now.Add(webhookCircuitOpenFor))
+}
+
+// send posts the event with a signature over the timestamp and body, see SignWebhook. Any 2xx
+// answer counts as delivered. The status code is zero when there was no answer.
+func (s *webhookService) send(ctx context.Context, sub *domain.WebhookSubscription, d *domain.WebhookDelivery) (int, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "backend-project-webhooks/1")
+	req.Header.Set("X-Webhook-ID", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "v1="+SignWebhook(sub.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused, the body itself is not kept.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("endpoint answered " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret. Receivers
+// recompute it to check that a delivery is authentic, and reject old timestamps against replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the wait after every failed attempt, starting at thirty seconds.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := 15 * time.Second << attempts
+	if backoff <= 0 || backoff > maxWebhookBackoff {
+		return maxWebhookBackoff
+	}
+	return backoff
+}
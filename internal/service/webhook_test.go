@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+	"github.com/yusuf4ktas/backend-project/internal/repository"
+)
+
+const testWebhookSecret = "whsec_test_secret_0123"
+
+func TestSignWebhook(t *testing.T) {
+	// Computed independently with HMAC-SHA256 over "1700000000.{"id":"evt_1"}".
+	const want = "73f168c8f95cae26bf3b3104a1307c3040d4d7a17c3c699c8af06025c9c6bd14"
+	if got := SignWebhook(testWebhookSecret, 1700000000, []byte(`{"id":"evt_1"}`)); got != want {
+		t.Errorf("SignWebhook() = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookSendSignsRequest(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer endpoint.Close()
+
+	s := &webhookService{client: NewWebhookClient(time.Second, true)}
+	sub := &domain.WebhookSubscription{ID: 1, URL: endpoint.URL, Secret: testWebhookSecret}
+	d := &domain.WebhookDelivery{ID: 2, EventID: "evt_1", EventType: "transfer.completed", Payload: []byte(`{"id":"evt_1"}`)}
+
+	if _, err := s.send(context.Background(), sub, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	timestamp, err := strconv.ParseInt(received.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header: %v", err)
+	}
+	if got, want := received.Header.Get("X-Webhook-Signature"), "v1="+SignWebhook(testWebhookSecret, timestamp, body); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if got := received.Header.Get("X-Webhook-ID"); got != d.EventID {
+		t.Errorf("X-Webhook-ID = %s, want %s", got, d.EventID)
+	}
+	if string(body) != string(d.Payload) {
+		t.Errorf("body = %s, want %s", body, d.Payload)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxWebhookBackoff},
+		{maxWebhookAttempts, maxWebhookBackoff},
+		{64, maxWebhookBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookAttempt(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		// attempts is the number of attempts made before this one.
+		attempts   int
+		wantStatus domain.WebhookDeliveryStatus
+		// wantRetryIn is the wait before the next attempt, zero when there is none.
+		wantRetryIn time.Duration
+		// breaker is the statement recording the outcome on the endpoint's circuit.
+		breaker string
+	}{
+		{
+			name:       "success closes the circuit",
+			statusCode: http.StatusNoContent,
+			wantStatus: domain.WebhookDeliverySucceeded,
+			breaker:    "UPDATE webhook_subscriptions SET consecutive_failures = 0, circuit_open_until = NULL, probe_in_flight_until = NULL",
+		},
+		{
+			name:        "failure is retried with backoff",
+			statusCode:  http.StatusInternalServerError,
+			attempts:    2,
+			wantStatus:  domain.WebhookDeliveryPending,
+			wantRetryIn: 2 * time.Minute,
+			breaker:     "SET consecutive_failures = consecutive_failures \\+ 1",
+		},
+		{
+			name:       "last failure gives up",
+			statusCode: http.StatusBadGateway,
+			attempts:   maxWebhookAttempts - 1,
+			wantStatus: domain.WebhookDeliveryFailed,
+			breaker:    "SET consecutive_failures = consecutive_failures \\+ 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer endpoint.Close()
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectExec("UPDATE webhook_deliveries SET status").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(tt.breaker).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			s := NewWebhookService(db, repository.NewWebhookRepository(db), nil, NewWebhookClient(time.Second, true), discardLogger).(*webhookService)
+			sub := &domain.WebhookSubscription{ID: 1, URL: endpoint.URL, Secret: testWebhookSecret}
+			d := &domain.WebhookDelivery{ID: 2, SubscriptionID: 1, Status: domain.WebhookDeliveryPending, Attempts: tt.attempts, Payload: []byte(`{}`)}
+
+			before := time.Now()
+			if err := s.attempt(context.Background(), sub, d); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+
+			if d.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", d.Status, tt.wantStatus)
+			}
+			if d.Attempts != tt.attempts+1 || d.LastStatusCode != tt.statusCode {
+				t.Errorf("attempts %d with status code %d, want %d with %d", d.Attempts, d.LastStatusCode, tt.attempts+1, tt.statusCode)
+			}
+			if tt.wantRetryIn != 0 {
+				if retryIn := d.NextAttemptAt.Sub(before); retryIn < tt.wantRetryIn || retryIn > tt.wantRetryIn+time.Second {
+					t.Errorf("next attempt in %v, want %v", retryIn, tt.wantRetryIn)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookClaimBatchProbesHalfOpenCircuitOnce(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name             string
+		circuitOpenUntil *time.Time
+		// probeClaimed is whether ClaimProbe wins, nil when the circuit is closed and no probe is needed.
+		probeClaimed *bool
+		wantClaimed  int
+	}{
+		{name: "closed circuit", wantClaimed: 2},
+		{name: "half-open circuit", circuitOpenUntil: &past, probeClaimed: ptr(true), wantClaimed: 1},
+		{name: "probe already in flight", circuitOpenUntil: &past, probeClaimed: ptr(false), wantClaimed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			now := time.Now()
+			deliveries := sqlmock.NewRows([]string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"})
+			for id := int64(1); id <= 2; id++ {
+				deliveries.AddRow(id, 7, "evt_"+strconv.FormatInt(id, 10), "transfer.completed", "{}", domain.WebhookDeliveryPending, 0, now, nil, nil, now, nil)
+			}
+			var openUntil driver.Value
+			if tt.circuitOpenUntil != nil {
+				openUntil = *tt.circuitOpenUntil
+			}
+			subs := sqlmock.NewRows([]string{"id", "user_id", "url", "event_types", "secret", "consecutive_failures", "circuit_open_until", "created_at"}).
+				AddRow(7, 1, "https://example.com/hook", "transfer.completed", testWebhookSecret, webhookCircuitThreshold, openUntil, now)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM webhook_deliveries d JOIN webhook_subscriptions s").WillReturnRows(deliveries)
+			mock.ExpectQuery("FROM webhook_subscriptions WHERE id IN").WillReturnRows(subs)
+			if tt.probeClaimed != nil {
+				var affected int64
+				if *tt.probeClaimed {
+					affected = 1
+				}
+				mock.ExpectExec("UPDATE webhook_subscriptions SET probe_in_flight_until").
+					WithArgs(sqlmock.AnyArg(), 7, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, affected))
+			}
+			if tt.wantClaimed > 0 {
+				args := []driver.Value{sqlmock.AnyArg()}
+				for id := 1; id <= tt.wantClaimed; id++ {
+					args = append(args, int64(id))
+				}
+				mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at").WithArgs(args...).
+					WillReturnResult(sqlmock.NewResult(0, int64(tt.wantClaimed)))
+			}
+			mock.ExpectCommit()
+
+			s := NewWebhookService(db, repository.NewWebhookRepository(db), nil, nil, discardLogger).(*webhookService)
+			claimed, _, due, err := s.claimBatch(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			if len(claimed) != tt.wantClaimed || due != 2 {
+				t.Errorf("claimed %d of %d due deliveries, want %d of 2", len(claimed), due, tt.wantClaimed)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer endpoint.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{name: "loopback refused", wantErr: true},
+		{name: "loopback allowed in development", allowPrivate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := NewWebhookClient(time.Second, tt.allowPrivate).Post(endpoint.URL, "application/json", strings.NewReader("{}"))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "is not public") {
+					t.Errorf("err = %v, want the dial to be refused", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
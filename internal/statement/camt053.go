@@ -0,0 +1,232 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+// camt053Writer writes an ISO 20022 BankToCustomerStatement (camt.053.001.02). The schema puts the
+// closing balance and the totals before the entries, so entries are collected and written on Close.
+type camt053Writer struct {
+	w       io.Writer
+	header  Header
+	entries []camtEntry
+	credits camtTotal
+	debits  camtTotal
+}
+
+func newCamt053Writer(w io.Writer) *camt053Writer {
+	return &camt053Writer{w: w}
+}
+
+type camtDocument struct {
+	XMLName xml.Name        `xml:"Document"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Stmt    camtBankToCstmr `xml:"BkToCstmrStmt"`
+}
+
+type camtBankToCstmr struct {
+	GrpHdr camtGroupHeader `xml:"GrpHdr"`
+	Stmt   camtStatement   `xml:"Stmt"`
+}
+
+type camtGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtStatement struct {
+	Id        string        `xml:"Id"`
+	CreDtTm   string        `xml:"CreDtTm"`
+	FrToDt    camtPeriod    `xml:"FrToDt"`
+	Acct      camtAccount   `xml:"Acct"`
+	Bal       []camtBalance `xml:"Bal"`
+	TxsSummry camtSummary   `xml:"TxsSummry"`
+	Ntry      []camtEntry   `xml:"Ntry"`
+}
+
+type camtPeriod struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	Id   string        `xml:"Id>Othr>Id"`
+	Ccy  string        `xml:"Ccy"`
+	Svcr *camtServicer `xml:"Svcr,omitempty"`
+}
+
+type camtServicer struct {
+	BIC string `xml:"FinInstnId>BIC"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        string     `xml:"Dt>Dt"`
+}
+
+type camtTotal struct {
+	NbOfNtries int    `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+
+	sum float64
+}
+
+type camtSummary struct {
+	TtlNtries    camtNetTotal `xml:"TtlNtries"`
+	TtlCdtNtries camtTotal    `xml:"TtlCdtNtries"`
+	TtlDbtNtries camtTotal    `xml:"TtlDbtNtries"`
+}
+
+type camtNetTotal struct {
+	NbOfNtries    int    `xml:"NbOfNtries"`
+	Sum           string `xml:"Sum"`
+	TtlNetNtryAmt string `xml:"TtlNetNtryAmt"`
+	CdtDbtInd     string `xml:"CdtDbtInd"`
+}
+
+type camtEntry struct {
+	NtryRef     string        `xml:"NtryRef"`
+	Amt         camtAmount    `xml:"Amt"`
+	CdtDbtInd   string        `xml:"CdtDbtInd"`
+	Sts         string        `xml:"Sts"`
+	BookgDt     string        `xml:"BookgDt>DtTm"`
+	ValDt       string        `xml:"ValDt>DtTm"`
+	AcctSvcrRef string        `xml:"AcctSvcrRef"`
+	BkTxCd      string        `xml:"BkTxCd>Prtry>Cd"`
+	Details     camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtTxDetails struct {
+	AcctSvcrRef string `xml:"Refs>AcctSvcrRef"`
+	Ustrd       string `xml:"RmtInf>Ustrd"`
+}
+
+func (c *camt053Writer) WriteHeader(h Header) error {
+	c.header = h
+	return nil
+}
+
+func (c *camt053Writer) WriteLine(l Line) error {
+	indicator := creditDebit(l.Amount)
+	amount := math.Abs(l.Amount)
+	if indicator == "CRDT" {
+		c.credits.NbOfNtries++
+		c.credits.sum += amount
+	} else {
+		c.debits.NbOfNtries++
+		c.debits.sum += amount
+	}
+
+	// The transaction ID is the servicer's reference, it stays the same across exports.
+	ref := strconv.FormatInt(l.TransactionID, 10)
+	c.entries = append(c.entries, camtEntry{
+		NtryRef:     ref,
+		Amt:         c.amount(amount),
+		CdtDbtInd:   indicator,
+		Sts:         "BOOK",
+		BookgDt:     camtDateTime(l.Date),
+		ValDt:       camtDateTime(l.Date),
+		AcctSvcrRef: ref,
+		BkTxCd:      l.Type,
+		Details: camtTxDetails{
+			AcctSvcrRef: ref,
+			Ustrd:       truncateText(l.Description, 140),
+		},
+	})
+	return nil
+}
+
+func (c *camt053Writer) Close(s Summary) error {
+	h := c.header
+	id := StatementID(h)
+	c.credits.Sum = formatAmount(c.credits.sum)
+	c.debits.Sum = formatAmount(c.debits.sum)
+	net := round(c.credits.sum - c.debits.sum)
+
+	account := camtAccount{Id: strconv.FormatInt(h.AccountID, 10), Ccy: h.Bank.Currency}
+	if h.Bank.BIC != "" {
+		account.Svcr = &camtServicer{BIC: h.Bank.BIC}
+	}
+
+	doc := camtDocument{
+		Xmlns: camt053Namespace,
+		Stmt: camtBankToCstmr{
+			GrpHdr: camtGroupHeader{
+				MsgId:   fmt.Sprintf("%s-%d", id, h.GeneratedAt.Unix()),
+				CreDtTm: camtDateTime(h.GeneratedAt),
+			},
+			Stmt: camtStatement{
+				Id:      id,
+				CreDtTm: camtDateTime(h.GeneratedAt),
+				FrToDt:  camtPeriod{FrDtTm: camtDateTime(h.From), ToDtTm: camtDateTime(h.To)},
+				Acct:    account,
+				Bal: []camtBalance{
+					c.balance("OPBD", h.OpeningBalance, h.From),
+					// The period end is exclusive, the closing balance is booked on the day before it.
+					c.balance("CLBD", s.ClosingBalance, h.To.Add(-time.Nanosecond)),
+				},
+				TxsSummry: camtSummary{
+					TtlNtries: camtNetTotal{
+						NbOfNtries:    s.Count,
+						Sum:           formatAmount(c.credits.sum + c.debits.sum),
+						TtlNetNtryAmt: formatAmount(math.Abs(net)),
+						CdtDbtInd:     creditDebit(net),
+					},
+					TtlCdtNtries: c.credits,
+					TtlDbtNtries: c.debits,
+				},
+				Ntry: c.entries,
+			},
+		},
+	}
+
+	if _, err := io.WriteString(c.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(c.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c.w, "\n")
+	return err
+}
+
+func (c *camt053Writer) balance(code string, amount float64, date time.Time) camtBalance {
+	return camtBalance{
+		Code:      code,
+		Amt:       c.amount(math.Abs(amount)),
+		CdtDbtInd: creditDebit(amount),
+		Dt:        date.UTC().Format(time.DateOnly),
+	}
+}
+
+func (c *camt053Writer) amount(value float64) camtAmount {
+	return camtAmount{Ccy: c.header.Bank.Currency, Value: formatAmount(value)}
+}
+
+// creditDebit returns the ISO 20022 indicator, amounts themselves are always written unsigned.
+func creditDebit(amount float64) string {
+	if amount < 0 {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func camtDateTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
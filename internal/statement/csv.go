@@ -0,0 +1,45 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvWriter writes one row per transaction between an opening and a closing balance row,
+// which is what spreadsheet and accounting imports expect.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteHeader(h Header) error {
+	if err := c.w.Write([]string{"date", "transaction_id", "type", "description", "counterparty_id", "amount", "balance"}); err != nil {
+		return err
+	}
+	return c.w.Write([]string{h.From.Format(time.RFC3339), "", "", "Opening balance", "", "", formatAmount(h.OpeningBalance)})
+}
+
+func (c *csvWriter) WriteLine(l Line) error {
+	return c.w.Write([]string{
+		l.Date.Format(time.RFC3339),
+		strconv.FormatInt(l.TransactionID, 10),
+		l.Type,
+		l.Description,
+		strconv.FormatInt(l.CounterpartyID, 10),
+		formatAmount(l.Amount),
+		formatAmount(l.Balance),
+	})
+}
+
+func (c *csvWriter) Close(s Summary) error {
+	if err := c.w.Write([]string{"", "", "", "Closing balance", "", "", formatAmount(s.ClosingBalance)}); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,37 @@
+package statement
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonlWriter writes one JSON object per line. The "record" field tells the header,
+// transaction and summary records apart.
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonlWriter) WriteHeader(h Header) error {
+	return j.enc.Encode(struct {
+		Record string `json:"record"`
+		Header
+	}{"header", h})
+}
+
+func (j *jsonlWriter) WriteLine(l Line) error {
+	return j.enc.Encode(struct {
+		Record string `json:"record"`
+		Line
+	}{"transaction", l})
+}
+
+func (j *jsonlWriter) Close(s Summary) error {
+	return j.enc.Encode(struct {
+		Record string `json:"record"`
+		Summary
+	}{"summary", s})
+}
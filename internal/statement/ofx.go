@@ -0,0 +1,155 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ofxHeader marks the document as OFX 2.2, it follows the XML declaration.
+const ofxHeader = `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+
+// ofxWriter writes an OFX 2.2 bank statement response. Transactions are streamed inside
+// BANKTRANLIST, the closing balance follows as LEDGERBAL, as the specification orders them.
+type ofxWriter struct {
+	w      io.Writer
+	enc    *xml.Encoder
+	header Header
+}
+
+func newOFXWriter(w io.Writer) *ofxWriter {
+	return &ofxWriter{w: w, enc: xml.NewEncoder(w)}
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignon struct {
+	Status   ofxStatus `xml:"STATUS"`
+	DTServer string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+}
+
+type ofxBankAccount struct {
+	BankID   string `xml:"BANKID"`
+	AcctID   string `xml:"ACCTID"`
+	AcctType string `xml:"ACCTTYPE"`
+}
+
+type ofxTransaction struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DTPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FITID    string `xml:"FITID"`
+	Name     string `xml:"NAME"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+type ofxBalance struct {
+	BalAmt string `xml:"BALAMT"`
+	DTAsOf string `xml:"DTASOF"`
+}
+
+func (o *ofxWriter) WriteHeader(h Header) error {
+	o.header = h
+
+	if _, err := io.WriteString(o.w, xml.Header+ofxHeader); err != nil {
+		return err
+	}
+	o.enc.Indent("", "  ")
+
+	o.start("OFX")
+	o.start("SIGNONMSGSRSV1")
+	if err := o.enc.EncodeElement(ofxSignon{
+		Status:   ofxStatus{Code: 0, Severity: "INFO"},
+		DTServer: ofxDate(h.GeneratedAt),
+		Language: "ENG",
+	}, xml.StartElement{Name: xml.Name{Local: "SONRS"}}); err != nil {
+		return err
+	}
+	o.end("SIGNONMSGSRSV1")
+
+	o.start("BANKMSGSRSV1")
+	o.start("STMTTRNRS")
+	o.element("TRNUID", StatementID(h))
+	if err := o.enc.EncodeElement(ofxStatus{Code: 0, Severity: "INFO"}, xml.StartElement{Name: xml.Name{Local: "STATUS"}}); err != nil {
+		return err
+	}
+	o.start("STMTRS")
+	o.element("CURDEF", h.Bank.Currency)
+	if err := o.enc.EncodeElement(ofxBankAccount{
+		BankID:   h.Bank.BankID,
+		AcctID:   strconv.FormatInt(h.AccountID, 10),
+		AcctType: "CHECKING",
+	}, xml.StartElement{Name: xml.Name{Local: "BANKACCTFROM"}}); err != nil {
+		return err
+	}
+	o.start("BANKTRANLIST")
+	o.element("DTSTART", ofxDate(h.From))
+	o.element("DTEND", ofxDate(h.To))
+
+	return o.enc.Flush()
+}
+
+func (o *ofxWriter) WriteLine(l Line) error {
+	trnType := "XFER"
+	switch l.Type {
+	case "credit":
+		trnType = "CREDIT"
+	case "debit":
+		trnType = "DEBIT"
+	}
+
+	// FITID must never change for a transaction, importers use it to skip entries they already have.
+	return o.enc.EncodeElement(ofxTransaction{
+		TrnType:  trnType,
+		DTPosted: ofxDate(l.Date),
+		TrnAmt:   formatAmount(l.Amount),
+		FITID:    strconv.FormatInt(l.TransactionID, 10),
+		Name:     truncateText(l.Description, 32),
+		Memo:     l.Description,
+	}, xml.StartElement{Name: xml.Name{Local: "STMTTRN"}})
+}
+
+func (o *ofxWriter) Close(s Summary) error {
+	o.end("BANKTRANLIST")
+
+	balance := ofxBalance{BalAmt: formatAmount(s.ClosingBalance), DTAsOf: ofxDate(o.header.To)}
+	if err := o.enc.EncodeElement(balance, xml.StartElement{Name: xml.Name{Local: "LEDGERBAL"}}); err != nil {
+		return err
+	}
+	if err := o.enc.EncodeElement(balance, xml.StartElement{Name: xml.Name{Local: "AVAILBAL"}}); err != nil {
+		return err
+	}
+
+	o.end("STMTRS")
+	o.end("STMTTRNRS")
+	o.end("BANKMSGSRSV1")
+	o.end("OFX")
+	if err := o.enc.Close(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(o.w, "\n")
+	return err
+}
+
+// start, end and element ignore errors, write errors stick to the encoder and surface on the next Flush or Close.
+func (o *ofxWriter) start(name string) {
+	o.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+func (o *ofxWriter) end(name string) {
+	o.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (o *ofxWriter) element(name, value string) {
+	o.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+// ofxDate formats t as an OFX datetime in UTC, e.g. 20240131235959.000[0:GMT].
+func ofxDate(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
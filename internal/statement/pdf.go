@@ -0,0 +1,214 @@
+package statement
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A4 in PDF points.
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	pageMargin   = 50.0
+	lineHeight   = 13.0
+	tableFont    = 9.0
+	courierWidth = 0.6 // Courier advances every glyph by 600/1000 of the font size.
+)
+
+// Objects with fixed numbers, pages and their contents are numbered from firstPageObject on.
+const (
+	catalogObject = iota + 1
+	pagesObject
+	boldFontObject
+	regularFontObject
+	monoFontObject
+	firstPageObject
+)
+
+// pdfWriter renders a statement as a PDF 1.4 document using only the standard Type 1 fonts,
+// which every reader provides, so nothing has to be embedded. Each page is written as soon as
+// it is full, which keeps memory flat for long statements.
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	err     error
+	offsets map[int]int
+	pages   []int
+	nextObj int
+
+	header Header
+	page   bytes.Buffer
+	y      float64
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{
+		w:       bufio.NewWriter(w),
+		offsets: make(map[int]int),
+		nextObj: firstPageObject,
+	}
+}
+
+func (p *pdfWriter) WriteHeader(h Header) error {
+	p.header = h
+
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	p.object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+	p.object(boldFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	p.object(regularFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.object(monoFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	p.newPage()
+	p.text("F1", 16, pageMargin, p.y, "Account Statement")
+	p.y -= 24
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Account: %d", h.AccountID))
+	p.y -= lineHeight
+	// The period is stored with an exclusive end, the last day shown is the one before it.
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Period: %s to %s", h.From.Format(time.DateOnly), h.To.Add(-time.Nanosecond).Format(time.DateOnly)))
+	p.y -= lineHeight
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Generated: %s", h.GeneratedAt.UTC().Format(time.RFC3339)))
+	p.y -= lineHeight
+	p.text("F1", 10, pageMargin, p.y, fmt.Sprintf("Opening balance: %s", formatAmount(h.OpeningBalance)))
+	p.y -= 2 * lineHeight
+	p.tableHeader()
+
+	return p.err
+}
+
+func (p *pdfWriter) WriteLine(l Line) error {
+	if p.y < pageMargin+lineHeight {
+		p.endPage()
+		p.newPage()
+		p.tableHeader()
+	}
+
+	p.text("F3", tableFont, pageMargin, p.y, l.Date.UTC().Format("2006-01-02 15:04"))
+	p.text("F3", tableFont, 140, p.y, fmt.Sprintf("%d", l.TransactionID))
+	p.text("F3", tableFont, 200, p.y, truncateText(l.Description, 32))
+	p.rightText("F3", tableFont, 465, p.y, formatAmount(l.Amount))
+	p.rightText("F3", tableFont, pageWidth-pageMargin, p.y, formatAmount(l.Balance))
+	p.y -= lineHeight
+
+	return p.err
+}
+
+func (p *pdfWriter) Close(s Summary) error {
+	// The summary block needs four lines, move it to a new page rather than splitting it.
+	if p.y < pageMargin+5*lineHeight {
+		p.endPage()
+		p.newPage()
+	}
+
+	p.y -= lineHeight
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Transactions: %d", s.Count))
+	p.y -= lineHeight
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Total in: %s", formatAmount(s.TotalIn)))
+	p.y -= lineHeight
+	p.text("F2", 10, pageMargin, p.y, fmt.Sprintf("Total out: %s", formatAmount(s.TotalOut)))
+	p.y -= lineHeight
+	p.text("F1", 10, pageMargin, p.y, fmt.Sprintf("Closing balance: %s", formatAmount(s.ClosingBalance)))
+	p.endPage()
+
+	kids := make([]string, len(p.pages))
+	for i, page := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	p.object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+
+	xref := p.offset
+	size := p.nextObj
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", size)
+	for obj := 1; obj < size; obj++ {
+		p.printf("%010d 00000 n \n", p.offsets[obj])
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, catalogObject, xref)
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+func (p *pdfWriter) tableHeader() {
+	p.text("F1", tableFont, pageMargin, p.y, "Date")
+	p.text("F1", tableFont, 140, p.y, "ID")
+	p.text("F1", tableFont, 200, p.y, "Description")
+	p.text("F1", tableFont, 430, p.y, "Amount")
+	p.text("F1", tableFont, 508, p.y, "Balance")
+	p.y -= 4
+	fmt.Fprintf(&p.page, "%.2f %.2f m %.2f %.2f l S\n", pageMargin, p.y, pageWidth-pageMargin, p.y)
+	p.y -= lineHeight
+}
+
+func (p *pdfWriter) newPage() {
+	p.page.Reset()
+	p.y = pageHeight - pageMargin
+}
+
+// endPage writes the buffered page content followed by its page object.
+func (p *pdfWriter) endPage() {
+	p.text("F2", 8, pageMargin, pageMargin/2, fmt.Sprintf("Account %d - page %d", p.header.AccountID, len(p.pages)+1))
+
+	content := p.nextObj
+	page := p.nextObj + 1
+	p.nextObj += 2
+
+	p.object(content, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.page.Len(), p.page.String()))
+	p.object(page, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R /F2 %d 0 R /F3 %d 0 R >> >> >>",
+		pagesObject, pageWidth, pageHeight, content, boldFontObject, regularFontObject, monoFontObject,
+	))
+	p.pages = append(p.pages, page)
+}
+
+func (p *pdfWriter) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(&p.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escapePDFText(s))
+}
+
+// rightText right-aligns s at x. Only used with the monospaced font, whose width is known.
+func (p *pdfWriter) rightText(font string, size, x, y float64, s string) {
+	p.text(font, size, x-float64(len(s))*size*courierWidth, y, s)
+}
+
+func (p *pdfWriter) object(num int, body string) {
+	p.offsets[num] = p.offset
+	p.printf("%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.offset += n
+	p.err = err
+}
+
+// escapePDFText escapes the string delimiters and replaces anything outside printable ASCII,
+// which the standard fonts cannot be relied on to render.
+func escapePDFText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
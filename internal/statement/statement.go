@@ -0,0 +1,157 @@
+// Package statement renders account statements in the formats offered for download.
+package statement
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+// Institution identifies the bank in the formats that require it.
+type Institution struct {
+	Currency string `json:"currency"`
+	BankID   string `json:"-"`
+	BIC      string `json:"-"`
+}
+
+// Header opens a statement for the period [From, To).
+type Header struct {
+	AccountID      int64       `json:"account_id"`
+	Bank           Institution `json:"bank"`
+	From           time.Time   `json:"from"`
+	To             time.Time   `json:"to"`
+	OpeningBalance float64     `json:"opening_balance"`
+	GeneratedAt    time.Time   `json:"generated_at"`
+}
+
+// Line is one transaction as seen by the account holder.
+type Line struct {
+	TransactionID  int64     `json:"transaction_id"`
+	Date           time.Time `json:"date"`
+	Type           string    `json:"type"`
+	CounterpartyID int64     `json:"counterparty_id"`
+	Description    string    `json:"description"`
+	// Amount is positive for money received and negative for money sent.
+	Amount float64 `json:"amount"`
+	// Balance is the running balance after this transaction.
+	Balance float64 `json:"balance"`
+}
+
+// Summary closes a statement.
+type Summary struct {
+	ClosingBalance float64 `json:"closing_balance"`
+	TotalIn        float64 `json:"total_in"`
+	TotalOut       float64 `json:"total_out"`
+	Count          int     `json:"count"`
+}
+
+// Add accounts for a line that was written to the statement.
+func (s *Summary) Add(l Line) {
+	if l.Amount >= 0 {
+		s.TotalIn = round(s.TotalIn + l.Amount)
+	} else {
+		s.TotalOut = round(s.TotalOut - l.Amount)
+	}
+	s.ClosingBalance = l.Balance
+	s.Count++
+}
+
+// Writer streams a statement: one header, any number of lines, then Close with the summary.
+type Writer interface {
+	WriteHeader(h Header) error
+	WriteLine(l Line) error
+	// Close writes the summary and flushes any buffered output. It does not close the underlying writer.
+	Close(s Summary) error
+}
+
+func NewWriter(format domain.StatementFormat, w io.Writer) (Writer, error) {
+	switch format {
+	case domain.StatementCSV:
+		return newCSVWriter(w), nil
+	case domain.StatementJSONL:
+		return newJSONLWriter(w), nil
+	case domain.StatementPDF:
+		return newPDFWriter(w), nil
+	case domain.StatementOFX:
+		return newOFXWriter(w), nil
+	case domain.StatementCamt053:
+		return newCamt053Writer(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+}
+
+func ContentType(format domain.StatementFormat) string {
+	switch format {
+	case domain.StatementCSV:
+		return "text/csv; charset=utf-8"
+	case domain.StatementJSONL:
+		return "application/jsonl"
+	case domain.StatementPDF:
+		return "application/pdf"
+	case domain.StatementOFX:
+		return "application/x-ofx"
+	case domain.StatementCamt053:
+		return "application/xml"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// FileName suggests a download name such as statement-42-2024-01-01-2024-02-01.csv.
+func FileName(req domain.StatementRequest) string {
+	extension := string(req.Format)
+	if req.Format == domain.StatementCamt053 {
+		extension = "xml"
+	}
+	return fmt.Sprintf("statement-%d-%s-%s.%s", req.UserID, req.From.Format(time.DateOnly), req.To.Format(time.DateOnly), extension)
+}
+
+// StatementID identifies a statement by account and period, so exporting the same period twice
+// yields the same identifier.
+func StatementID(h Header) string {
+	return fmt.Sprintf("STMT-%d-%s-%s", h.AccountID, h.From.UTC().Format("20060102"), h.To.UTC().Format("20060102"))
+}
+
+// NewLine describes tx from the point of view of accountID, whose balance before tx was balance.
+func NewLine(accountID int64, tx *domain.Transaction, balance float64) Line {
+	line := Line{
+		TransactionID: tx.ID,
+		Date:          tx.CreatedAt,
+		Type:          tx.TransactionType,
+	}
+
+	if tx.ToUserID == accountID {
+		line.Amount = tx.Amount
+		line.CounterpartyID = tx.FromUserID
+	} else {
+		line.Amount = -tx.Amount
+		line.CounterpartyID = tx.ToUserID
+	}
+
+	switch {
+	case tx.TransactionType == "credit":
+		line.Description = "Credit from bank"
+	case tx.TransactionType == "debit":
+		line.Description = "Debit to bank"
+	case line.Amount >= 0:
+		line.Description = fmt.Sprintf("Transfer from user %d", line.CounterpartyID)
+	default:
+		line.Description = fmt.Sprintf("Transfer to user %d", line.CounterpartyID)
+	}
+
+	line.Balance = round(balance + line.Amount)
+	return line
+}
+
+// round drops the floating point noise that builds up when summing amounts, balances are kept in cents.
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
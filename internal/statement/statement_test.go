@@ -0,0 +1,277 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yusuf4ktas/backend-project/internal/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// render writes a fixed statement for account 1: a credit, a transfer in and a transfer out.
+func render(t *testing.T, format domain.StatementFormat) []byte {
+	t.Helper()
+	day := time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC)
+	header := Header{
+		AccountID:      1,
+		Bank:           Institution{Currency: "EUR", BankID: "BANK0001", BIC: "BANKDEFFXXX"},
+		From:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		OpeningBalance: 100,
+		GeneratedAt:    time.Date(2024, 2, 1, 6, 0, 0, 0, time.UTC),
+	}
+	txs := []*domain.Transaction{
+		{ID: 10, ToUserID: 1, Amount: 250.5, TransactionType: "credit", CreatedAt: day},
+		{ID: 11, FromUserID: 2, ToUserID: 1, Amount: 19.99, TransactionType: "transfer", CreatedAt: day.Add(time.Hour)},
+		{ID: 12, FromUserID: 1, ToUserID: 3, Amount: 400, TransactionType: "transfer", CreatedAt: day.Add(48 * time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	summary := Summary{ClosingBalance: header.OpeningBalance}
+	for _, tx := range txs {
+		line := NewLine(header.AccountID, tx, summary.ClosingBalance)
+		if err := w.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+		summary.Add(line)
+	}
+	if err := w.Close(summary); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterGolden(t *testing.T) {
+	tests := []struct {
+		format domain.StatementFormat
+		golden string
+	}{
+		{format: domain.StatementOFX, golden: "statement.ofx"},
+		{format: domain.StatementCamt053, golden: "statement.camt053.xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got := render(t, tt.format)
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s, run go test -update to accept it:\n%s", path, got)
+			}
+		})
+	}
+}
+
+// node is a parsed XML element, enough to check a document against the shape of its schema.
+type node struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*node
+}
+
+func parseXML(t *testing.T, data []byte) *node {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*node
+	var root *node
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: tok.Name.Local, attrs: map[string]string{}}
+			for _, a := range tok.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += strings.TrimSpace(string(tok))
+			}
+		}
+	}
+	if root == nil {
+		t.Fatal("document has no root element")
+	}
+	return root
+}
+
+// particle is one element of an xs:sequence; max 0 means unbounded.
+type particle struct {
+	name     string
+	min, max int
+}
+
+// camt053Sequences lists, for each complex type the writer emits, the xs:sequence of
+// camt.053.001.02 it has to follow. Optional elements the writer never emits are left out,
+// they cannot change the relative order of the ones it does.
+var camt053Sequences = map[string][]particle{
+	"Document":      {{"BkToCstmrStmt", 1, 1}},
+	"BkToCstmrStmt": {{"GrpHdr", 1, 1}, {"Stmt", 1, 0}},
+	"GrpHdr":        {{"MsgId", 1, 1}, {"CreDtTm", 1, 1}},
+	"Stmt":          {{"Id", 1, 1}, {"CreDtTm", 1, 1}, {"FrToDt", 0, 1}, {"Acct", 1, 1}, {"Bal", 1, 0}, {"TxsSummry", 0, 1}, {"Ntry", 0, 0}},
+	"FrToDt":        {{"FrDtTm", 1, 1}, {"ToDtTm", 1, 1}},
+	"Acct":          {{"Id", 1, 1}, {"Ccy", 0, 1}, {"Svcr", 0, 1}},
+	"Othr":          {{"Id", 1, 1}},
+	"Svcr":          {{"FinInstnId", 1, 1}},
+	"FinInstnId":    {{"BIC", 0, 1}},
+	"Bal":           {{"Tp", 1, 1}, {"Amt", 1, 1}, {"CdtDbtInd", 1, 1}, {"Dt", 1, 1}},
+	"Tp":            {{"CdOrPrtry", 1, 1}},
+	"CdOrPrtry":     {{"Cd", 1, 1}},
+	"TxsSummry":     {{"TtlNtries", 0, 1}, {"TtlCdtNtries", 0, 1}, {"TtlDbtNtries", 0, 1}},
+	"TtlNtries":     {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}, {"TtlNetNtryAmt", 0, 1}, {"CdtDbtInd", 0, 1}},
+	"TtlCdtNtries":  {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}},
+	"TtlDbtNtries":  {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}},
+	"Ntry":          {{"NtryRef", 0, 1}, {"Amt", 1, 1}, {"CdtDbtInd", 1, 1}, {"Sts", 1, 1}, {"BookgDt", 0, 1}, {"ValDt", 0, 1}, {"AcctSvcrRef", 0, 1}, {"BkTxCd", 1, 1}, {"NtryDtls", 0, 0}},
+	"BkTxCd":        {{"Prtry", 0, 1}},
+	"Prtry":         {{"Cd", 1, 1}},
+	"NtryDtls":      {{"TxDtls", 0, 0}},
+	"TxDtls":        {{"Refs", 0, 1}, {"RmtInf", 0, 1}},
+	"Refs":          {{"AcctSvcrRef", 0, 1}},
+	"RmtInf":        {{"Ustrd", 0, 0}},
+}
+
+var (
+	isoDateTime = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+	isoDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	// ActiveOrHistoricCurrencyAndAmount: at most 18 digits, 5 of them fractional, never negative.
+	decimalAmount = regexp.MustCompile(`^\d{1,13}(\.\d{1,5})?$`)
+)
+
+// camt053Simple checks the simple types of the leaves, keyed by the element and its parent.
+var camt053Simple = map[string]func(string) bool{
+	"GrpHdr/MsgId":            max35Text,
+	"GrpHdr/CreDtTm":          isoDateTime.MatchString,
+	"Stmt/Id":                 max35Text,
+	"Stmt/CreDtTm":            isoDateTime.MatchString,
+	"FrToDt/FrDtTm":           isoDateTime.MatchString,
+	"FrToDt/ToDtTm":           isoDateTime.MatchString,
+	"Othr/Id":                 max35Text,
+	"Acct/Ccy":                regexp.MustCompile(`^[A-Z]{3}$`).MatchString,
+	"FinInstnId/BIC":          regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`).MatchString,
+	"CdOrPrtry/Cd":            regexp.MustCompile(`^(OPBD|CLBD|ITBD|CLAV|FWAV|PRCD|OPAV|INFO|XPCD)$`).MatchString,
+	"Bal/Amt":                 decimalAmount.MatchString,
+	"Dt/Dt":                   isoDate.MatchString,
+	"Ntry/Amt":                decimalAmount.MatchString,
+	"Ntry/NtryRef":            max35Text,
+	"Ntry/Sts":                regexp.MustCompile(`^(BOOK|PDNG|INFO)$`).MatchString,
+	"Ntry/AcctSvcrRef":        max35Text,
+	"BookgDt/DtTm":            isoDateTime.MatchString,
+	"ValDt/DtTm":              isoDateTime.MatchString,
+	"Prtry/Cd":                max35Text,
+	"Refs/AcctSvcrRef":        max35Text,
+	"RmtInf/Ustrd":            func(s string) bool { return s != "" && utf8.RuneCountInString(s) <= 140 },
+	"TtlNtries/NbOfNtries":    regexp.MustCompile(`^[0-9]{1,15}$`).MatchString,
+	"TtlNtries/Sum":           decimalAmount.MatchString,
+	"TtlNtries/TtlNetNtryAmt": decimalAmount.MatchString,
+	"TtlCdtNtries/NbOfNtries": regexp.MustCompile(`^[0-9]{1,15}$`).MatchString,
+	"TtlCdtNtries/Sum":        decimalAmount.MatchString,
+	"TtlDbtNtries/NbOfNtries": regexp.MustCompile(`^[0-9]{1,15}$`).MatchString,
+	"TtlDbtNtries/Sum":        decimalAmount.MatchString,
+}
+
+func max35Text(s string) bool {
+	n := utf8.RuneCountInString(s)
+	return n >= 1 && n <= 35
+}
+
+// checkSequence reports the children of n that break the order or the occurrences of seq.
+func checkSequence(t *testing.T, path string, n *node, seq []particle) {
+	t.Helper()
+	i := 0
+	for _, p := range seq {
+		count := 0
+		for i < len(n.children) && n.children[i].name == p.name {
+			count++
+			i++
+		}
+		if count < p.min || (p.max > 0 && count > p.max) {
+			t.Errorf("%s: %d %s elements, want between %d and %d", path, count, p.name, p.min, p.max)
+		}
+	}
+	if i < len(n.children) {
+		t.Errorf("%s: unexpected %s, the schema does not allow it here", path, n.children[i].name)
+	}
+}
+
+func checkCamt053(t *testing.T, path string, parent string, n *node) {
+	t.Helper()
+	path += "/" + n.name
+
+	// Amounts carry their currency, CdtDbtInd is a code, Dt and date/time choices hold exactly one of them.
+	switch {
+	case n.name == "Amt":
+		if !regexp.MustCompile(`^[A-Z]{3}$`).MatchString(n.attrs["Ccy"]) {
+			t.Errorf("%s: Ccy attribute %q is not a currency code", path, n.attrs["Ccy"])
+		}
+	case n.name == "CdtDbtInd":
+		if n.text != "CRDT" && n.text != "DBIT" {
+			t.Errorf("%s: %q is not CRDT or DBIT", path, n.text)
+		}
+	case n.name == "Dt" && parent == "Bal", n.name == "BookgDt", n.name == "ValDt":
+		if len(n.children) != 1 || (n.children[0].name != "Dt" && n.children[0].name != "DtTm") {
+			t.Errorf("%s: want exactly one of Dt or DtTm", path)
+		}
+	}
+
+	if len(n.children) == 0 {
+		if check, ok := camt053Simple[parent+"/"+n.name]; ok && !check(n.text) {
+			t.Errorf("%s: %q is not a valid value", path, n.text)
+		}
+		return
+	}
+	// Acct/Id is a choice between IBAN and Othr, only Othr is written.
+	if n.name == "Id" && parent == "Acct" {
+		checkSequence(t, path, n, []particle{{"Othr", 1, 1}})
+	} else if seq, ok := camt053Sequences[n.name]; ok {
+		checkSequence(t, path, n, seq)
+	} else if n.name != "Dt" && n.name != "BookgDt" && n.name != "ValDt" {
+		t.Errorf("%s: element is not part of camt.053.001.02", path)
+	}
+	for _, c := range n.children {
+		checkCamt053(t, path, n.name, c)
+	}
+}
+
+func TestCamt053FollowsSchema(t *testing.T) {
+	doc := parseXML(t, render(t, domain.StatementCamt053))
+	if doc.name != "Document" || doc.attrs["xmlns"] != camt053Namespace {
+		t.Fatalf("root is %s in %q, want Document in %s", doc.name, doc.attrs["xmlns"], camt053Namespace)
+	}
+	checkCamt053(t, "", "", doc)
+}
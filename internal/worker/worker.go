@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 
+	"github.com/yusuf4ktas/backend-project/internal/domain"
 	"github.com/yusuf4ktas/backend-project/internal/service"
 )
 
@@ -13,6 +15,9 @@ type Job struct {
 	ToUserID        int64
 	Amount          float64
 	TransactionType string
+
+	// origin is the principal and request that queued the job, set by AddJob.
+	origin domain.Origin
 }
 
 type Worker struct {
@@ -26,6 +31,7 @@ type Dispatcher struct {
 	maxWorkers int
 	jobQueue   chan Job
 	service    service.TransactionService
+	running    sync.WaitGroup
 }
 
 func NewDispatcher(maxWorkers int, service service.TransactionService) *Dispatcher {
@@ -47,61 +53,104 @@ func NewWorker(id int, workerPool chan chan Job) Worker {
 
 // Worker start listening for jobs.
 func (w Worker) Start(ctx context.Context, service service.TransactionService) {
-	go func() {
-		for {
-			// Worker is ready for a new job
-			w.workerPool <- w.jobQueue
+	go w.run(ctx, service)
+}
 
-			select {
-			case job := <-w.jobQueue:
-				switch job.TransactionType {
-				case "credit":
-					_, err := service.Credit(context.Background(), job.ToUserID, job.Amount)
-					if err != nil {
-						log.Printf("ERROR: worker %d failed to process credit job for user %d: %v", w.id, job.ToUserID, err)
-					} else {
-						fmt.Printf("Worker %d: successfully processed credit for user %d of amount %.2f\n", w.id, job.ToUserID, job.Amount)
-					}
-				case "debit":
-					_, err := service.Debit(context.Background(), job.FromUserID, job.Amount)
-					if err != nil {
-						log.Printf("ERROR: worker %d failed to process debit job for user %d: %v", w.id, job.FromUserID, err)
-					} else {
-						fmt.Printf("Worker %d: successfully processed debit for user %d of amount %.2f\n", w.id, job.FromUserID, job.Amount)
-					}
-				case "transfer", "": // type is "transfer" or empty
-					_, err := service.Transfer(context.Background(), job.FromUserID, job.ToUserID, job.Amount)
-					if err != nil {
-						log.Printf("ERROR: worker %d failed to process transfer job from user %d to user %d: %v", w.id, job.FromUserID, job.ToUserID, err)
-					} else {
-						fmt.Printf("Worker %d: successfully processed transfer from user %d to %d\n", w.id, job.FromUserID, job.ToUserID)
-					}
-				default:
-					log.Printf("ERROR: worker %d received job with unknown type: '%s'", w.id, job.TransactionType)
-				}
+// run processes jobs until ctx is done. A job in progress is finished first.
+func (w Worker) run(ctx context.Context, service service.TransactionService) {
+	for {
+		// Worker is ready for a new job
+		w.workerPool <- w.jobQueue
 
-			case <-ctx.Done():
-				// The context was cancelled, so the worker should stop.
-				fmt.Printf("Worker %d: stopping.\n", w.id)
-				return
+		select {
+		case job := <-w.jobQueue:
+			// The job is audited as part of the request that queued it.
+			jobCtx := domain.WithOrigin(context.Background(), job.origin)
+			switch job.TransactionType {
+			case "credit":
+				_, err := service.Credit(jobCtx, job.ToUserID, job.Amount)
+				if err != nil {
+					log.Printf("ERROR: worker %d failed to process credit job for user %d: %v", w.id, job.ToUserID, err)
+				} else {
+					fmt.Printf("Worker %d: successfully processed credit for user %d of amount %.2f\n", w.id, job.ToUserID, job.Amount)
+				}
+			case "debit":
+				_, err := service.Debit(jobCtx, job.FromUserID, job.Amount)
+				if err != nil {
+					log.Printf("ERROR: worker %d failed to process debit job for user %d: %v", w.id, job.FromUserID, err)
+				} else {
+					fmt.Printf("Worker %d: successfully processed debit for user %d of amount %.2f\n", w.id, job.FromUserID, job.Amount)
+				}
+			case "transfer", "": // type is "transfer" or empty
+				_, err := service.Transfer(jobCtx, job.FromUserID, job.ToUserID, job.Amount)
+				if err != nil {
+					log.Printf("ERROR: worker %d failed to process transfer job from user %d to user %d: %v", w.id, job.FromUserID, job.ToUserID, err)
+				} else {
+					fmt.Printf("Worker %d: successfully processed transfer from user %d to %d\n", w.id, job.FromUserID, job.ToUserID)
+				}
+			default:
+				log.Printf("ERROR: worker %d received job with unknown type: '%s'", w.id, job.TransactionType)
 			}
+
+		case <-ctx.Done():
+			// The context was cancelled, so the worker should stop.
+			fmt.Printf("Worker %d: stopping.\n", w.id)
+			return
 		}
-	}()
+	}
 }
 
 // Sarts all the workers and begins listening for jobs.
 func (d *Dispatcher) Run(ctx context.Context) {
 	for i := 0; i < d.maxWorkers; i++ {
 		worker := NewWorker(i+1, d.workerPool)
-		worker.Start(ctx, d.service) //runs its own goroutine
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			worker.run(ctx, d.service)
+		}()
 	}
 
 	//main dispatch loop in a separate goroutine
-	go d.dispatch(ctx)
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		d.dispatch(ctx)
+	}()
+}
+
+// Wait blocks until the workers and the dispatch loop stopped after the context given to Run is done.
+// Jobs still queued at that point are dropped.
+func (d *Dispatcher) Wait() {
+	d.running.Wait()
+}
+
+// PoolStats is a snapshot of the worker pool.
+type PoolStats struct {
+	Workers       int `json:"workers"`
+	IdleWorkers   int `json:"idle_workers"`
+	QueuedJobs    int `json:"queued_jobs"`
+	QueueCapacity int `json:"queue_capacity"`
+}
+
+// Saturated reports whether the queue is full, in which case AddJob blocks until a worker frees up.
+func (s PoolStats) Saturated() bool {
+	return s.QueuedJobs >= s.QueueCapacity
+}
+
+func (d *Dispatcher) Stats() PoolStats {
+	return PoolStats{
+		Workers:       d.maxWorkers,
+		IdleWorkers:   len(d.workerPool),
+		QueuedJobs:    len(d.jobQueue),
+		QueueCapacity: cap(d.jobQueue),
+	}
 }
 
-// AddJob is a public method to add a new job to the queue.
-func (d *Dispatcher) AddJob(job Job) {
+// AddJob is a public method to add a new job to the queue. The principal and request in ctx
+// are kept with the job, cancelling ctx does not cancel the job.
+func (d *Dispatcher) AddJob(ctx context.Context, job Job) {
+	job.origin = domain.OriginFromContext(ctx)
 	d.jobQueue <- job
 }
 
@@ -109,9 +158,19 @@ func (d *Dispatcher) dispatch(ctx context.Context) {
 	for {
 		select {
 		case job := <-d.jobQueue:
-			jobChannel := <-d.workerPool
+			// The workers stop on ctx too, so waiting for one must not outlive it.
+			var jobChannel chan Job
+			select {
+			case jobChannel = <-d.workerPool:
+			case <-ctx.Done():
+				return
+			}
 
-			jobChannel <- job
+			select {
+			case jobChannel <- job:
+			case <-ctx.Done():
+				return
+			}
 
 		case <-ctx.Done():
 			return